@@ -47,6 +47,26 @@ var globalFlags = []cli.Flag{
 		Usage: "config file",
 		Value: "config.toml",
 	},
+	cli.StringFlag{
+		Name:  "tls-cert",
+		Usage: "tls certificate file",
+		Value: "",
+	},
+	cli.StringFlag{
+		Name:  "tls-key",
+		Usage: "tls key file",
+		Value: "",
+	},
+	cli.StringFlag{
+		Name:  "tls-client-ca",
+		Usage: "ca file to verify tls client certificates",
+		Value: "",
+	},
+	cli.StringFlag{
+		Name:  "tls-redirect",
+		Usage: "address to redirect http requests to https from",
+		Value: "",
+	},
 }
 
 type Cmd struct {
@@ -81,17 +101,33 @@ func New() *Cmd {
 	app.Action = func(c *cli.Context) {
 		options := []func(*server.Server){}
 
-		if v := c.String("port"); v != "" {
-			options = append(options, server.WithAddress(v))
+		// flags take precedence over the configuration file
+		if v := c.String("config"); v != "" {
+			options = append(options, server.WithConfig(v))
+		}
 
+		if c.IsSet("port") {
+			options = append(options, server.WithAddress(c.String("port")))
 		}
 
 		if v := c.String("path"); v != "" {
 			options = append(options, server.WithPath(v))
 		}
 
-		if v := c.String("config"); v != "" {
-			options = append(options, server.WithConfig(v))
+		if c.IsSet("tls-cert") {
+			options = append(options, server.WithTLSCert(c.String("tls-cert")))
+		}
+
+		if c.IsSet("tls-key") {
+			options = append(options, server.WithTLSKey(c.String("tls-key")))
+		}
+
+		if v := c.String("tls-client-ca"); v != "" {
+			options = append(options, server.WithClientCA(v))
+		}
+
+		if v := c.String("tls-redirect"); v != "" {
+			options = append(options, server.WithRedirect(v))
 		}
 
 		srvr := server.New(
@@ -0,0 +1,235 @@
+package server
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"runtime"
+	"time"
+
+	"github.com/dutchcoders/marija/server/datasources"
+	"github.com/dutchcoders/marija/server/messages"
+)
+
+// Aggregate returns nodes for the values of the fields and edges between the
+// values occurring together in items, as counted by the datasources. Items
+// aren't transferred, which makes it possible to graph whole indices.
+func (c *connection) Aggregate(ctx context.Context, r messages.AggregateRequest) error {
+	if len(r.Datasources) == 0 {
+		return errors.New("No datasource set")
+	} else if len(r.Fields) == 0 {
+		return errors.New("No fields set")
+	}
+
+	expr, err := parseQuery(r.Query, r.Translate)
+	if err != nil {
+		return err
+	}
+
+	c.audit(auditEvent{
+		Action:          "aggregate",
+		RequestID:       r.RequestID,
+		Datasources:     r.Datasources,
+		Query:           r.Query,
+		AdvancedQueries: r.AdvancedQueries,
+	})
+
+	for _, index := range r.Datasources {
+		index := index
+
+		datasource, err := c.datasource(index)
+		if err != nil {
+			c.Send(&messages.ErrorMessage{
+				RequestID: r.RequestID,
+				Message:   err.Error(),
+			})
+
+			log.Error(err.Error())
+			continue
+		}
+
+		aggregator, ok := datasource.(datasources.Aggregator)
+		if !ok {
+			c.Send(&messages.ErrorMessage{
+				RequestID: r.RequestID,
+				Message:   fmt.Sprintf("Datasource doesn't support aggregations: %s", index),
+			})
+
+			continue
+		}
+
+		log.Debug("Aggregate query=%s, request=%s, index=%s, fields=%v", r.Query, r.RequestID, index, r.Fields)
+
+		c.Send(&messages.SearchResponse{
+			RequestID:  r.RequestID,
+			Query:      r.Query,
+			Datasource: index,
+		})
+
+		so := datasources.SearchOptions{
+			Query:           r.Query,
+			Expr:            expr,
+			AdvancedQueries: r.AdvancedQueries,
+			Fields:          r.Fields,
+			Size:            r.Size,
+		}
+
+		c.track(r.RequestID, func() {
+			c.aggregate(ctx, r.RequestID, index, aggregator, so)
+		})
+	}
+
+	return nil
+}
+
+func (c *connection) aggregate(ctx context.Context, requestID string, index string, aggregator datasources.Aggregator, so datasources.SearchOptions) (err error) {
+	defer func() {
+		if err := recover(); err != nil {
+			trace := make([]byte, 1024)
+			count := runtime.Stack(trace, true)
+			log.Errorf("Error: %s", err)
+			log.Debugf("Stack of %d bytes: %s\n", count, string(trace))
+		}
+	}()
+
+	start := time.Now()
+
+	graphs := []datasources.Graph{}
+	edges := []datasources.Edge{}
+
+	defer func() {
+		status, message := auditStatus(err)
+
+		c.audit(auditEvent{
+			Action:          "aggregate-completed",
+			RequestID:       requestID,
+			Datasources:     []string{index},
+			Query:           so.Query,
+			AdvancedQueries: so.AdvancedQueries,
+			Status:          status,
+			Error:           message,
+			Count:           auditCount(len(graphs)),
+		})
+	}()
+
+	defer func() {
+		if err == context.Canceled {
+			log.Debug("Aggregate canceled query=%s, requestid=%s, index=%s", so.Query, requestID, index)
+
+			c.Send(&messages.RequestCanceled{
+				RequestID: requestID,
+			})
+		} else if err != nil {
+			log.Error("Aggregate error query=%s, requestid=%s, index=%s, error=%s", so.Query, requestID, index, err.Error())
+
+			c.Send(&messages.ErrorMessage{
+				RequestID: requestID,
+				Message:   err.Error(),
+			})
+		} else {
+			c.server.observe(index, time.Since(start))
+
+			c.Send(&messages.SearchResponse{
+				RequestID:  requestID,
+				Query:      so.Query,
+				Graphs:     graphs,
+				Edges:      edges,
+				Datasource: index,
+			})
+
+			c.Send(&messages.RequestCompleted{
+				RequestID: requestID,
+			})
+
+			log.Debug("Aggregate completed query=%s, requestid=%s, index=%s", so.Query, requestID, index)
+		}
+	}()
+
+	buckets, err := aggregator.Aggregate(ctx, so)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	} else if err != nil {
+		return err
+	}
+
+	// the nodes have no items, they are expanded using the values of the
+	// nodes sent
+	graphs, edges = aggregateGraph(index, so.Fields, buckets)
+	return nil
+}
+
+// aggregateGraph returns a node for every value of the fields in buckets,
+// counting the items containing the value, and edges between values within
+// the same bucket, counting the items containing both values.
+func aggregateGraph(index string, fields []string, buckets []datasources.Bucket) ([]datasources.Graph, []datasources.Edge) {
+	nodes := map[string]*datasources.Graph{}
+	order := []string{}
+
+	type pair struct {
+		source, target string
+	}
+
+	counts := map[pair]int64{}
+	pairs := []pair{}
+
+	for _, bucket := range buckets {
+		ids := []string{}
+
+		for _, field := range fields {
+			value, ok := bucket.Values[field]
+			if !ok {
+				continue
+			}
+
+			values := map[string]interface{}{
+				field: value,
+			}
+
+			id := hex.EncodeToString(hashFields(values))
+
+			node, ok := nodes[id]
+			if !ok {
+				node = &datasources.Graph{
+					ID:         id,
+					Fields:     values,
+					Datasource: index,
+				}
+
+				nodes[id] = node
+				order = append(order, id)
+			}
+
+			node.Count += int(bucket.Count)
+
+			ids = append(ids, id)
+		}
+
+		for i := 0; i < len(ids); i++ {
+			for j := i + 1; j < len(ids); j++ {
+				p := pair{ids[i], ids[j]}
+				if _, ok := counts[p]; !ok {
+					pairs = append(pairs, p)
+				}
+
+				counts[p] += bucket.Count
+			}
+		}
+	}
+
+	graphs := []datasources.Graph{}
+	for _, id := range order {
+		graphs = append(graphs, *nodes[id])
+	}
+
+	edges := []datasources.Edge{}
+	for _, p := range pairs {
+		edges = append(edges, datasources.Edge{
+			Source: p.source,
+			Target: p.target,
+			Count:  counts[p],
+		})
+	}
+
+	return graphs, edges
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dutchcoders/marija/server/datasources"
+)
+
+// Time allowed for the health check of a datasource.
+const pingTimeout = 5 * time.Second
+
+// datasourceStatus is the state of a configured datasource, guarded by the
+// datasource lock of the server.
+type datasourceStatus struct {
+	Type string
+
+	// Err is the error constructing the datasource.
+	Err error
+
+	// ReloadErr is the error applying the last configuration, the
+	// datasource keeps running with its previous configuration.
+	ReloadErr error
+
+	// Latency is the duration of the last query.
+	Latency   time.Duration
+	LastQuery time.Time
+}
+
+// observe records the latency of a query on the datasource.
+func (server *Server) observe(key string, latency time.Duration) {
+	server.m.Lock()
+	defer server.m.Unlock()
+
+	status, ok := server.datasourceStatus[key]
+	if !ok {
+		return
+	}
+
+	status.Latency = latency
+	status.LastQuery = time.Now()
+}
+
+type datasourceHealth struct {
+	Key         string     `json:"key"`
+	Type        string     `json:"type"`
+	Error       string     `json:"error,omitempty"`
+	ReloadError string     `json:"reload-error,omitempty"`
+	Health      string     `json:"health"`
+	HealthError string     `json:"health-error,omitempty"`
+	Latency     int64      `json:"latency-ms,omitempty"`
+	LastQuery   *time.Time `json:"last-query,omitempty"`
+}
+
+// DatasourcesHandler returns every configured datasource with its health.
+// Health is ok or failing for datasources that can be checked, unknown for
+// datasources that can't and unavailable when the datasource couldn't be
+// constructed.
+func (server *Server) DatasourcesHandler(w http.ResponseWriter, r *http.Request) {
+	list := []*datasourceHealth{}
+	pingers := map[*datasourceHealth]datasources.Pinger{}
+
+	// datasources replaced while pinging are closed when done
+	done := server.use()
+	defer done()
+
+	server.m.RLock()
+
+	for key, status := range server.datasourceStatus {
+		dh := &datasourceHealth{
+			Key:    key,
+			Type:   status.Type,
+			Health: "unknown",
+		}
+
+		if status.Err != nil {
+			dh.Error = status.Err.Error()
+			dh.Health = "unavailable"
+		}
+
+		if status.ReloadErr != nil {
+			dh.ReloadError = status.ReloadErr.Error()
+		}
+
+		if !status.LastQuery.IsZero() {
+			lastQuery := status.LastQuery
+
+			dh.Latency = int64(status.Latency / time.Millisecond)
+			dh.LastQuery = &lastQuery
+		}
+
+		if p, ok := server.Datasources[key].(datasources.Pinger); ok {
+			pingers[dh] = p
+		}
+
+		list = append(list, dh)
+	}
+
+	server.m.RUnlock()
+
+	ctx, cancel := context.WithTimeout(r.Context(), pingTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+
+	for dh, p := range pingers {
+		wg.Add(1)
+
+		go func(dh *datasourceHealth, p datasources.Pinger) {
+			defer wg.Done()
+
+			if err := p.Ping(ctx); err != nil {
+				dh.Health = "failing"
+				dh.HealthError = err.Error()
+				return
+			}
+
+			dh.Health = "ok"
+		}(dh, p)
+	}
+
+	wg.Wait()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Key < list[j].Key
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(list); err != nil {
+		log.Error("Error encoding datasources: %s", err.Error())
+	}
+}
+
+// HealthzHandler reports that the server is alive.
+func (server *Server) HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+// ReadyzHandler reports whether the server is ready to accept requests, which
+// is after the datasources have been started and until it is stopping.
+func (server *Server) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(&server.ready) == 0 || server.Stopping() {
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+
+	fmt.Fprintln(w, "ok")
+}
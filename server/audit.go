@@ -0,0 +1,151 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dutchcoders/marija/server/datasources"
+)
+
+// auditEvent is a single line in the audit log.
+type auditEvent struct {
+	Time            time.Time                   `json:"time"`
+	Action          string                      `json:"action"`
+	RemoteAddr      string                      `json:"remote-addr,omitempty"`
+	User            string                      `json:"user,omitempty"`
+	RequestID       string                      `json:"request-id,omitempty"`
+	Datasources     []string                    `json:"datasources,omitempty"`
+	Query           string                      `json:"query,omitempty"`
+	AdvancedQueries []datasources.AdvancedQuery `json:"advanced-queries,omitempty"`
+	Items           []string                    `json:"items,omitempty"`
+	Format          string                      `json:"format,omitempty"`
+	Status          string                      `json:"status,omitempty"`
+	Error           string                      `json:"error,omitempty"`
+	Count           *int                        `json:"count,omitempty"`
+}
+
+// auditor writes audit events as json lines to all of its outputs.
+type auditor struct {
+	m       sync.Mutex
+	outputs []io.Writer
+}
+
+// newAuditor opens the configured audit outputs, it returns nil when no audit
+// log has been configured.
+func (server *Server) newAuditor() (*auditor, error) {
+	if len(server.Audit) == 0 {
+		return nil, nil
+	}
+
+	a := &auditor{}
+
+	for _, c := range server.Audit {
+		var output io.Writer
+
+		switch {
+		case c.Output == "stdout":
+			output = os.Stdout
+		case c.Output == "stderr":
+			output = os.Stderr
+		case c.Output == "syslog" || strings.HasPrefix(c.Output, "syslog://") || strings.HasPrefix(c.Output, "syslog+tcp://"):
+			w, err := openSyslog(c.Output)
+			if err != nil {
+				a.Close()
+				return nil, err
+			}
+
+			output = w
+		default:
+			f, err := os.OpenFile(os.ExpandEnv(c.Output), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+			if err != nil {
+				a.Close()
+				return nil, err
+			}
+
+			output = f
+		}
+
+		a.outputs = append(a.outputs, output)
+	}
+
+	return a, nil
+}
+
+func (a *auditor) Write(e auditEvent) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		log.Error("Error encoding audit event: %s", err.Error())
+		return
+	}
+
+	data = append(data, '\n')
+
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	for _, output := range a.outputs {
+		if _, err := output.Write(data); err != nil {
+			log.Error("Error writing audit event: %s", err.Error())
+		}
+	}
+}
+
+// Close closes the outputs, except stdout and stderr.
+func (a *auditor) Close() error {
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	for _, output := range a.outputs {
+		if output == os.Stdout || output == os.Stderr {
+			continue
+		}
+
+		if c, ok := output.(io.Closer); ok {
+			c.Close()
+		}
+	}
+
+	a.outputs = nil
+	return nil
+}
+
+// audit writes the event to the audit log, if one has been configured.
+func (server *Server) audit(e auditEvent) {
+	if server.auditor == nil {
+		return
+	}
+
+	server.auditor.Write(e)
+}
+
+// audit writes the event with the remote address and user of the connection.
+func (c *connection) audit(e auditEvent) {
+	e.RemoteAddr = c.remoteAddr
+	e.User = c.user.String()
+
+	c.server.audit(e)
+}
+
+func auditCount(n int) *int {
+	return &n
+}
+
+func auditStatus(err error) (string, string) {
+	switch {
+	case err == nil:
+		return "completed", ""
+	case err == context.Canceled:
+		return "canceled", ""
+	default:
+		return "error", err.Error()
+	}
+}
@@ -0,0 +1,13 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package server
+
+import (
+	"errors"
+	"io"
+)
+
+func openSyslog(output string) (io.Writer, error) {
+	return nil, errors.New("Syslog is not supported on this platform")
+}
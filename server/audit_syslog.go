@@ -0,0 +1,30 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package server
+
+import (
+	"io"
+	"log/syslog"
+	"net/url"
+)
+
+// openSyslog opens the local syslog daemon, or the remote one for urls like
+// syslog://host:514 or syslog+tcp://host:514.
+func openSyslog(output string) (io.Writer, error) {
+	if output == "syslog" {
+		return syslog.New(syslog.LOG_INFO|syslog.LOG_AUTH, "marija")
+	}
+
+	u, err := url.Parse(output)
+	if err != nil {
+		return nil, err
+	}
+
+	network := "udp"
+	if u.Scheme == "syslog+tcp" {
+		network = "tcp"
+	}
+
+	return syslog.Dial(network, u.Host, syslog.LOG_INFO|syslog.LOG_AUTH, "marija")
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	logging "github.com/op/go-logging"
+)
+
+var log = logging.MustGetLogger("marija/auth")
+
+var (
+	// ErrNoCredentials is returned when the request doesn't contain
+	// credentials for the authenticator.
+	ErrNoCredentials = errors.New("No credentials")
+
+	// ErrInvalidCredentials is returned when the credentials of the request
+	// are invalid.
+	ErrInvalidCredentials = errors.New("Invalid credentials")
+)
+
+// User is an authenticated user.
+type User struct {
+	Name string
+
+	// Datasources contains the keys of the datasources the user is allowed
+	// to use, an empty list or "*" allows every datasource.
+	Datasources []string
+}
+
+// Allowed returns true if the user is allowed to use the datasource. A nil
+// user is used when authentication has been disabled and is allowed to use
+// every datasource.
+func (u *User) Allowed(datasource string) bool {
+	if u == nil || len(u.Datasources) == 0 {
+		return true
+	}
+
+	for _, v := range u.Datasources {
+		if v == "*" || v == datasource {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (u *User) String() string {
+	if u == nil {
+		return ""
+	}
+
+	return u.Name
+}
+
+// Authenticator authenticates http requests.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*User, error)
+}
+
+// Chain tries each of the authenticators in order until one of them finds
+// credentials in the request.
+type Chain []Authenticator
+
+func (c Chain) Authenticate(r *http.Request) (*User, error) {
+	for _, a := range c {
+		user, err := a.Authenticate(r)
+		if err == ErrNoCredentials {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		return user, nil
+	}
+
+	return nil, ErrNoCredentials
+}
+
+type contextKey struct{}
+
+// WithUser returns a copy of ctx containing the user.
+func WithUser(ctx context.Context, user *User) context.Context {
+	return context.WithValue(ctx, contextKey{}, user)
+}
+
+// UserFromContext returns the user of ctx, or nil if none has been set.
+func UserFromContext(ctx context.Context) *User {
+	user, _ := ctx.Value(contextKey{}).(*User)
+	return user
+}
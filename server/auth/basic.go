@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+// Basic authenticates requests using http basic authentication.
+type Basic struct {
+	users map[string]basicUser
+}
+
+type basicUser struct {
+	password string
+	user     *User
+}
+
+func NewBasic() *Basic {
+	return &Basic{
+		users: map[string]basicUser{},
+	}
+}
+
+// Add adds a user with password.
+func (b *Basic) Add(user *User, password string) {
+	b.users[user.Name] = basicUser{
+		password: password,
+		user:     user,
+	}
+}
+
+func (b *Basic) Authenticate(r *http.Request) (*User, error) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+
+	u, ok := b.users[username]
+	if !ok {
+		// compare anyway, to not reveal whether the user exists
+		subtle.ConstantTimeCompare([]byte(password), []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+
+	if subtle.ConstantTimeCompare([]byte(password), []byte(u.password)) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+
+	return u.user, nil
+}
@@ -0,0 +1,259 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Minimum time between two refreshes of a remote key set.
+	refreshInterval = time.Minute
+
+	// Maximum time to retrieve a remote key set.
+	fetchTimeout = 10 * time.Second
+)
+
+// KeySet returns the public keys used to verify tokens, by key id.
+type KeySet interface {
+	Key(kid string) (interface{}, error)
+}
+
+// JWKS is a json web key set read from a file or an url, like the jwks_uri of
+// an OpenID Connect provider. Remote key sets are refreshed when a token is
+// signed with an unknown key, once at a time.
+type JWKS struct {
+	location string
+	client   *http.Client
+
+	m       sync.Mutex
+	keys    map[string]interface{}
+	fetched time.Time
+
+	// refreshing is closed when the refresh in progress has completed,
+	// with err as its result
+	refreshing chan struct{}
+	err        error
+}
+
+func NewJWKS(location string) (*JWKS, error) {
+	ks := &JWKS{
+		location: location,
+		client: &http.Client{
+			Timeout: fetchTimeout,
+		},
+	}
+
+	keys, err := ks.fetch()
+	if err != nil {
+		return nil, err
+	}
+
+	ks.keys = keys
+	ks.fetched = time.Now()
+	return ks, nil
+}
+
+func (ks *JWKS) remote() bool {
+	return strings.HasPrefix(ks.location, "http://") || strings.HasPrefix(ks.location, "https://")
+}
+
+// fetch reads the keys of the key set, it is called without the lock held.
+func (ks *JWKS) fetch() (map[string]interface{}, error) {
+	var r io.ReadCloser
+
+	if ks.remote() {
+		resp, err := ks.client.Get(ks.location)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("Error retrieving key set %s: %s", ks.location, resp.Status)
+		}
+
+		r = resp.Body
+	} else if f, err := os.Open(ks.location); err != nil {
+		return nil, err
+	} else {
+		r = f
+	}
+
+	defer r.Close()
+
+	return ParseJWKS(r)
+}
+
+// refresh fetches the key set again, callers wait for a refresh already in
+// progress instead of starting another. The caller needs to hold the lock,
+// which is released while fetching.
+func (ks *JWKS) refresh() error {
+	if ch := ks.refreshing; ch != nil {
+		ks.m.Unlock()
+		<-ch
+		ks.m.Lock()
+
+		return ks.err
+	}
+
+	ch := make(chan struct{})
+	ks.refreshing = ch
+
+	ks.m.Unlock()
+	keys, err := ks.fetch()
+	ks.m.Lock()
+
+	if err == nil {
+		ks.keys = keys
+	}
+
+	// failed refreshes count as well, to not retry on every request
+	ks.fetched = time.Now()
+	ks.err = err
+
+	ks.refreshing = nil
+	close(ch)
+
+	return err
+}
+
+func (ks *JWKS) Key(kid string) (interface{}, error) {
+	ks.m.Lock()
+	defer ks.m.Unlock()
+
+	if key, ok := ks.lookup(kid); ok {
+		return key, nil
+	}
+
+	if !ks.remote() || (ks.refreshing == nil && time.Since(ks.fetched) < refreshInterval) {
+		return nil, fmt.Errorf("Unknown key: %s", kid)
+	}
+
+	if err := ks.refresh(); err != nil {
+		return nil, err
+	}
+
+	if key, ok := ks.lookup(kid); ok {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("Unknown key: %s", kid)
+}
+
+func (ks *JWKS) lookup(kid string) (interface{}, bool) {
+	if kid == "" && len(ks.keys) == 1 {
+		for _, key := range ks.keys {
+			return key, true
+		}
+	}
+
+	key, ok := ks.keys[kid]
+	return key, ok
+}
+
+// ParseJWKS parses the RSA and EC keys of a json web key set.
+func ParseJWKS(r io.Reader) (map[string]interface{}, error) {
+	set := struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}{}
+
+	if err := json.NewDecoder(r).Decode(&set); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]interface{}{}
+
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		switch k.Kty {
+		case "RSA":
+			n, err := decodeBigInt(k.N)
+			if err != nil {
+				return nil, err
+			}
+
+			e, err := decodeBigInt(k.E)
+			if err != nil {
+				return nil, err
+			}
+
+			keys[k.Kid] = &rsa.PublicKey{
+				N: n,
+				E: int(e.Int64()),
+			}
+		case "EC":
+			var curve elliptic.Curve
+
+			switch k.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			case "P-521":
+				curve = elliptic.P521()
+			default:
+				return nil, fmt.Errorf("Unsupported curve: %s", k.Crv)
+			}
+
+			x, err := decodeBigInt(k.X)
+			if err != nil {
+				return nil, err
+			}
+
+			y, err := decodeBigInt(k.Y)
+			if err != nil {
+				return nil, err
+			}
+
+			keys[k.Kid] = &ecdsa.PublicKey{
+				Curve: curve,
+				X:     x,
+				Y:     y,
+			}
+		default:
+			log.Warningf("Ignoring key %s with unsupported type: %s", k.Kid, k.Kty)
+		}
+	}
+
+	return keys, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(data), nil
+}
+
+// Secret is a key set containing a single shared secret, used to verify
+// tokens signed with HMAC.
+type Secret []byte
+
+func (s Secret) Key(kid string) (interface{}, error) {
+	return []byte(s), nil
+}
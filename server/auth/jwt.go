@@ -0,0 +1,231 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Allowed clock skew when validating the time claims of a token.
+const leeway = time.Minute
+
+var (
+	ErrTokenExpired = errors.New("Token expired")
+)
+
+// JWT authenticates requests with a bearer token containing a json web token,
+// as issued by OpenID Connect providers.
+type JWT struct {
+	Keys KeySet
+
+	Issuer   string
+	Audience string
+
+	// UsernameClaim is the claim containing the name of the user, defaults
+	// to sub.
+	UsernameClaim string
+
+	// Users returns the user for the name in the token.
+	Users func(name string) *User
+}
+
+func (j *JWT) Authenticate(r *http.Request) (*User, error) {
+	token := bearerToken(r)
+	if token == "" || strings.Count(token, ".") != 2 {
+		return nil, ErrNoCredentials
+	}
+
+	claims, err := j.Verify(token)
+	if err != nil {
+		log.Debugf("Invalid token: %s", err.Error())
+		return nil, ErrInvalidCredentials
+	}
+
+	claim := j.UsernameClaim
+	if claim == "" {
+		claim = "sub"
+	}
+
+	name, ok := claims[claim].(string)
+	if !ok || name == "" {
+		log.Debugf("Token doesn't contain claim: %s", claim)
+		return nil, ErrInvalidCredentials
+	}
+
+	if j.Users == nil {
+		return &User{Name: name}, nil
+	}
+
+	return j.Users(name), nil
+}
+
+// Verify verifies the signature and the time, issuer and audience claims of
+// the token and returns its claims.
+func (j *JWT) Verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("Malformed token")
+	}
+
+	header := struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}{}
+
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := j.Keys.Key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	claims := map[string]interface{}{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	if v, ok := claims["exp"].(float64); !ok {
+		return nil, errors.New("Token has no expiration")
+	} else if now.After(time.Unix(int64(v), 0).Add(leeway)) {
+		return nil, ErrTokenExpired
+	}
+
+	if v, ok := claims["nbf"].(float64); !ok {
+	} else if now.Add(leeway).Before(time.Unix(int64(v), 0)) {
+		return nil, errors.New("Token not yet valid")
+	}
+
+	if j.Issuer == "" {
+	} else if v, _ := claims["iss"].(string); v != j.Issuer {
+		return nil, fmt.Errorf("Invalid issuer: %s", v)
+	}
+
+	if j.Audience == "" {
+	} else if !hasAudience(claims["aud"], j.Audience) {
+		return nil, fmt.Errorf("Invalid audience")
+	}
+
+	return claims, nil
+}
+
+func hasAudience(v interface{}, audience string) bool {
+	switch v := v.(type) {
+	case string:
+		return v == audience
+	case []interface{}:
+		for _, a := range v {
+			if a == audience {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func decodeSegment(s string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+func verifySignature(alg string, key interface{}, signed []byte, signature []byte) error {
+	if len(alg) != 5 {
+		return fmt.Errorf("Unsupported algorithm: %s", alg)
+	}
+
+	var hash crypto.Hash
+
+	switch alg[2:] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("Unsupported algorithm: %s", alg)
+	}
+
+	if alg[:2] == "HS" {
+		secret, ok := key.([]byte)
+		if !ok {
+			return fmt.Errorf("Invalid key for algorithm: %s", alg)
+		}
+
+		mac := hmac.New(hash.New, secret)
+		mac.Write(signed)
+
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return errors.New("Invalid signature")
+		}
+
+		return nil
+	}
+
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch alg[:2] {
+	case "RS", "PS":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("Invalid key for algorithm: %s", alg)
+		}
+
+		if alg[:2] == "PS" {
+			return rsa.VerifyPSS(pub, hash, digest, signature, nil)
+		}
+
+		return rsa.VerifyPKCS1v15(pub, hash, digest, signature)
+	case "ES":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("Invalid key for algorithm: %s", alg)
+		}
+
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("Invalid signature")
+		}
+
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return errors.New("Invalid signature")
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("Unsupported algorithm: %s", alg)
+	}
+}
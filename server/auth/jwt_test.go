@@ -0,0 +1,332 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testKey struct {
+	kid string
+	alg string
+	key interface{}
+}
+
+func newRSAKey(t *testing.T, kid string) testKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return testKey{kid, "RS256", key}
+}
+
+func newECKey(t *testing.T, kid string) testKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return testKey{kid, "ES256", key}
+}
+
+// padBigInt returns the bytes of i, padded with zeros to size.
+func padBigInt(i *big.Int, size int) []byte {
+	data := i.Bytes()
+	for len(data) < size {
+		data = append([]byte{0}, data...)
+	}
+
+	return data
+}
+
+func encodeBigInt(i *big.Int, size int) string {
+	return base64.RawURLEncoding.EncodeToString(padBigInt(i, size))
+}
+
+// jwks returns the json web key set of the public keys.
+func jwks(keys ...testKey) []byte {
+	set := struct {
+		Keys []map[string]string `json:"keys"`
+	}{}
+
+	for _, k := range keys {
+		switch key := k.key.(type) {
+		case *rsa.PrivateKey:
+			set.Keys = append(set.Keys, map[string]string{
+				"kid": k.kid,
+				"kty": "RSA",
+				"use": "sig",
+				"n":   encodeBigInt(key.N, 0),
+				"e":   encodeBigInt(big.NewInt(int64(key.E)), 0),
+			})
+		case *ecdsa.PrivateKey:
+			set.Keys = append(set.Keys, map[string]string{
+				"kid": k.kid,
+				"kty": "EC",
+				"crv": "P-256",
+				"x":   encodeBigInt(key.X, 32),
+				"y":   encodeBigInt(key.Y, 32),
+			})
+		}
+	}
+
+	data, _ := json.Marshal(set)
+	return data
+}
+
+// sign returns the token for the claims, signed using k.
+func sign(t *testing.T, k testKey, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{
+		"alg": k.alg,
+		"kid": k.kid,
+		"typ": "JWT",
+	})
+
+	payload, _ := json.Marshal(claims)
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	var signature []byte
+
+	switch key := k.key.(type) {
+	case *rsa.PrivateKey:
+		digest := crypto.SHA256.New()
+		digest.Write([]byte(signed))
+
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest.Sum(nil)); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		digest := crypto.SHA256.New()
+		digest.Write([]byte(signed))
+
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest.Sum(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		signature = append(padBigInt(r, 32), padBigInt(s, 32)...)
+	case []byte:
+		mac := hmac.New(crypto.SHA256.New, key)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// keySetServer serves the key set returned by keys, counting the requests.
+func keySetServer(keys func() []byte, requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		w.Write(keys())
+	}))
+}
+
+func TestJWTVerify(t *testing.T) {
+	rsaKey := newRSAKey(t, "rsa")
+	ecKey := newECKey(t, "ec")
+	otherKey := newRSAKey(t, "rsa")
+
+	requests := int32(0)
+
+	ts := keySetServer(func() []byte {
+		return jwks(rsaKey, ecKey)
+	}, &requests)
+	defer ts.Close()
+
+	ks, err := NewJWKS(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	j := &JWT{
+		Keys:          ks,
+		Issuer:        "https://idp.example.com/",
+		Audience:      "marija",
+		UsernameClaim: "preferred_username",
+	}
+
+	claims := func(fn func(map[string]interface{})) map[string]interface{} {
+		c := map[string]interface{}{
+			"sub":                "1234",
+			"preferred_username": "alice",
+			"iss":                "https://idp.example.com/",
+			"aud":                []string{"other", "marija"},
+			"exp":                time.Now().Add(time.Hour).Unix(),
+		}
+
+		if fn != nil {
+			fn(c)
+		}
+
+		return c
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		err   bool
+	}{
+		{"rsa", sign(t, rsaKey, claims(nil)), false},
+		{"ec", sign(t, ecKey, claims(nil)), false},
+		{"expired", sign(t, rsaKey, claims(func(c map[string]interface{}) {
+			c["exp"] = time.Now().Add(-time.Hour).Unix()
+		})), true},
+		{"no expiration", sign(t, rsaKey, claims(func(c map[string]interface{}) {
+			delete(c, "exp")
+		})), true},
+		{"not yet valid", sign(t, rsaKey, claims(func(c map[string]interface{}) {
+			c["nbf"] = time.Now().Add(time.Hour).Unix()
+		})), true},
+		{"issuer", sign(t, rsaKey, claims(func(c map[string]interface{}) {
+			c["iss"] = "https://evil.example.com/"
+		})), true},
+		{"audience", sign(t, rsaKey, claims(func(c map[string]interface{}) {
+			c["aud"] = "other"
+		})), true},
+		{"signature", sign(t, otherKey, claims(nil)), true},
+		{"unknown key", sign(t, newRSAKey(t, "unknown"), claims(nil)), true},
+		{"hmac", sign(t, testKey{"rsa", "HS256", []byte("secret")}, claims(nil)), true},
+		{"malformed", "abc.def", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := j.Verify(tt.token)
+			if tt.err && err == nil {
+				t.Fatal("expected error")
+			} else if !tt.err && err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	// unknown keys don't refresh the key set within the refresh interval
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Fatalf("expected 1 request, got %d", n)
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer "+sign(t, ecKey, claims(nil)))
+
+	user, err := j.Authenticate(r)
+	if err != nil {
+		t.Fatal(err)
+	} else if user.Name != "alice" {
+		t.Fatalf("expected alice, got %s", user.Name)
+	}
+}
+
+func TestJWKSRefresh(t *testing.T) {
+	oldKey := newRSAKey(t, "old")
+	newKey := newECKey(t, "new")
+
+	var m sync.Mutex
+	keys := jwks(oldKey)
+
+	requests := int32(0)
+
+	ts := keySetServer(func() []byte {
+		m.Lock()
+		defer m.Unlock()
+
+		// slow enough for the refreshes to overlap
+		time.Sleep(50 * time.Millisecond)
+		return keys
+	}, &requests)
+	defer ts.Close()
+
+	ks, err := NewJWKS(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	j := &JWT{Keys: ks}
+
+	token := sign(t, newKey, map[string]interface{}{
+		"sub": "alice",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+
+	// the key has been rotated
+	m.Lock()
+	keys = jwks(oldKey, newKey)
+	m.Unlock()
+
+	if _, err := j.Verify(token); err == nil {
+		t.Fatal("expected error for key within refresh interval")
+	}
+
+	ks.m.Lock()
+	ks.fetched = time.Now().Add(-refreshInterval)
+	ks.m.Unlock()
+
+	// concurrent requests wait for a single refresh
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			_, err := j.Verify(token)
+			errs <- err
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Fatalf("expected 2 requests, got %d", n)
+	}
+}
+
+func TestJWKSTimeout(t *testing.T) {
+	done := make(chan struct{})
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+
+	defer ts.Close()
+	defer close(done)
+
+	ks := &JWKS{
+		location: ts.URL,
+		client: &http.Client{
+			Timeout: 100 * time.Millisecond,
+		},
+	}
+
+	start := time.Now()
+
+	if _, err := ks.Key("kid"); err == nil {
+		t.Fatal("expected error")
+	} else if time.Since(start) > 5*time.Second {
+		t.Fatalf("key set retrieved after %s", time.Since(start))
+	}
+}
@@ -0,0 +1,210 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/dutchcoders/marija/server/auth"
+)
+
+// newAuthenticator returns the authenticator for the configured users, tokens
+// and token verifier. Authentication is disabled when nothing has been
+// configured.
+func (server *Server) newAuthenticator() (auth.Authenticator, error) {
+	c := server.config
+
+	users := map[string]*auth.User{}
+
+	basic := auth.NewBasic()
+	token := auth.NewToken()
+
+	if c.Username != "" {
+		user := &auth.User{
+			Name:        c.Username,
+			Datasources: c.Auth.Datasources,
+		}
+
+		users[user.Name] = user
+		basic.Add(user, c.Password)
+	}
+
+	for _, u := range c.Auth.Users {
+		user := &auth.User{
+			Name:        u.Name,
+			Datasources: u.Datasources,
+		}
+
+		if len(user.Datasources) == 0 {
+			user.Datasources = c.Auth.Datasources
+		}
+
+		users[user.Name] = user
+
+		if u.Password != "" {
+			basic.Add(user, u.Password)
+		}
+
+		for _, t := range u.Tokens {
+			token.Add(user, t)
+		}
+	}
+
+	chain := auth.Chain{}
+
+	server.basicAuth = c.Username != ""
+	for _, u := range c.Auth.Users {
+		server.basicAuth = server.basicAuth || u.Password != ""
+	}
+
+	if server.basicAuth {
+		chain = append(chain, basic)
+	}
+
+	for _, u := range c.Auth.Users {
+		if len(u.Tokens) > 0 {
+			chain = append(chain, token)
+			break
+		}
+	}
+
+	if c.Auth.JWT.JWKS != "" || c.Auth.JWT.Secret != "" {
+		var keys auth.KeySet
+
+		if c.Auth.JWT.JWKS == "" {
+			keys = auth.Secret(c.Auth.JWT.Secret)
+		} else if ks, err := auth.NewJWKS(c.Auth.JWT.JWKS); err != nil {
+			return nil, fmt.Errorf("Error loading key set: %s: %s", c.Auth.JWT.JWKS, err.Error())
+		} else {
+			keys = ks
+		}
+
+		chain = append(chain, &auth.JWT{
+			Keys:          keys,
+			Issuer:        c.Auth.JWT.Issuer,
+			Audience:      c.Auth.JWT.Audience,
+			UsernameClaim: c.Auth.JWT.UsernameClaim,
+			Users: func(name string) *auth.User {
+				if user, ok := users[name]; ok {
+					return user
+				}
+
+				return &auth.User{
+					Name:        name,
+					Datasources: c.Auth.Datasources,
+				}
+			},
+		})
+	}
+
+	if len(chain) == 0 {
+		return nil, nil
+	}
+
+	return chain, nil
+}
+
+// authenticate only passes authenticated requests to next, the user will be
+// added to the context of the request.
+func (server *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if server.authenticator == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, err := server.authenticator.Authenticate(r)
+		if err != nil {
+			log.Warningf("Authentication failed host=%s, path=%s: %s", r.RemoteAddr, r.URL.Path, err.Error())
+
+			if server.basicAuth {
+				realm := server.Service
+				if realm == "" {
+					realm = "Marija"
+				}
+
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", realm))
+			} else {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+			}
+
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.WithUser(r.Context(), user)))
+	})
+}
+
+// admin only passes requests of admins to next, it needs to be wrapped by
+// authenticate. When authentication is disabled only requests from localhost
+// are passed.
+func (server *Server) admin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if server.authenticator == nil && isLoopback(r.RemoteAddr) {
+			next.ServeHTTP(w, r)
+			return
+		} else if server.authenticator == nil {
+			log.Warningf("Admin access denied host=%s, path=%s, authentication disabled", r.RemoteAddr, r.URL.Path)
+
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		user := auth.UserFromContext(r.Context())
+
+		for _, name := range server.Auth.Admins {
+			if user != nil && user.Name == name {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		log.Warningf("Admin access denied host=%s, path=%s, user=%s", r.RemoteAddr, r.URL.Path, user.String())
+
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+	})
+}
+
+// isLoopback returns true when the remote address is a loopback address.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// checkOrigin checks the origin of websocket requests against the allowed
+// origins, requests of the same origin are always allowed. Requests without
+// origin aren't made by browsers and are allowed.
+func (server *Server) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	for _, allowed := range server.Auth.Origins {
+		if allowed == "*" {
+			return true
+		} else if strings.EqualFold(strings.TrimRight(allowed, "/"), u.Scheme+"://"+u.Host) {
+			return true
+		}
+	}
+
+	log.Warningf("Origin not allowed host=%s, origin=%s", r.RemoteAddr, origin)
+	return false
+}
@@ -1,34 +1,213 @@
 package server
 
 import (
+	"container/list"
+	"encoding/json"
 	_ "log"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/dutchcoders/marija/server/datasources"
 )
 
+// ItemCache is the in-memory ItemStore, it keeps at most maxEntries nodes and
+// maxSize bytes of items, and evicts the least recently used nodes first. The
+// size of the items is their size encoded as json.
 type ItemCache struct {
-	sync.Map
+	maxEntries int
+	maxSize    int64
+	ttl        time.Duration
+
+	m       sync.Mutex
+	size    int64
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+type cacheEntry struct {
+	key     string
+	items   []datasources.Item
+	keys    map[string]bool
+	size    int64
+	expires time.Time
+}
+
+// NewItemCache returns an in-memory item cache. A maxEntries, maxSize or ttl
+// of zero means no limit.
+func NewItemCache(maxEntries int, maxSize int64, ttl time.Duration) *ItemCache {
+	return &ItemCache{
+		maxEntries: maxEntries,
+		maxSize:    maxSize,
+		ttl:        ttl,
+		entries:    map[string]*list.Element{},
+		lru:        list.New(),
+	}
 }
 
 func (ic *ItemCache) Store(key string, items []datasources.Item) {
-	ic.Map.Store(key, items)
+	ic.m.Lock()
+	defer ic.m.Unlock()
+
+	ic.store(key, items)
+}
+
+func (ic *ItemCache) store(key string, items []datasources.Item) *cacheEntry {
+	expires := time.Time{}
+	if ic.ttl > 0 {
+		expires = time.Now().Add(ic.ttl)
+	}
+
+	size := int64(0)
+	for _, item := range items {
+		size += ic.itemSize(item)
+	}
+
+	if e, ok := ic.entries[key]; ok {
+		entry := e.Value.(*cacheEntry)
+		ic.size += size - entry.size
+
+		entry.items = items
+		entry.keys = itemKeys(items)
+		entry.size = size
+		entry.expires = expires
+
+		ic.lru.MoveToFront(e)
+		ic.evict()
+		return entry
+	}
+
+	entry := &cacheEntry{
+		key:     key,
+		items:   items,
+		keys:    itemKeys(items),
+		size:    size,
+		expires: expires,
+	}
+
+	ic.entries[key] = ic.lru.PushFront(entry)
+	ic.size += size
+
+	ic.evict()
+	return entry
+}
+
+// itemSize returns the size of the item encoded as json, the size is only
+// needed when the cache has a maximum size.
+func (ic *ItemCache) itemSize(item datasources.Item) int64 {
+	if ic.maxSize == 0 {
+		return 0
+	}
+
+	data, err := json.Marshal(item)
+	if err != nil {
+		return 0
+	}
+
+	return int64(len(data))
+}
+
+// evict removes the least recently used nodes until the cache is within its
+// limits.
+func (ic *ItemCache) evict() {
+	for ic.lru.Len() > 0 {
+		if ic.maxEntries > 0 && ic.lru.Len() > ic.maxEntries {
+		} else if ic.maxSize > 0 && ic.size > ic.maxSize {
+		} else {
+			break
+		}
+
+		ic.remove(ic.lru.Back())
+	}
 }
 
-func (is *ItemCache) LoadOrStore(key string, value []datasources.Item) ([]datasources.Item, bool) {
-	actual, ok := is.Map.LoadOrStore(key, value)
+func (ic *ItemCache) Append(key string, item datasources.Item) {
+	ic.m.Lock()
+	defer ic.m.Unlock()
+
+	items, ok := ic.load(key)
 	if !ok {
-		return nil, false
+		ic.store(key, []datasources.Item{item})
+		return
+	}
+
+	entry := ic.entries[key].Value.(*cacheEntry)
+
+	if k, ok := itemKey(item); !ok {
+	} else if entry.keys[k] {
+		return
+	} else {
+		entry.keys[k] = true
+	}
+
+	entry.items = append(items, item)
+
+	size := ic.itemSize(item)
+	entry.size += size
+	ic.size += size
+
+	if ic.ttl > 0 {
+		entry.expires = time.Now().Add(ic.ttl)
+	}
+
+	ic.evict()
+}
+
+func (ic *ItemCache) Purge(prefix string) {
+	ic.m.Lock()
+	defer ic.m.Unlock()
+
+	for key, e := range ic.entries {
+		if strings.HasPrefix(key, prefix) {
+			ic.remove(e)
+		}
+	}
+}
+
+func (ic *ItemCache) LoadOrStore(key string, value []datasources.Item) ([]datasources.Item, bool) {
+	ic.m.Lock()
+	defer ic.m.Unlock()
+
+	if items, ok := ic.load(key); ok {
+		return items, true
 	}
 
-	return actual.([]datasources.Item), true
+	ic.store(key, value)
+	return nil, false
+}
+
+func (ic *ItemCache) Load(key string) ([]datasources.Item, bool) {
+	ic.m.Lock()
+	defer ic.m.Unlock()
+
+	return ic.load(key)
 }
 
-func (is *ItemCache) Load(key string) ([]datasources.Item, bool) {
-	value, ok := is.Map.Load(key)
+func (ic *ItemCache) load(key string) ([]datasources.Item, bool) {
+	e, ok := ic.entries[key]
 	if !ok {
 		return nil, false
 	}
 
-	return value.([]datasources.Item), true
+	entry := e.Value.(*cacheEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		ic.remove(e)
+		return nil, false
+	}
+
+	ic.lru.MoveToFront(e)
+	return entry.items, true
+}
+
+func (ic *ItemCache) remove(e *list.Element) {
+	entry := e.Value.(*cacheEntry)
+
+	ic.lru.Remove(e)
+	delete(ic.entries, entry.key)
+
+	ic.size -= entry.size
+}
+
+func (ic *ItemCache) Close() error {
+	return nil
 }
@@ -1,24 +1,131 @@
 package server
 
 import (
+	"fmt"
 	_ "log"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
 )
 
+type duration struct {
+	time.Duration
+}
+
+func (d *duration) UnmarshalText(text []byte) (err error) {
+	d.Duration, err = time.ParseDuration(string(text))
+	return err
+}
+
+// byteSize is a number of bytes, written as a number with an optional unit
+// like 512MB or 1GB.
+type byteSize int64
+
+var byteUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"TB", 1 << 40},
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+func (b *byteSize) UnmarshalText(text []byte) error {
+	s := strings.ToUpper(strings.TrimSpace(string(text)))
+
+	unit := int64(1)
+	for _, u := range byteUnits {
+		if strings.HasSuffix(s, u.suffix) {
+			s, unit = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.size
+			break
+		}
+	}
+
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || v < 0 {
+		return fmt.Errorf("Invalid size: %s", string(text))
+	}
+
+	*b = byteSize(v * unit)
+	return nil
+}
+
 type config struct {
 	path    string
 	address string
 	debug   bool
 
+	// file is the configuration file, read again when reloading.
+	file string
+
 	ListenerString string `toml:"listen"`
 
+	TLSCert     string `toml:"tls_cert"`
+	TLSKey      string `toml:"tls_key"`
+	TLSClientCA string `toml:"tls_client_ca"`
+	TLSRedirect string `toml:"tls_redirect"`
+
 	Username string `toml:"username"`
 	Password string `toml:"password"`
 	Service  string `toml:"service"`
 
 	Datasources map[string]toml.Primitive `toml:"datasource"`
 
+	SessionTimeout duration `toml:"session_timeout"`
+	DrainTimeout   duration `toml:"drain_timeout"`
+
+	Auth struct {
+		// Origins allowed to connect to the websocket besides the origin
+		// of Marija itself, all origins are allowed using "*".
+		Origins []string `toml:"origins"`
+
+		// Admins are the users allowed to use the admin endpoints, only
+		// requests from localhost are allowed when authentication is
+		// disabled.
+		Admins []string `toml:"admins"`
+
+		// Datasources allowed for users without their own list.
+		Datasources []string `toml:"datasources"`
+
+		Users []struct {
+			Name        string   `toml:"name"`
+			Password    string   `toml:"password"`
+			Tokens      []string `toml:"tokens"`
+			Datasources []string `toml:"datasources"`
+		} `toml:"user"`
+
+		JWT struct {
+			JWKS          string `toml:"jwks"`
+			Secret        string `toml:"secret"`
+			Issuer        string `toml:"issuer"`
+			Audience      string `toml:"audience"`
+			UsernameClaim string `toml:"username_claim"`
+		} `toml:"jwt"`
+	} `toml:"auth"`
+
+	// Entities are the fields of all datasources containing the same kind
+	// of values, equal values are resolved into shared entity nodes.
+	Entities []struct {
+		Name   string   `toml:"name"`
+		Fields []string `toml:"fields"`
+	} `toml:"entity"`
+
+	Cache struct {
+		Type       string   `toml:"type"`
+		Path       string   `toml:"path"`
+		MaxEntries int      `toml:"max_entries"`
+		MaxSize    byteSize `toml:"max_size"`
+		TTL        duration `toml:"ttl"`
+	} `toml:"cache"`
+
+	Audit []struct {
+		Output string `toml:"output"`
+	} `toml:"audit"`
+
 	Logging []struct {
 		Output string `toml:"output"`
 		Level  string `toml:"level"`
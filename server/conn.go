@@ -4,10 +4,14 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	_ "log"
 	"net/http"
+	"sync"
 	"time"
 
+	"github.com/dutchcoders/marija/server/auth"
+	"github.com/dutchcoders/marija/server/datasources"
 	"github.com/dutchcoders/marija/server/messages"
 
 	"github.com/gorilla/websocket"
@@ -31,41 +35,249 @@ const (
 
 	// Maximum message size allowed from peer.
 	maxMessageSize = 512
+
+	// Maximum number of concurrent searches per connection.
+	maxStreams = 4
 )
 
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
 }
 
 type connection struct {
 	ws     *websocket.Conn
-	send   chan json.Marshaler
+	sendCh chan json.Marshaler
 	b      int
 	server *Server
-	closed bool
+	done   chan struct{}
+	user   *auth.User
+
+	remoteAddr string
+
+	m       sync.Mutex
+	session *session
+
+	// st is the state of the connection, which is the state of the session
+	// when one is attached. own is the state of the connection itself.
+	st  *state
+	own *state
+
+	// requests are the requests in flight of the connection itself,
+	// requests made while attached to a session belong to the session.
+	requests *requests
 
-	items ItemCache //map[string][]datasources.Item
+	// streams limits the number of concurrent searches
+	streams chan struct{}
 }
 
+// Send sends the message to the session when the connection has been
+// attached to one, and to the peer otherwise.
 func (c *connection) Send(v json.Marshaler) {
-	if c.closed {
+	if _, ok := v.(*messages.ErrorMessage); ok {
+		errorMessagesTotal.Inc()
+	}
+
+	// the graph is kept to be exported
+	if sr, ok := v.(*messages.SearchResponse); ok {
+		c.sentGraph().add(sr.Graphs, sr.Edges)
+	}
+
+	if s := c.Session(); s != nil {
+		s.Send(v)
+		return
+	}
+
+	c.send(v)
+}
+
+func (c *connection) send(v json.Marshaler) {
+	select {
+	case c.sendCh <- v:
+	case <-c.done:
+	}
+}
+
+// datasource returns the datasource for key, if the user of the connection is
+// allowed to use it.
+func (c *connection) datasource(key string) (datasources.Index, error) {
+	if !c.user.Allowed(key) {
+		return nil, fmt.Errorf("Not allowed to use datasource: %s", key)
+	}
+
+	ds, ok := c.server.GetDatasource(key)
+	if !ok {
+		return nil, fmt.Errorf("Could not find datasource: %s", key)
+	}
+
+	return ds, nil
+}
+
+// items returns the items of the node with id in the item cache, without the
+// items of datasources the user of the connection isn't allowed to use.
+func (c *connection) items(id string) ([]datasources.Item, bool) {
+	items, ok := c.store().Load(id)
+	if !ok {
+		return nil, false
+	}
+
+	allowed := []datasources.Item{}
+	for _, item := range items {
+		if c.user.Allowed(item.Datasource) {
+			allowed = append(allowed, item)
+		}
+	}
+
+	return allowed, len(allowed) > 0
+}
+
+// nodeItems returns the items of the node with id, nodes of aggregations
+// have no items and are returned as item with the values of the node.
+func (c *connection) nodeItems(id string) ([]datasources.Item, bool) {
+	if items, ok := c.items(id); ok {
+		return items, true
+	}
+
+	node, ok := c.sentGraph().node(id)
+	if !ok || !c.user.Allowed(node.Datasource) {
+		return nil, false
+	}
+
+	return []datasources.Item{
+		{
+			ID:         node.ID,
+			Fields:     node.Fields,
+			Datasource: node.Datasource,
+		},
+	}, true
+}
+
+// close sends a close frame to the peer, the connection will be closed when
+// the peer replies.
+func (c *connection) close() {
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "Server shutting down")
+	if err := c.ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(writeWait)); err != nil {
+		log.Debug("Error sending close frame: %s", err.Error())
+	}
+}
+
+func (c *connection) Session() *session {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return c.session
+}
+
+// state returns the state of the connection, which is the state of the
+// session if one is attached.
+func (c *connection) state() *state {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return c.st
+}
+
+// store returns the item cache of the connection, which is the item cache of
+// the session if one is attached.
+func (c *connection) store() ItemStore {
+	return c.state().items
+}
+
+func (c *connection) attach(s *session) {
+	c.m.Lock()
+	prev := c.session
+	c.session = s
+	c.st = s.state
+	c.m.Unlock()
+
+	if prev != nil {
+		prev.detach(c)
+	}
+
+	// a session is attached to a single connection, the connection it was
+	// attached to continues without session
+	if other := s.attach(c); other != nil && other != c {
+		other.detached(s)
+	}
+}
+
+// detached detaches the connection from the session, after the session has
+// been resumed by another connection. The connection continues without
+// session.
+func (c *connection) detached(s *session) {
+	c.m.Lock()
+	if c.session != s {
+		c.m.Unlock()
+		return
+	}
+
+	c.session = nil
+	c.st = c.own
+	c.m.Unlock()
+
+	c.send(&messages.ErrorMessage{
+		Message: fmt.Sprintf("Session %s has been resumed by another connection", s.ID),
+	})
+}
+
+// requestSet returns the requests of the connection, which are the requests
+// of the session if one is attached.
+func (c *connection) requestSet() *requests {
+	if s := c.Session(); s != nil {
+		return s.requests
+	}
+
+	return c.requests
+}
+
+// track runs fn in a goroutine of the request, the request is in flight
+// until all of its goroutines have returned. Requests are refused once the
+// server is stopping.
+func (c *connection) track(requestID string, fn func()) {
+	rs := c.requestSet()
+	r := rs.acquire(requestID)
+
+	started := c.server.track(func() {
+		defer rs.release(r)
+
+		fn()
+	})
+
+	if started {
 		return
 	}
 
-	c.send <- v
+	rs.release(r)
+
+	c.Send(&messages.ErrorMessage{
+		RequestID: requestID,
+		Message:   "Server is shutting down",
+	})
+}
+
+func (c *connection) cancelRequest(requestID string) bool {
+	if c.requests.cancel(requestID) {
+		return true
+	}
+
+	if s := c.Session(); s != nil {
+		return s.requests.cancel(requestID)
+	}
+
+	return false
 }
 
 // readPump pumps messages from the websocket connection to the hub.
 func (c *connection) readPump() {
 	defer func() {
 		h.unregister <- c
+
+		if s := c.Session(); s != nil {
+			s.detach(c)
+		}
+
+		close(c.done)
 		c.ws.Close()
-		c.closed = true
-		close(c.send)
 	}()
 
 	c.ws.SetReadLimit(0)
@@ -75,25 +287,14 @@ func (c *connection) readPump() {
 		return nil
 	})
 
-	datasources := make([]messages.Datasource, 0, len(c.server.Datasources))
-
-	for k, ds := range c.server.Datasources {
-		datasources = append(datasources, messages.Datasource{ID: k, Name: k, Type: ds.Type()})
-	}
-
 	c.Send(&messages.InitialStateMessage{
-		Datasources: datasources,
+		Datasources: c.datasourceList(),
 		Version:     Version,
 		CommitID:    CommitID,
 	})
 
-	cancelFuncs := map[string]context.CancelFunc{}
-
-	defer func() {
-		for _, cancel := range cancelFuncs {
-			cancel()
-		}
-	}()
+	// requests of a session will continue when the connection drops
+	defer c.requests.cancelAll()
 
 	for {
 		_, data, err := c.ws.ReadMessage()
@@ -111,18 +312,65 @@ func (c *connection) readPump() {
 		}
 
 		if r.Type == messages.ActionTypeCancel {
-			cancel, ok := cancelFuncs[r.RequestID]
-			if !ok {
+			if !c.cancelRequest(r.RequestID) {
 				log.Error("Could not find cancel func for requestid: %s", r.RequestID)
-				continue
 			}
 
-			cancel()
 			continue
 		}
 
-		ctx, cancel := context.WithCancel(context.Background())
-		cancelFuncs[r.RequestID] = cancel
+		if c.server.Stopping() {
+			c.Send(&messages.ErrorMessage{
+				RequestID: r.RequestID,
+				Message:   "Server is shutting down",
+			})
+
+			continue
+		}
+
+		switch r.Type {
+		case messages.ActionTypeSessionCreate:
+			r := messages.SessionCreateRequest{}
+			if err := json.Unmarshal(data, &r); err != nil {
+				log.Error("Error occured creating session: %s", err.Error())
+				c.Send(&messages.ErrorMessage{
+					RequestID: r.RequestID,
+					Message:   err.Error(),
+				})
+			} else if err := c.CreateSession(r); err != nil {
+				log.Error("Error occured creating session: %s", err.Error())
+				c.Send(&messages.ErrorMessage{
+					RequestID: r.RequestID,
+					Message:   err.Error(),
+				})
+			}
+
+			continue
+		case messages.ActionTypeSessionResume:
+			r := messages.SessionResumeRequest{}
+			if err := json.Unmarshal(data, &r); err != nil {
+				log.Error("Error occured resuming session: %s", err.Error())
+				c.Send(&messages.ErrorMessage{
+					RequestID: r.RequestID,
+					Message:   err.Error(),
+				})
+			} else if err := c.ResumeSession(r); err != nil {
+				log.Error("Error occured resuming session: %s", err.Error())
+				c.Send(&messages.ErrorMessage{
+					RequestID: r.RequestID,
+					Message:   err.Error(),
+				})
+			}
+
+			continue
+		}
+
+		ctx, cancel := context.WithCancel(c.server.ctx)
+
+		// the request is referenced while it is being handled, the
+		// goroutines of the request reference it as well
+		rs := c.requestSet()
+		req := rs.add(r.RequestID, cancel, c.server.use())
 
 		switch r.Type {
 		case messages.ActionTypeSearchRequest:
@@ -137,6 +385,23 @@ func (c *connection) readPump() {
 			} else if err := c.Search(ctx, r); err != nil {
 				log.Error("Error occured during search: %s", err.Error())
 
+				c.Send(&messages.ErrorMessage{
+					RequestID: r.RequestID,
+					Message:   err.Error(),
+				})
+			}
+		case messages.ActionTypeContinueRequest:
+			r := messages.ContinueRequest{}
+			if err := json.Unmarshal(data, &r); err != nil {
+				log.Error("Error occured during continue: %s", err.Error())
+
+				c.Send(&messages.ErrorMessage{
+					RequestID: r.RequestID,
+					Message:   err.Error(),
+				})
+			} else if err := c.Continue(ctx, r); err != nil {
+				log.Error("Error occured during continue: %s", err.Error())
+
 				c.Send(&messages.ErrorMessage{
 					RequestID: r.RequestID,
 					Message:   err.Error(),
@@ -173,9 +438,71 @@ func (c *connection) readPump() {
 					Message:   err.Error(),
 				})
 			}
+		case messages.ActionTypeExpandRequest:
+			r := messages.ExpandRequest{}
+			if err := json.Unmarshal(data, &r); err != nil {
+				log.Error("Error occured during expand: %s", err.Error())
+				c.Send(&messages.ErrorMessage{
+					RequestID: r.RequestID,
+					Message:   err.Error(),
+				})
+			} else if err := c.Expand(ctx, r); err != nil {
+				log.Error("Error occured during expand: %s", err.Error())
+				c.Send(&messages.ErrorMessage{
+					RequestID: r.RequestID,
+					Message:   err.Error(),
+				})
+			}
+		case messages.ActionTypeAggregateRequest:
+			r := messages.AggregateRequest{}
+			if err := json.Unmarshal(data, &r); err != nil {
+				log.Error("Error occured during aggregate: %s", err.Error())
+				c.Send(&messages.ErrorMessage{
+					RequestID: r.RequestID,
+					Message:   err.Error(),
+				})
+			} else if err := c.Aggregate(ctx, r); err != nil {
+				log.Error("Error occured during aggregate: %s", err.Error())
+				c.Send(&messages.ErrorMessage{
+					RequestID: r.RequestID,
+					Message:   err.Error(),
+				})
+			}
+		case messages.ActionTypeHistogramRequest:
+			r := messages.HistogramRequest{}
+			if err := json.Unmarshal(data, &r); err != nil {
+				log.Error("Error occured during histogram: %s", err.Error())
+				c.Send(&messages.ErrorMessage{
+					RequestID: r.RequestID,
+					Message:   err.Error(),
+				})
+			} else if err := c.Histogram(ctx, r); err != nil {
+				log.Error("Error occured during histogram: %s", err.Error())
+				c.Send(&messages.ErrorMessage{
+					RequestID: r.RequestID,
+					Message:   err.Error(),
+				})
+			}
+		case messages.ActionTypeExportRequest:
+			r := messages.ExportRequest{}
+			if err := json.Unmarshal(data, &r); err != nil {
+				log.Error("Error occured during export: %s", err.Error())
+				c.Send(&messages.ErrorMessage{
+					RequestID: r.RequestID,
+					Message:   err.Error(),
+				})
+			} else if err := c.Export(ctx, r); err != nil {
+				log.Error("Error occured during export: %s", err.Error())
+				c.Send(&messages.ErrorMessage{
+					RequestID: r.RequestID,
+					Message:   err.Error(),
+				})
+			}
 		default:
 			log.Error("Unknown request: %s", r.Type)
 		}
+
+		rs.release(req)
 	}
 }
 
@@ -195,13 +522,10 @@ func (c *connection) writePump() {
 
 	for {
 		select {
-		case message, ok := <-c.send:
-			if !ok {
-				c.closed = true
-				c.write(websocket.CloseMessage, []byte{})
-				return
-			}
-
+		case <-c.done:
+			c.write(websocket.CloseMessage, []byte{})
+			return
+		case message := <-c.sendCh:
 			buff := new(bytes.Buffer)
 			if err := json.NewEncoder(buff).Encode(message); err != nil {
 				log.Error("%s", err.Error())
@@ -221,24 +545,43 @@ func (c *connection) writePump() {
 
 // serveWs handles websocket requests from the peer.
 func (s *Server) serveWs(w http.ResponseWriter, r *http.Request) {
+	upgrader := upgrader
+	upgrader.CheckOrigin = s.checkOrigin
+
 	ws, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Error(err.Error())
 		return
 	}
 
+	user := auth.UserFromContext(r.Context())
+
+	// without a session, the items are kept for the user, so they remain
+	// available after reconnecting and for the other connections of the
+	// user
+	st := newState(s.items, userPrefix(user.String()), s.entities)
+
 	c := &connection{
-		send:   make(chan json.Marshaler, 256),
+		sendCh: make(chan json.Marshaler, 256),
 		ws:     ws,
 		server: s,
-		items:  ItemCache{},
+		done:   make(chan struct{}),
+		user:   user,
+		st:     st,
+		own:    st,
+
+		remoteAddr: r.RemoteAddr,
+
+		requests: newRequests(),
+
+		streams: make(chan struct{}, maxStreams),
 	}
 
 	ws.SetReadLimit(0)
 
 	h.register <- c
 
-	log.Info("Connection upgraded host=%s", r.RemoteAddr)
+	log.Info("Connection upgraded host=%s, user=%s", r.RemoteAddr, c.user)
 	defer log.Info("Connection closed")
 
 	go c.writePump()
@@ -0,0 +1,237 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/dutchcoders/marija/server/datasources"
+	"github.com/dutchcoders/marija/server/datasources/query"
+	"github.com/dutchcoders/marija/server/messages"
+	"github.com/dutchcoders/marija/server/normalize"
+	"github.com/dutchcoders/marija/server/unique"
+)
+
+// maxContinuations is the number of searches per connection or session that
+// can be continued, older searches are forgotten.
+const maxContinuations = 16
+
+// maxResults returns the maximum number of results of the datasource for a
+// search, the lowest of the configured max-results of the datasource and the
+// requested maximum. Zero means unlimited.
+func (server *Server) maxResults(key string, requested int) int {
+	server.m.RLock()
+	defer server.m.RUnlock()
+
+	limit := 0
+	if v, ok := server.datasourceConfigs[key]["max-results"].(int64); ok && v > 0 {
+		limit = int(v)
+	}
+
+	if requested > 0 && (limit == 0 || requested < limit) {
+		limit = requested
+	}
+
+	return limit
+}
+
+// normalizer returns the normalizer configured for the datasource.
+func (server *Server) normalizer(key string) *normalize.Normalizer {
+	server.m.RLock()
+	defer server.m.RUnlock()
+
+	return server.datasourceNormalizers[key]
+}
+
+// cursor is the position of a search within the results of a datasource.
+type cursor struct {
+	m sync.Mutex
+
+	// id identifies the search to the datasource, which can keep its
+	// position to continue from
+	id string
+
+	limit   int
+	offset  int
+	more    bool
+	running bool
+
+	// unique contains the nodes of the search and edges the typed edges,
+	// counts continue accumulating when continuing.
+	unique *unique.Unique
+	edges  edges
+}
+
+// start marks the cursor as running and returns the window of results to
+// search. It returns false when the cursor is running or has no more results.
+func (cur *cursor) start(continued bool) (from int, size int, ok bool) {
+	cur.m.Lock()
+	defer cur.m.Unlock()
+
+	if cur.running || (continued && !cur.more) {
+		return 0, 0, false
+	}
+
+	cur.running = true
+
+	if cur.limit == 0 {
+		return cur.offset, 0, true
+	}
+
+	// one extra result is searched to know whether there are more results
+	return cur.offset, cur.limit + 1, true
+}
+
+// done advances the cursor with the number of results returned.
+func (cur *cursor) done(count int, more bool) {
+	cur.m.Lock()
+	defer cur.m.Unlock()
+
+	cur.running = false
+	cur.offset += count
+	cur.more = more
+}
+
+// continuation is a search that can be continued.
+type continuation struct {
+	request messages.SearchRequest
+	expr    query.Node
+	seed    int64
+
+	cursors map[string]*cursor
+
+	// normalizers normalize the field values per datasource
+	normalizers map[string]*normalize.Normalizer
+}
+
+// Continue continues a search with the next results of the datasources that
+// have more results.
+func (c *connection) Continue(ctx context.Context, r messages.ContinueRequest) error {
+	cont, ok := c.state().continuation(r.RequestID)
+	if !ok {
+		return fmt.Errorf("Could not find search to continue: %s", r.RequestID)
+	}
+
+	c.audit(auditEvent{
+		Action:          "continue",
+		RequestID:       r.RequestID,
+		Datasources:     cont.request.Datasources,
+		Query:           cont.request.Query,
+		AdvancedQueries: cont.request.AdvancedQueries,
+	})
+
+	keys := []string{}
+	for key := range cont.cursors {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	continued := 0
+
+	for _, index := range keys {
+		datasource, err := c.datasource(index)
+		if err != nil {
+			c.Send(&messages.ErrorMessage{
+				RequestID: r.RequestID,
+				Message:   err.Error(),
+			})
+
+			log.Error(err.Error())
+			continue
+		}
+
+		if c.search(ctx, cont, index, datasource, true) {
+			continued++
+		}
+	}
+
+	if continued == 0 {
+		return errors.New("No more results")
+	}
+
+	return nil
+}
+
+// search searches the datasource for the next results of the continuation,
+// it returns false when there is nothing to search.
+func (c *connection) search(ctx context.Context, cont *continuation, index string, datasource datasources.Index, continued bool) bool {
+	r := cont.request
+	cur := cont.cursors[index]
+
+	from, size, ok := cur.start(continued)
+	if !ok {
+		return false
+	}
+
+	if r.Sample {
+		if cur.limit == 0 {
+			cur.done(0, false)
+
+			c.Send(&messages.ErrorMessage{
+				RequestID: r.RequestID,
+				Message:   fmt.Sprintf("Sampling needs a maximum number of results: %s", index),
+			})
+
+			return false
+		}
+
+		datasource = &sampleSearch{
+			Index: datasource,
+			seed:  cont.seed,
+		}
+	}
+
+	log.Debug("Search query=%s, request=%s, index=%s, from=%d, size=%d", r.Query, r.RequestID, index, from, size)
+
+	c.Send(&messages.SearchResponse{
+		RequestID:  r.RequestID,
+		Query:      r.Query,
+		Datasource: index,
+	})
+
+	so := datasources.SearchOptions{
+		Query:           r.Query,
+		Expr:            cont.expr,
+		AdvancedQueries: r.AdvancedQueries,
+		From:            from,
+		Size:            size,
+	}
+
+	if cur.limit > 0 {
+		so.Continuation = cur.id
+	}
+
+	c.track(r.RequestID, func() {
+		c.stream(ctx, r.RequestID, r.Query, index, datasource, so, cur, func(item datasources.Item) ([]datasources.Node, []datasources.Edge) {
+			normalizer := cont.normalizers[index]
+
+			nodes := []datasources.Node{}
+
+			id := ""
+			if values, ok := identity(r.Fields, normalizer, item); ok {
+				node := c.node(cur.unique, index, hashFields(values), values, item)
+
+				id = node.ID
+				nodes = append(nodes, *node)
+			}
+
+			// nodes are counted once per item
+			seen := map[string]bool{
+				id: true,
+			}
+
+			entityNodes, entityEdges := c.resolve(cur, index, normalizer, id, item, seen)
+			relationNodes, relationEdges := c.relate(cur, index, normalizer, item, seen)
+
+			nodes = append(nodes, entityNodes...)
+			nodes = append(nodes, relationNodes...)
+
+			return nodes, append(entityEdges, relationEdges...)
+		})
+	})
+
+	return true
+}
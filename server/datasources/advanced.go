@@ -0,0 +1,142 @@
+package datasources
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var wildcardEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`)
+
+// ElasticAdvancedQueries translates the advanced queries to a single query in
+// the Elasticsearch query dsl, all queries need to match.
+func ElasticAdvancedQueries(aqs []AdvancedQuery) (map[string]interface{}, error) {
+	filters := []interface{}{}
+
+	for _, aq := range aqs {
+		q, err := elasticAdvancedQuery(aq)
+		if err != nil {
+			return nil, err
+		}
+
+		filters = append(filters, q)
+	}
+
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"filter": filters,
+		},
+	}, nil
+}
+
+func elasticBool(occur string, queries ...interface{}) map[string]interface{} {
+	b := map[string]interface{}{
+		occur: queries,
+	}
+
+	if occur == "should" {
+		b["minimum_should_match"] = 1
+	}
+
+	return map[string]interface{}{
+		"bool": b,
+	}
+}
+
+// elasticRange returns a range query for the pairs of operator and bound.
+func elasticRange(field string, bounds ...string) map[string]interface{} {
+	r := map[string]interface{}{}
+	for i := 0; i+1 < len(bounds); i += 2 {
+		r[bounds[i]] = bounds[i+1]
+	}
+
+	return map[string]interface{}{
+		"range": map[string]interface{}{
+			field: r,
+		},
+	}
+}
+
+func elasticField(query, field string, v interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		query: map[string]interface{}{
+			field: v,
+		},
+	}
+}
+
+func elasticAdvancedQuery(aq AdvancedQuery) (map[string]interface{}, error) {
+	operator := strings.ToLower(aq.Operator)
+
+	switch operator {
+	case OperatorAnd, OperatorOr, OperatorNot:
+		if len(aq.Queries) == 0 {
+			return nil, fmt.Errorf("No queries set for operator: %s", operator)
+		}
+
+		queries := []interface{}{}
+
+		for _, sub := range aq.Queries {
+			q, err := elasticAdvancedQuery(sub)
+			if err != nil {
+				return nil, err
+			}
+
+			queries = append(queries, q)
+		}
+
+		switch operator {
+		case OperatorAnd:
+			return elasticBool("must", queries...), nil
+		case OperatorOr:
+			return elasticBool("should", queries...), nil
+		default:
+			return elasticBool("must_not", queries...), nil
+		}
+	}
+
+	if aq.Field == "" {
+		return nil, errors.New("No field set for advanced query")
+	}
+
+	switch operator {
+	case "":
+		// legacy behaviour, match from value until now
+		return elasticRange(aq.Field, "gte", aq.Value, "lt", time.Now().Format(time.RFC3339)), nil
+	case OperatorEq:
+		return elasticField("term", aq.Field, aq.Value), nil
+	case OperatorNeq:
+		return elasticBool("must_not", elasticField("term", aq.Field, aq.Value)), nil
+	case OperatorContains:
+		return elasticField("wildcard", aq.Field, "*"+wildcardEscaper.Replace(aq.Value)+"*"), nil
+	case OperatorPrefix:
+		return elasticField("prefix", aq.Field, aq.Value), nil
+	case OperatorWildcard:
+		return elasticField("wildcard", aq.Field, aq.Value), nil
+	case OperatorRegex:
+		return elasticField("regexp", aq.Field, aq.Value), nil
+	case OperatorExists:
+		return map[string]interface{}{
+			"exists": map[string]interface{}{
+				"field": aq.Field,
+			},
+		}, nil
+	case OperatorGt, OperatorGte, OperatorLt, OperatorLte:
+		return elasticRange(aq.Field, operator, aq.Value), nil
+	case OperatorBetween:
+		if len(aq.Values) != 2 {
+			return nil, fmt.Errorf("Operator between expects 2 values for field: %s", aq.Field)
+		}
+
+		return elasticRange(aq.Field, "gte", aq.Values[0], "lte", aq.Values[1]), nil
+	case OperatorIn:
+		if len(aq.Values) == 0 {
+			return nil, fmt.Errorf("Operator in expects values for field: %s", aq.Field)
+		}
+
+		return elasticField("terms", aq.Field, aq.Values), nil
+	default:
+		return nil, fmt.Errorf("Unsupported operator: %s", aq.Operator)
+	}
+}
@@ -65,6 +65,8 @@ func (b *BTC) Search(ctx context.Context, so datasources.SearchOptions) datasour
 		qry := strings.Replace(so.Query, "\"", "", -1)
 
 		sendTx := func(tx blockchain.Transaction) {
+			date := time.Unix(tx.Time, 0)
+
 			inputs := []string{}
 			sumOfInput := float64(0)
 
@@ -117,9 +119,23 @@ func (b *BTC) Search(ctx context.Context, so datasources.SearchOptions) datasour
 					"address_tag_link": output.AddressTagLink,
 				}
 
+				// the inputs of the transaction transfer to every output
+				relations := []datasources.Relation{}
+				for _, input := range inputs {
+					relations = append(relations, datasources.Relation{
+						Type:   "transfer",
+						Field:  "address",
+						Source: input,
+						Target: output.Address,
+						Weight: float64(output.Value) / 100000000,
+						Time:   &date,
+					})
+				}
+
 				item := datasources.Item{
-					ID:     fmt.Sprintf("output.%s.%s.%d", tx.Hash, output.Address, output.TransactionIndex),
-					Fields: fields,
+					ID:        fmt.Sprintf("output.%s.%s.%d", tx.Hash, output.Address, output.TransactionIndex),
+					Fields:    fields,
+					Relations: relations,
 				}
 
 				select {
@@ -0,0 +1,26 @@
+package datasources
+
+// DefaultBuckets is the number of buckets returned by aggregations when no
+// size has been set.
+const DefaultBuckets = 1000
+
+// MaxBuckets is the maximum number of buckets returned by aggregations.
+const MaxBuckets = 10000
+
+// BucketSize returns the number of buckets to return for the requested size.
+func BucketSize(size int) int {
+	if size <= 0 {
+		return DefaultBuckets
+	} else if size > MaxBuckets {
+		return MaxBuckets
+	}
+
+	return size
+}
+
+// Bucket is a combination of values of fields with the number of items
+// containing the combination. Fields without value are missing from Values.
+type Bucket struct {
+	Values map[string]string `json:"values"`
+	Count  int64             `json:"count"`
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -320,6 +321,30 @@ func (c *client) Query(q string) (*queryOutput, error) {
 	return &output, nil
 }
 
+type accountOutput struct {
+	Login string `json:"login"`
+	Email string `json:"email"`
+	Quota struct {
+		Used      int `json:"used"`
+		Allowance int `json:"allowance"`
+	} `json:"quota"`
+}
+
+// GET /api/v1/account
+func (c *client) Account(ctx context.Context) (*accountOutput, error) {
+	request, err := c.NewRequest("GET", "/api/v1/account", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	output := accountOutput{}
+	if err := c.Do(request.WithContext(ctx), &output); err != nil {
+		return nil, err
+	}
+
+	return &output, nil
+}
+
 func (c *client) NewRequest(method, urlStr string, body interface{}) (*http.Request, error) {
 	rel, err := url.Parse(urlStr)
 	if err != nil {
@@ -58,6 +58,14 @@ func (m *Censys) Type() string {
 	return "censys"
 }
 
+// Ping checks whether the api credentials are valid.
+func (b *Censys) Ping(ctx context.Context) error {
+	cs := api.New(b.ApiID, b.ApiSecret)
+
+	_, err := cs.Account(ctx)
+	return err
+}
+
 func (b *Censys) Search(ctx context.Context, so datasources.SearchOptions) datasources.SearchResponse {
 	itemCh := make(chan datasources.Item)
 	errorCh := make(chan error)
@@ -34,8 +34,36 @@ func WithConfig(c toml.Primitive) func(Index) error {
 	}
 }
 
+// Operators of advanced queries. Queries without operator match a range from
+// the value until now.
+const (
+	OperatorEq       = "eq"
+	OperatorNeq      = "neq"
+	OperatorContains = "contains"
+	OperatorPrefix   = "prefix"
+	OperatorWildcard = "wildcard"
+	OperatorRegex    = "regex"
+	OperatorExists   = "exists"
+	OperatorGt       = "gt"
+	OperatorGte      = "gte"
+	OperatorLt       = "lt"
+	OperatorLte      = "lte"
+	OperatorBetween  = "between"
+	OperatorIn       = "in"
+
+	OperatorAnd = "and"
+	OperatorOr  = "or"
+	OperatorNot = "not"
+)
+
 type AdvancedQuery struct {
 	Field    string `json:"field"`
 	Operator string `json:"operator"`
 	Value    string `json:"value"`
+
+	// Values contains the bounds for between and the list for in.
+	Values []string `json:"values,omitempty"`
+
+	// Queries contains the queries combined by and, or and not.
+	Queries []AdvancedQuery `json:"queries,omitempty"`
 }
@@ -0,0 +1,24 @@
+package datasources
+
+import (
+	"time"
+)
+
+type Edge struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Field  string `json:"field"`
+
+	// Count is the number of items the values of the nodes occur together in
+	// for aggregated edges, which have no field, and the number of relations
+	// for typed edges.
+	Count int64 `json:"count,omitempty"`
+
+	// Type is the type of the relations of typed edges, the field is the
+	// field of the value nodes. The edge counts the relations, sums their
+	// weights and spans the times they have been seen.
+	Type      string     `json:"type,omitempty"`
+	Weight    float64    `json:"weight,omitempty"`
+	FirstSeen *time.Time `json:"first-seen,omitempty"`
+	LastSeen  *time.Time `json:"last-seen,omitempty"`
+}
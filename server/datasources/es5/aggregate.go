@@ -0,0 +1,182 @@
+package es5
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	elastic "gopkg.in/olivere/elastic.v5"
+
+	"github.com/dutchcoders/marija/server/datasources"
+)
+
+// levelSize returns the number of buckets of each of the nested terms
+// aggregations, the number of combinations grows with every field and is
+// kept within size.
+func levelSize(size, levels int) int {
+	n := 1
+
+	for {
+		combinations := 1
+		for l := 0; l < levels && combinations <= size; l++ {
+			combinations *= n + 1
+		}
+
+		if combinations > size {
+			return n
+		}
+
+		n++
+	}
+}
+
+// Aggregate counts the combinations of the values of the fields using nested
+// terms aggregations, in order of the fields. Only items with a value for the
+// first field are counted.
+func (i *Elasticsearch) Aggregate(ctx context.Context, so datasources.SearchOptions) ([]datasources.Bucket, error) {
+	if len(so.Fields) == 0 {
+		return nil, errors.New("No fields set")
+	}
+
+	size := datasources.BucketSize(so.Size)
+
+	q, err := searchQuery(so)
+	if err != nil {
+		return nil, err
+	}
+
+	var agg *elastic.TermsAggregation
+
+	level := levelSize(size, len(so.Fields))
+
+	for n := len(so.Fields) - 1; n >= 0; n-- {
+		terms := elastic.NewTermsAggregation().Field(so.Fields[n]).Size(level)
+
+		if agg != nil {
+			terms = terms.SubAggregation("values", agg)
+		}
+
+		agg = terms
+	}
+
+	results, err := i.client.Search().
+		Index(i.Indices...).
+		Query(q).
+		Size(0).
+		Aggregation("values", agg).
+		Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	terms, ok := results.Aggregations.Terms("values")
+	if !ok {
+		return nil, nil
+	}
+
+	buckets := collectBuckets(so.Fields, map[string]string{}, terms, nil)
+
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].Count > buckets[j].Count
+	})
+
+	if len(buckets) > size {
+		buckets = buckets[:size]
+	}
+
+	return buckets, nil
+}
+
+// collectBuckets returns the buckets of the nested terms aggregation. Items
+// without value for the nested field are returned as bucket with the values
+// of the parents.
+func collectBuckets(fields []string, parent map[string]string, terms *elastic.AggregationBucketKeyItems, buckets []datasources.Bucket) []datasources.Bucket {
+	for _, b := range terms.Buckets {
+		values := map[string]string{}
+		for k, v := range parent {
+			values[k] = v
+		}
+
+		values[fields[0]] = bucketKey(b)
+
+		remaining := b.DocCount
+
+		if len(fields) > 1 {
+			if sub, ok := b.Aggregations.Terms("values"); ok {
+				buckets = collectBuckets(fields[1:], values, sub, buckets)
+
+				// items with values outside of the returned buckets
+				// aren't missing the value
+				remaining -= sub.SumOfOtherDocCount
+
+				for _, sb := range sub.Buckets {
+					remaining -= sb.DocCount
+				}
+			}
+		}
+
+		if remaining <= 0 {
+			continue
+		}
+
+		buckets = append(buckets, datasources.Bucket{
+			Values: values,
+			Count:  remaining,
+		})
+	}
+
+	return buckets
+}
+
+func bucketKey(b *elastic.AggregationBucketKeyItem) string {
+	if b.KeyAsString != nil {
+		return *b.KeyAsString
+	} else if b.KeyNumber != "" {
+		return b.KeyNumber.String()
+	}
+
+	return fmt.Sprintf("%v", b.Key)
+}
+
+// Histogram counts the items per interval of the date field using a date
+// histogram aggregation.
+func (i *Elasticsearch) Histogram(ctx context.Context, o datasources.HistogramOptions) ([]datasources.HistogramBucket, error) {
+	q, err := searchQuery(o.SearchOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	agg := elastic.NewDateHistogramAggregation().
+		Field(o.Field).
+		Interval(o.Interval.String()).
+		MinDocCount(1)
+
+	results, err := i.client.Search().
+		Index(i.Indices...).
+		Query(q).
+		Size(0).
+		Aggregation("histogram", agg).
+		Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := []datasources.HistogramBucket{}
+
+	histogram, ok := results.Aggregations.DateHistogram("histogram")
+	if !ok {
+		return buckets, nil
+	}
+
+	for _, b := range histogram.Buckets {
+		buckets = append(buckets, datasources.HistogramBucket{
+			// keys are milliseconds since the epoch
+			Time:  time.Unix(0, int64(b.Key)*int64(time.Millisecond)).UTC(),
+			Count: b.DocCount,
+		})
+	}
+
+	return buckets, nil
+}
@@ -0,0 +1,24 @@
+package es5
+
+import "testing"
+
+func TestLevelSize(t *testing.T) {
+	tests := []struct {
+		size, levels int
+		want         int
+	}{
+		{1000, 1, 1000},
+		{1000, 2, 31},
+		{1000, 3, 10},
+		{1000, 10, 1},
+		{10000, 2, 100},
+		{10000, 4, 10},
+		{1, 3, 1},
+	}
+
+	for _, tt := range tests {
+		if got := levelSize(tt.size, tt.levels); got != tt.want {
+			t.Errorf("levelSize(%d, %d) = %d, want %d", tt.size, tt.levels, got, tt.want)
+		}
+	}
+}
@@ -10,13 +10,15 @@ import (
 	cache "github.com/patrickmn/go-cache"
 
 	"net/url"
-	"path"
+	"sort"
+	"strings"
 
 	elastic "gopkg.in/olivere/elastic.v5"
 
 	"fmt"
 
 	"github.com/dutchcoders/marija/server/datasources"
+	"github.com/dutchcoders/marija/server/datasources/query"
 )
 
 // implement via
@@ -38,7 +40,11 @@ func (el *ElasticLogger) Printf(format string, args ...interface{}) {
 
 }
 func New(options ...func(datasources.Index) error) (datasources.Index, error) {
-	s := Elasticsearch{}
+	s := Elasticsearch{
+		Config: Config{
+			Highlight: datasources.DefaultHighlight,
+		},
+	}
 
 	for _, optionFn := range options {
 		optionFn(&s)
@@ -76,24 +82,31 @@ func (m *Elasticsearch) Type() string {
 type Config struct {
 	URL url.URL
 
-	Index string
+	// Indices are index names, wildcards or date math expressions.
+	Indices []string
 
 	Username string
 	Password string
 
 	ScriptFields []*elastic.ScriptField
+
+	Highlight datasources.Highlight
 }
 
 type Elasticsearch struct {
 	client *elastic.Client
 	cache  *cache.Cache
 
+	paused datasources.Paused
+
 	Config
 }
 
 func (m *Elasticsearch) UnmarshalTOML(p interface{}) error {
 	data, _ := p.(map[string]interface{})
 
+	m.Highlight = datasources.ParseHighlight(data)
+
 	if v, ok := data["scripted-fields"]; !ok {
 	} else if v, ok := v.(map[string]interface{}); !ok {
 	} else {
@@ -124,7 +137,7 @@ func (m *Elasticsearch) UnmarshalTOML(p interface{}) error {
 	} else if u, err := url.Parse(v); err != nil {
 		return err
 	} else {
-		m.Index = path.Base(u.Path)
+		m.Indices = datasources.ElasticIndices(data, u)
 
 		u.Path = ""
 		m.URL = *u
@@ -133,7 +146,42 @@ func (m *Elasticsearch) UnmarshalTOML(p interface{}) error {
 	return nil
 }
 
+// searchQuery returns the query for the search options, the advanced queries
+// filter the results of the query.
+func searchQuery(so datasources.SearchOptions) (*elastic.BoolQuery, error) {
+	var main elastic.Query = elastic.NewQueryStringQuery(so.Query).
+		DefaultField("*").
+		AllFields(true)
+
+	if so.Expr != nil {
+		main = rawQuery(query.Elastic(so.Expr))
+	}
+
+	q := elastic.NewBoolQuery().Must(main)
+
+	if len(so.AdvancedQueries) > 0 {
+		aq, err := datasources.ElasticAdvancedQueries(so.AdvancedQueries)
+		if err != nil {
+			return nil, err
+		}
+
+		q = q.Filter(rawQuery(aq))
+	}
+
+	return q, nil
+}
+
 func (i *Elasticsearch) Search(ctx context.Context, so datasources.SearchOptions) datasources.SearchResponse {
+	return i.search(ctx, so, nil)
+}
+
+// Sample returns the results in random order, the order is the same for
+// every search with the same seed.
+func (i *Elasticsearch) Sample(ctx context.Context, so datasources.SearchOptions, seed int64) datasources.SearchResponse {
+	return i.search(ctx, so, &seed)
+}
+
+func (i *Elasticsearch) search(ctx context.Context, so datasources.SearchOptions, seed *int64) datasources.SearchResponse {
 	itemCh := make(chan datasources.Item)
 	errorCh := make(chan error)
 
@@ -141,95 +189,125 @@ func (i *Elasticsearch) Search(ctx context.Context, so datasources.SearchOptions
 		defer close(itemCh)
 		defer close(errorCh)
 
-		/*
-			hl := elastic.NewHighlight()
-			hl = hl.Fields(elastic.NewHighlighterField("*").RequireFieldMatch(false).NumOfFragments(0))
-			hl = hl.PreTags("<em>").PostTags("</em>")
-		*/
-
-		q := elastic.NewBoolQuery().Must(
-			elastic.NewQueryStringQuery(so.Query).
-				DefaultField("*").
-				AllFields(true),
-		)
-
-		// .Filter(filters ...elastic.Query)
-		if len(so.AdvancedQueries) > 0 {
-			aq := so.AdvancedQueries[0]
-			fmt.Println(aq.Field, aq.Value)
-			q = q.Must(elastic.NewRangeQuery(aq.Field).Gte(aq.Value).Lt(time.Now().Format(time.RFC3339)))
+		q, err := searchQuery(so)
+		if err != nil {
+			errorCh <- err
+			return
+		}
+
+		var main elastic.Query = q
+		if seed != nil {
+			main = elastic.NewFunctionScoreQuery().
+				Query(q).
+				AddScoreFunc(elastic.NewRandomFunction().Seed(*seed)).
+				BoostMode("replace")
+		}
+
+		size := 100
+		if so.Size > 0 && so.Size < size {
+			size = so.Size
 		}
 
 		src := elastic.NewSearchSource().
-			Query(q).
-			FetchSource(false).
-			/*Highlight(hl).*/
+			Query(main).
 			FetchSource(true).
-			From(so.From).
-			Size(100)
+			Size(size)
+
+		if i.Highlight.Enabled {
+			src = src.Highlight(i.highlight())
+		}
 
 		if len(i.ScriptFields) > 0 {
 			src = src.ScriptFields(i.ScriptFields...)
 		}
 
-		hits := make(chan *elastic.SearchHit)
+		var p *pager
 
-		go func() {
-			defer close(hits)
+		// a continued search resumes from the position it stopped at, when
+		// that is before the requested results
+		resumed := false
+		if so.Continuation == "" {
+		} else if v, ok := i.paused.Resume(so.Continuation); !ok {
+		} else if pp := v.(*pager); pp.from > so.From {
+			go pp.Close()
+		} else {
+			p, resumed = pp, true
+		}
 
-			scroll := i.client.Scroll().Index(i.Index).SearchSource(src)
-			for {
-				results, err := scroll.Do(ctx)
-				if err == io.EOF {
-					return
-				} else if err != nil {
-					errorCh <- err
-					return
-				}
+		if p == nil {
+			p = i.newPager(src)
+		}
 
-				log.Debug("Elasticsearch totalhits=%d", results.TotalHits())
+		paused := false
 
-				for _, hit := range results.Hits.Hits {
-					select {
-					case hits <- hit:
-					case <-ctx.Done():
-						log.Debug("Search canceled query=%s, index=%s", q, i.Index)
-						return
-					}
-				}
+		defer func() {
+			if !paused {
+				p.Close()
 			}
-
 		}()
 
-		for {
-			select {
-			case hit, ok := <-hits:
-				if !ok {
+		// from isn't allowed when scrolling, the first hits are skipped
+		n := so.From - p.from
+		count := 0
+
+		for so.Size == 0 || count < so.Size {
+			for n >= len(p.hits) {
+				n -= len(p.hits)
+
+				more, err := p.next(ctx)
+				if ctx.Err() != nil {
+					log.Debug("Search canceled query=%s, index=%s", so.Query, i.indices())
 					return
-				}
+				} else if err != nil && resumed {
+					// the scroll expired, the first hits are skipped
+					// instead
+					log.Debug("Error resuming search query=%s, index=%s: %s", so.Query, i.indices(), err.Error())
 
-				var fields map[string]interface{}
-				if err := json.Unmarshal(*hit.Source, &fields); err != nil {
-					errorCh <- err
+					resumed = false
+
+					p, n = i.newPager(src), so.From+count
 					continue
+				} else if err != nil {
+					errorCh <- err
+					return
+				} else if !more {
+					return
 				}
+			}
 
-				fields = flattenFields("", fields)
+			hit := p.hits[n]
 
-				/*
-					for key, val := range hit.Fields {
-						fields[key] = val
-					}
-				*/
+			n++
+			count++
 
-				itemCh <- datasources.Item{
-					ID:     hit.Id,
-					Fields: fields,
-				}
+			var fields map[string]interface{}
+			if err := json.Unmarshal(*hit.Source, &fields); err != nil {
+				errorCh <- err
+				continue
+			}
+
+			fields = flattenFields("", fields)
+
+			select {
+			case itemCh <- datasources.Item{
+				ID:        hit.Id,
+				Index:     hit.Index,
+				Fields:    fields,
+				Highlight: hit.Highlight,
+			}:
+			case <-ctx.Done():
+				return
 			}
 		}
 
-		return
+		// the search is continued from the last hit, which is the extra hit
+		// searched to know whether there are more results
+		if so.Continuation != "" {
+			p.from, p.hits = p.from+n-1, p.hits[n-1:]
+
+			i.paused.Pause(so.Continuation, p, time.Now().Add(pauseTimeout))
+			paused = true
+		}
 	}()
 
 	return datasources.NewSearchResponse(
@@ -238,6 +316,80 @@ func (i *Elasticsearch) Search(ctx context.Context, so datasources.SearchOptions
 	)
 }
 
+// pauseTimeout is the time a scroll is kept to continue the search, scrolls
+// are kept alive for 5 minutes by default.
+const pauseTimeout = 4 * time.Minute
+
+// pager scrolls through the results of a search.
+type pager struct {
+	scroll *elastic.ScrollService
+
+	// hits is the current page, from is the position of its first hit
+	// within the results
+	from int
+	hits []*elastic.SearchHit
+}
+
+func (i *Elasticsearch) newPager(src *elastic.SearchSource) *pager {
+	return &pager{
+		scroll: i.client.Scroll().Index(i.Indices...).SearchSource(src),
+	}
+}
+
+// next retrieves the next page, it returns false when there are no more
+// hits.
+func (p *pager) next(ctx context.Context) (bool, error) {
+	results, err := p.scroll.Do(ctx)
+	if err == io.EOF {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	log.Debug("Elasticsearch totalhits=%d", results.TotalHits())
+
+	p.from += len(p.hits)
+	p.hits = results.Hits.Hits
+
+	return len(p.hits) > 0, nil
+}
+
+// Close clears the scroll.
+func (p *pager) Close() error {
+	// the context of the search could have been canceled already
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := p.scroll.Clear(ctx)
+	if err != nil {
+		log.Errorf("Error clearing scroll: %s", err.Error())
+	}
+
+	return err
+}
+
+func (i *Elasticsearch) highlight() *elastic.Highlight {
+	fields := []*elastic.HighlighterField{}
+
+	for _, name := range i.Highlight.Fields {
+		field := elastic.NewHighlighterField(name)
+
+		if i.Highlight.FragmentSize > 0 {
+			field = field.FragmentSize(i.Highlight.FragmentSize)
+		} else {
+			field = field.NumOfFragments(0)
+		}
+
+		fields = append(fields, field)
+	}
+
+	return elastic.NewHighlight().
+		Fields(fields...).
+		RequireFieldMatch(false).
+		PreTags(i.Highlight.PreTags...).
+		PostTags(i.Highlight.PostTags...)
+}
+
 func flattenFields(root string, m map[string]interface{}) map[string]interface{} {
 	fields := map[string]interface{}{}
 
@@ -310,17 +462,45 @@ func unique(fields []datasources.Field) []datasources.Field {
 	return newFields
 }
 
+func (i *Elasticsearch) indices() string {
+	return strings.Join(i.Indices, ",")
+}
+
+// Ping checks whether the indices exist, patterns need to match at least one
+// index.
+func (i *Elasticsearch) Ping(ctx context.Context) error {
+	exists, err := i.client.IndexExists(i.Indices...).Do(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return fmt.Errorf("Index does not exist: %s", i.indices())
+	}
+
+	return nil
+}
+
 func (i *Elasticsearch) GetFields(ctx context.Context) (fields []datasources.Field, err error) {
 	mappings, err := i.client.GetMapping().
-		Index(i.Index).
+		Index(i.Indices...).
 		Do(ctx)
 
 	if err != nil {
-		return nil, fmt.Errorf("Error retrieving fields for index: %s: %s", i.Index, err.Error())
+		return nil, fmt.Errorf("Error retrieving fields for index: %s: %s", i.indices(), err.Error())
 	}
 
-	for i, _ := range mappings {
-		mapping := mappings[i].(map[string]interface{})
+	// the mappings of all matched indices are merged, in order of index name
+	// so conflicting field types resolve the same way every time
+	names := []string{}
+	for name := range mappings {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		mapping := mappings[name].(map[string]interface{})
 		mapping = mapping["mappings"].(map[string]interface{})
 		for _, v := range mapping {
 			fields = append(fields, flatten("", v.(map[string]interface{}))...)
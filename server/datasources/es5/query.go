@@ -0,0 +1,24 @@
+package es5
+
+import (
+	"encoding/json"
+
+	"github.com/dutchcoders/marija/server/datasources/query"
+)
+
+// rawQuery is a query in the query dsl.
+type rawQuery map[string]interface{}
+
+func (q rawQuery) Source() (interface{}, error) {
+	return map[string]interface{}(q), nil
+}
+
+// Translate returns the query dsl for the query tree.
+func (i *Elasticsearch) Translate(n query.Node) string {
+	data, err := json.Marshal(query.Elastic(n))
+	if err != nil {
+		return ""
+	}
+
+	return string(data)
+}
@@ -0,0 +1,202 @@
+package es7
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/dutchcoders/marija/server/datasources"
+)
+
+// compositePage is the number of buckets requested per page of the composite
+// aggregation.
+const compositePage = 1000
+
+type compositeResponse struct {
+	Aggregations struct {
+		Values struct {
+			AfterKey map[string]json.RawMessage `json:"after_key"`
+			Buckets  []struct {
+				Key      map[string]json.RawMessage `json:"key"`
+				DocCount int64                      `json:"doc_count"`
+			} `json:"buckets"`
+		} `json:"values"`
+	} `json:"aggregations"`
+}
+
+// Aggregate counts the combinations of the values of the fields using a
+// composite aggregation, paging through the buckets until so.Size buckets
+// have been returned. Buckets are ordered by the values.
+func (i *Elasticsearch) Aggregate(ctx context.Context, so datasources.SearchOptions) ([]datasources.Bucket, error) {
+	if len(so.Fields) == 0 {
+		return nil, errors.New("No fields set")
+	}
+
+	size := datasources.BucketSize(so.Size)
+
+	q, err := searchQuery(so)
+	if err != nil {
+		return nil, err
+	}
+
+	// sources are named by position, as field names can contain characters
+	// that aren't allowed in names
+	sources := []interface{}{}
+	for n, field := range so.Fields {
+		sources = append(sources, map[string]interface{}{
+			strconv.Itoa(n): map[string]interface{}{
+				"terms": map[string]interface{}{
+					"field":          field,
+					"missing_bucket": true,
+				},
+			},
+		})
+	}
+
+	buckets := []datasources.Bucket{}
+
+	var after map[string]json.RawMessage
+
+	for len(buckets) < size {
+		composite := map[string]interface{}{
+			"sources": sources,
+			"size":    compositePage,
+		}
+
+		if size-len(buckets) < compositePage {
+			composite["size"] = size - len(buckets)
+		}
+
+		if after != nil {
+			composite["after"] = after
+		}
+
+		body := map[string]interface{}{
+			"query": q,
+			"size":  0,
+			"aggs": map[string]interface{}{
+				"values": map[string]interface{}{
+					"composite": composite,
+				},
+			},
+		}
+
+		response := compositeResponse{}
+		if err := i.client.Do(ctx, "POST", i.indexPath("/_search"), body, &response); err != nil {
+			return nil, err
+		}
+
+		for _, b := range response.Aggregations.Values.Buckets {
+			values := map[string]string{}
+
+			for n, field := range so.Fields {
+				if v, ok := keyValue(b.Key[strconv.Itoa(n)]); ok {
+					values[field] = v
+				}
+			}
+
+			if len(values) == 0 {
+				continue
+			}
+
+			buckets = append(buckets, datasources.Bucket{
+				Values: values,
+				Count:  b.DocCount,
+			})
+		}
+
+		after = response.Aggregations.Values.AfterKey
+
+		if after == nil || len(response.Aggregations.Values.Buckets) == 0 {
+			break
+		}
+	}
+
+	return buckets, nil
+}
+
+// keyValue returns the string representation of a key of a composite bucket,
+// keys of missing values are null.
+func keyValue(raw json.RawMessage) (string, bool) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", false
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, true
+	}
+
+	return string(raw), true
+}
+
+type histogramResponse struct {
+	Aggregations struct {
+		Histogram struct {
+			Buckets []struct {
+				Key      int64 `json:"key"`
+				DocCount int64 `json:"doc_count"`
+			} `json:"buckets"`
+		} `json:"histogram"`
+	} `json:"aggregations"`
+}
+
+// Histogram counts the items per interval of the date field using a date
+// histogram aggregation.
+func (i *Elasticsearch) Histogram(ctx context.Context, o datasources.HistogramOptions) ([]datasources.HistogramBucket, error) {
+	q, err := searchQuery(o.SearchOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := i.serverVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	histogram := map[string]interface{}{
+		"field":         o.Field,
+		"min_doc_count": 1,
+	}
+
+	if !version.OpenSearch() && !version.AtLeast(7, 2) {
+		histogram["interval"] = o.Interval.String()
+	} else if o.Interval.Unit != "w" {
+		histogram["fixed_interval"] = o.Interval.String()
+	} else if o.Interval.Value == 1 {
+		// fixed intervals don't support weeks, calendar weeks start on monday
+		histogram["calendar_interval"] = "1w"
+	} else {
+		histogram["fixed_interval"] = fmt.Sprintf("%dd", o.Interval.Value*7)
+	}
+
+	body := map[string]interface{}{
+		"query": q,
+		"size":  0,
+		"aggs": map[string]interface{}{
+			"histogram": map[string]interface{}{
+				"date_histogram": histogram,
+			},
+		},
+	}
+
+	response := histogramResponse{}
+	if err := i.client.Do(ctx, "POST", i.indexPath("/_search"), body, &response); err != nil {
+		return nil, err
+	}
+
+	buckets := []datasources.HistogramBucket{}
+
+	for _, b := range response.Aggregations.Histogram.Buckets {
+		buckets = append(buckets, datasources.HistogramBucket{
+			// keys are milliseconds since the epoch
+			Time:  time.Unix(0, b.Key*int64(time.Millisecond)).UTC(),
+			Count: b.DocCount,
+		})
+	}
+
+	return buckets, nil
+}
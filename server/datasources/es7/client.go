@@ -0,0 +1,214 @@
+package es7
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Client is a minimal client for the rest api of Elasticsearch and
+// OpenSearch.
+type Client struct {
+	*http.Client
+
+	URL *url.URL
+
+	Username string
+	Password string
+
+	// APIKey is the base64 encoded id:key of an api key.
+	APIKey string
+}
+
+// Error is an error returned by the server.
+type Error struct {
+	StatusCode int
+	Type       string
+	Reason     string
+}
+
+func (e *Error) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+
+	return fmt.Sprintf("%s: %s", e.Type, e.Reason)
+}
+
+// EncodeAPIKey encodes api keys given as id:key.
+func EncodeAPIKey(key string) string {
+	if !strings.Contains(key, ":") {
+		return key
+	}
+
+	return base64.StdEncoding.EncodeToString([]byte(key))
+}
+
+// Do sends the request with body encoded as json and decodes the response
+// into v.
+func (c *Client) Do(ctx context.Context, method, path string, body interface{}, v interface{}) error {
+	rel, err := url.Parse(path)
+	if err != nil {
+		return err
+	}
+
+	u := c.URL.ResolveReference(rel)
+
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+
+		r = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, u.String(), r)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+c.APIKey)
+	} else if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		e := struct {
+			Error json.RawMessage `json:"error"`
+		}{}
+
+		json.NewDecoder(resp.Body).Decode(&e)
+
+		// errors are either an object or a string
+		reason := struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		}{}
+
+		if err := json.Unmarshal(e.Error, &reason); err != nil {
+			json.Unmarshal(e.Error, &reason.Reason)
+		}
+
+		return &Error{
+			StatusCode: resp.StatusCode,
+			Type:       reason.Type,
+			Reason:     reason.Reason,
+		}
+	}
+
+	if v == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// Version is the version of the cluster.
+type Version struct {
+	Number       string `json:"number"`
+	Distribution string `json:"distribution"`
+}
+
+// OpenSearch returns true when the cluster runs OpenSearch.
+func (v Version) OpenSearch() bool {
+	return v.Distribution == "opensearch"
+}
+
+// AtLeast returns true when the version is at least major.minor.
+func (v Version) AtLeast(major, minor int) bool {
+	parts := strings.SplitN(v.Number, ".", 3)
+	if len(parts) < 2 {
+		return false
+	}
+
+	maj, _ := strconv.Atoi(parts[0])
+	min, _ := strconv.Atoi(parts[1])
+
+	return maj > major || (maj == major && min >= minor)
+}
+
+// Info returns the version of the cluster.
+func (c *Client) Info(ctx context.Context) (*Version, error) {
+	info := struct {
+		Version Version `json:"version"`
+	}{}
+
+	if err := c.Do(ctx, "GET", "/", nil, &info); err != nil {
+		return nil, err
+	}
+
+	return &info.Version, nil
+}
+
+// Total is the total number of hits, which is a number before Elasticsearch 7
+// and an object since.
+type Total struct {
+	Value    int64  `json:"value"`
+	Relation string `json:"relation"`
+}
+
+func (t *Total) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '{' {
+		v := struct {
+			Value    int64  `json:"value"`
+			Relation string `json:"relation"`
+		}{}
+
+		if err := json.Unmarshal(data, &v); err != nil {
+			return err
+		}
+
+		t.Value, t.Relation = v.Value, v.Relation
+		return nil
+	}
+
+	t.Relation = "eq"
+	return json.Unmarshal(data, &t.Value)
+}
+
+type Hit struct {
+	Index     string                 `json:"_index"`
+	ID        string                 `json:"_id"`
+	Source    map[string]interface{} `json:"_source"`
+	Fields    map[string]interface{} `json:"fields"`
+	Highlight map[string][]string    `json:"highlight"`
+	Sort      []interface{}          `json:"sort"`
+}
+
+type SearchResponse struct {
+	ScrollID string `json:"_scroll_id"`
+	PitID    string `json:"pit_id"`
+
+	Hits struct {
+		Total *Total `json:"total"`
+		Hits  []Hit  `json:"hits"`
+	} `json:"hits"`
+}
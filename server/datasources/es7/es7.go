@@ -0,0 +1,531 @@
+package es7
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	logging "github.com/op/go-logging"
+
+	"github.com/dutchcoders/marija/server/datasources"
+	"github.com/dutchcoders/marija/server/datasources/query"
+)
+
+var (
+	_ = datasources.Register("elasticsearch6", newFlavour("elasticsearch6"))
+	_ = datasources.Register("elasticsearch7", newFlavour("elasticsearch7"))
+	_ = datasources.Register("elasticsearch8", newFlavour("elasticsearch8"))
+	_ = datasources.Register("opensearch", newFlavour("opensearch"))
+)
+
+var log = logging.MustGetLogger("marija/datasources/es7")
+
+const (
+	batchSize = 100
+
+	// keepAlive keeps points in time and scrolls open between pages, and
+	// between continuations of a search for up to pauseTimeout.
+	keepAlive    = "5m"
+	pauseTimeout = 4 * time.Minute
+)
+
+func newFlavour(flavour string) func(options ...func(datasources.Index) error) (datasources.Index, error) {
+	return func(options ...func(datasources.Index) error) (datasources.Index, error) {
+		return New(append([]func(datasources.Index) error{
+			func(i datasources.Index) error {
+				i.(*Elasticsearch).flavour = flavour
+				return nil
+			},
+		}, options...)...)
+	}
+}
+
+func New(options ...func(datasources.Index) error) (datasources.Index, error) {
+	s := Elasticsearch{
+		Config: Config{
+			Highlight: datasources.DefaultHighlight,
+		},
+		flavour: "elasticsearch7",
+	}
+
+	for _, optionFn := range options {
+		optionFn(&s)
+	}
+
+	s.client = &Client{
+		Client: &http.Client{},
+		URL:    &s.URL,
+
+		Username: s.Username,
+		Password: s.Password,
+		APIKey:   s.APIKey,
+	}
+
+	return &s, nil
+}
+
+type Config struct {
+	URL url.URL
+
+	// Indices are index names, wildcards or date math expressions.
+	Indices []string
+
+	Username string
+	Password string
+
+	APIKey string
+
+	Highlight datasources.Highlight
+}
+
+// Elasticsearch is a datasource for Elasticsearch 6, 7 and 8 and OpenSearch,
+// it talks to the rest api directly.
+type Elasticsearch struct {
+	Config
+
+	flavour string
+	client  *Client
+
+	m       sync.Mutex
+	version *Version
+
+	paused datasources.Paused
+}
+
+func (m *Elasticsearch) Type() string {
+	return m.flavour
+}
+
+func (m *Elasticsearch) UnmarshalTOML(p interface{}) error {
+	data, _ := p.(map[string]interface{})
+
+	m.Highlight = datasources.ParseHighlight(data)
+
+	if v, ok := data["username"]; !ok {
+	} else if v, ok := v.(string); !ok {
+	} else {
+		m.Username = v
+	}
+
+	if v, ok := data["password"]; !ok {
+	} else if v, ok := v.(string); !ok {
+	} else {
+		m.Password = v
+	}
+
+	if v, ok := data["api-key"]; !ok {
+	} else if v, ok := v.(string); !ok {
+	} else {
+		m.APIKey = EncodeAPIKey(v)
+	}
+
+	if v, ok := data["url"]; !ok {
+	} else if v, ok := v.(string); !ok {
+	} else if u, err := url.Parse(v); err != nil {
+		return err
+	} else {
+		m.Indices = datasources.ElasticIndices(data, u)
+
+		u.Path = ""
+		m.URL = *u
+	}
+
+	return nil
+}
+
+// Translate returns the query dsl for the query tree.
+func (i *Elasticsearch) Translate(n query.Node) string {
+	return jsonString(query.Elastic(n))
+}
+
+// serverVersion retrieves the version of the cluster once it has been
+// retrieved successfully.
+func (i *Elasticsearch) serverVersion(ctx context.Context) (*Version, error) {
+	i.m.Lock()
+	defer i.m.Unlock()
+
+	if i.version != nil {
+		return i.version, nil
+	}
+
+	version, err := i.client.Info(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	i.version = version
+	return version, nil
+}
+
+func (i *Elasticsearch) indices() string {
+	return strings.Join(i.Indices, ",")
+}
+
+// indexPath returns the path for the indices, the indices are escaped as date
+// math expressions contain slashes.
+func (i *Elasticsearch) indexPath(p string) string {
+	indices := make([]string, len(i.Indices))
+	for n, index := range i.Indices {
+		indices[n] = url.PathEscape(index)
+	}
+
+	return "/" + strings.Join(indices, ",") + p
+}
+
+// searchQuery returns the query for the search options, the advanced queries
+// filter the results of the query.
+func searchQuery(so datasources.SearchOptions) (map[string]interface{}, error) {
+	var main interface{} = map[string]interface{}{
+		"query_string": map[string]interface{}{
+			"query":         so.Query,
+			"default_field": "*",
+		},
+	}
+
+	if so.Expr != nil {
+		main = query.Elastic(so.Expr)
+	}
+
+	b := map[string]interface{}{
+		"must": []interface{}{main},
+	}
+
+	if len(so.AdvancedQueries) > 0 {
+		aq, err := datasources.ElasticAdvancedQueries(so.AdvancedQueries)
+		if err != nil {
+			return nil, err
+		}
+
+		b["filter"] = []interface{}{aq}
+	}
+
+	return map[string]interface{}{
+		"bool": b,
+	}, nil
+}
+
+func (i *Elasticsearch) Search(ctx context.Context, so datasources.SearchOptions) datasources.SearchResponse {
+	return i.search(ctx, so, nil)
+}
+
+// Sample returns the results in random order, the order is the same for
+// every search with the same seed.
+func (i *Elasticsearch) Sample(ctx context.Context, so datasources.SearchOptions, seed int64) datasources.SearchResponse {
+	return i.search(ctx, so, &seed)
+}
+
+func (i *Elasticsearch) search(ctx context.Context, so datasources.SearchOptions, seed *int64) datasources.SearchResponse {
+	itemCh := make(chan datasources.Item)
+	errorCh := make(chan error)
+
+	go func() {
+		defer close(itemCh)
+		defer close(errorCh)
+
+		q, err := searchQuery(so)
+		if err != nil {
+			errorCh <- err
+			return
+		}
+
+		size := batchSize
+		if so.Size > 0 && so.Size < size {
+			size = so.Size
+		}
+
+		body := map[string]interface{}{
+			"query":   q,
+			"_source": true,
+			"size":    size,
+		}
+
+		if seed != nil {
+			body["query"] = map[string]interface{}{
+				"function_score": map[string]interface{}{
+					"query": q,
+					"random_score": map[string]interface{}{
+						"seed":  *seed,
+						"field": "_seq_no",
+					},
+					"boost_mode": "replace",
+				},
+			}
+
+			body["sort"] = []interface{}{
+				map[string]interface{}{"_score": "desc"},
+			}
+		}
+
+		if i.Highlight.Enabled {
+			body["highlight"] = datasources.ElasticHighlight(i.Highlight)
+		}
+
+		var p *pager
+
+		// a continued search resumes from the position it stopped at, when
+		// that is before the requested results
+		resumed := false
+		if so.Continuation == "" {
+		} else if v, ok := i.paused.Resume(so.Continuation); !ok {
+		} else if pp := v.(*pager); pp.from > so.From {
+			go pp.Close()
+		} else {
+			p, resumed = pp, true
+		}
+
+		if p == nil {
+			if p, err = i.newPager(ctx, body); ctx.Err() != nil {
+				return
+			} else if err != nil {
+				errorCh <- err
+				return
+			}
+		}
+
+		paused := false
+
+		defer func() {
+			if !paused {
+				p.Close()
+			}
+		}()
+
+		// from isn't allowed when paging, the first hits are skipped
+		n := so.From - p.from
+		count := 0
+
+		for so.Size == 0 || count < so.Size {
+			for n >= len(p.hits) {
+				n -= len(p.hits)
+
+				more, err := p.next(ctx)
+				if ctx.Err() != nil {
+					log.Debug("Search canceled query=%s, index=%s", so.Query, i.indices())
+					return
+				} else if err != nil && resumed {
+					// the position expired, the first hits are skipped
+					// instead
+					log.Debug("Error resuming search query=%s, index=%s: %s", so.Query, i.indices(), err.Error())
+
+					resumed = false
+
+					var np *pager
+					if np, err = i.newPager(ctx, body); err == nil {
+						p, n = np, so.From+count
+						continue
+					}
+				}
+
+				if err != nil {
+					errorCh <- err
+					return
+				} else if !more {
+					return
+				}
+			}
+
+			hit := p.hits[n]
+
+			n++
+			count++
+
+			fields := flattenFields("", hit.Source)
+
+			select {
+			case itemCh <- datasources.Item{
+				ID:        hit.ID,
+				Index:     hit.Index,
+				Fields:    fields,
+				Highlight: hit.Highlight,
+			}:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		// the search is continued from the last hit, which is the extra hit
+		// searched to know whether there are more results
+		if so.Continuation != "" {
+			p.from, p.hits = p.from+n-1, p.hits[n-1:]
+
+			i.paused.Pause(so.Continuation, p, time.Now().Add(pauseTimeout))
+			paused = true
+		}
+	}()
+
+	return datasources.NewSearchResponse(
+		itemCh,
+		errorCh,
+	)
+}
+
+// pager pages through the results of a search using a point in time, or a
+// scroll before Elasticsearch 7.10 and on OpenSearch.
+type pager struct {
+	i    *Elasticsearch
+	body map[string]interface{}
+
+	// id is the id of the point in time or of the scroll
+	pit bool
+	id  string
+
+	// hits is the current page, from is the position of its first hit
+	// within the results
+	from int
+	hits []Hit
+}
+
+func (i *Elasticsearch) newPager(ctx context.Context, body map[string]interface{}) (*pager, error) {
+	version, err := i.serverVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &pager{
+		i:    i,
+		body: body,
+
+		// point in time searches replace scrolling since 7.10, opensearch
+		// implements them differently and keeps scrolling
+		pit: !version.OpenSearch() && version.AtLeast(7, 10),
+	}
+
+	if !p.pit {
+		return p, nil
+	}
+
+	pit := struct {
+		ID string `json:"id"`
+	}{}
+
+	if err := i.client.Do(ctx, "POST", i.indexPath("/_pit?keep_alive="+keepAlive), nil, &pit); err != nil {
+		return nil, err
+	}
+
+	p.id = pit.ID
+
+	// search after needs a unique sort, the shard doc breaks ties
+	order, _ := body["sort"].([]interface{})
+	body["sort"] = append(order, map[string]interface{}{"_shard_doc": "asc"})
+
+	return p, nil
+}
+
+// next retrieves the next page, it returns false when there are no more
+// hits.
+func (p *pager) next(ctx context.Context) (bool, error) {
+	response := SearchResponse{}
+
+	if p.pit {
+		p.body["pit"] = map[string]interface{}{
+			"id":         p.id,
+			"keep_alive": keepAlive,
+		}
+
+		if len(p.hits) > 0 {
+			p.body["search_after"] = p.hits[len(p.hits)-1].Sort
+		}
+
+		if err := p.i.client.Do(ctx, "POST", "/_search", p.body, &response); err != nil {
+			return false, err
+		}
+
+		if response.PitID != "" {
+			p.id = response.PitID
+		}
+	} else if p.id == "" {
+		if err := p.i.client.Do(ctx, "POST", p.i.indexPath("/_search?scroll="+keepAlive), p.body, &response); err != nil {
+			return false, err
+		}
+	} else {
+		if err := p.i.client.Do(ctx, "POST", "/_search/scroll", map[string]interface{}{
+			"scroll":    keepAlive,
+			"scroll_id": p.id,
+		}, &response); err != nil {
+			return false, err
+		}
+	}
+
+	if !p.pit && response.ScrollID != "" {
+		p.id = response.ScrollID
+	}
+
+	if response.Hits.Total != nil {
+		log.Debug("Elasticsearch totalhits=%d", response.Hits.Total.Value)
+	}
+
+	p.from += len(p.hits)
+	p.hits = response.Hits.Hits
+
+	return len(p.hits) > 0, nil
+}
+
+// Close closes the point in time or clears the scroll.
+func (p *pager) Close() error {
+	if p.id == "" {
+		return nil
+	}
+
+	// the context of the search could have been canceled already
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var err error
+	if p.pit {
+		err = p.i.client.Do(ctx, "DELETE", "/_pit", map[string]interface{}{
+			"id": p.id,
+		}, nil)
+	} else {
+		err = p.i.client.Do(ctx, "DELETE", "/_search/scroll", map[string]interface{}{
+			"scroll_id": []string{p.id},
+		}, nil)
+	}
+
+	if err != nil {
+		log.Errorf("Error closing search: %s", err.Error())
+	}
+
+	return err
+}
+
+// Ping checks whether the indices exist, patterns need to match at least one
+// index.
+func (i *Elasticsearch) Ping(ctx context.Context) error {
+	err := i.client.Do(ctx, "HEAD", i.indexPath(""), nil, nil)
+	if e, ok := err.(*Error); ok && e.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("Index does not exist: %s", i.indices())
+	}
+
+	return err
+}
+
+func (i *Elasticsearch) GetFields(ctx context.Context) (fields []datasources.Field, err error) {
+	mappings := map[string]struct {
+		Mappings map[string]interface{} `json:"mappings"`
+	}{}
+
+	if err := i.client.Do(ctx, "GET", i.indexPath("/_mapping"), nil, &mappings); err != nil {
+		return nil, fmt.Errorf("Error retrieving fields for index: %s: %s", i.indices(), err.Error())
+	}
+
+	// the mappings of all matched indices are merged, in order of index name
+	// so conflicting field types resolve the same way every time
+	names := []string{}
+	for name := range mappings {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		fields = append(fields, mappingFields(mappings[name].Mappings)...)
+	}
+
+	fields = unique(fields)
+	return
+}
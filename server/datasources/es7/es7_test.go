@@ -0,0 +1,646 @@
+package es7
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dutchcoders/marija/server/datasources"
+)
+
+// exchange is a recorded response of the cluster.
+type exchange struct {
+	request  string
+	status   int
+	response string
+}
+
+// stub replays the recorded responses in order of the requests, recording
+// the bodies of the requests.
+type stub struct {
+	t *testing.T
+
+	m         sync.Mutex
+	exchanges map[string][]exchange
+	bodies    map[string][]map[string]interface{}
+}
+
+func newStub(t *testing.T, exchanges ...exchange) (*stub, *httptest.Server) {
+	s := &stub{
+		t:         t,
+		exchanges: map[string][]exchange{},
+		bodies:    map[string][]map[string]interface{}{},
+	}
+
+	for _, e := range exchanges {
+		s.exchanges[e.request] = append(s.exchanges[e.request], e)
+	}
+
+	return s, httptest.NewServer(s)
+}
+
+func (s *stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	request := r.Method + " " + r.URL.RequestURI()
+
+	body := map[string]interface{}{}
+	if data, _ := ioutil.ReadAll(r.Body); len(data) > 0 {
+		if err := json.Unmarshal(data, &body); err != nil {
+			s.t.Errorf("%s: %s", request, err.Error())
+		}
+	}
+
+	s.bodies[request] = append(s.bodies[request], body)
+
+	exchanges := s.exchanges[request]
+	if len(exchanges) == 0 {
+		s.t.Errorf("Unexpected request: %s", request)
+		http.Error(w, "", http.StatusNotImplemented)
+		return
+	}
+
+	e := exchanges[0]
+
+	// the last response is repeated
+	if len(exchanges) > 1 {
+		s.exchanges[request] = exchanges[1:]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if e.status != 0 {
+		w.WriteHeader(e.status)
+	}
+
+	w.Write([]byte(e.response))
+}
+
+// requests returns the bodies of the requests received for request.
+func (s *stub) requests(request string) []map[string]interface{} {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.bodies[request]
+}
+
+func newIndex(t *testing.T, ts *httptest.Server, flavour string) *Elasticsearch {
+	index, err := newFlavour(flavour)(func(i datasources.Index) error {
+		return i.(*Elasticsearch).UnmarshalTOML(map[string]interface{}{
+			"url": ts.URL + "/logs-*",
+		})
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return index.(*Elasticsearch)
+}
+
+// collect returns the items and the error of the search response.
+func collect(t *testing.T, resp datasources.SearchResponse) ([]datasources.Item, error) {
+	items := []datasources.Item{}
+
+	var err error
+
+	itemCh, errorCh := resp.Item(), resp.Error()
+
+	timeout := time.After(5 * time.Second)
+
+	for itemCh != nil || errorCh != nil {
+		select {
+		case item, ok := <-itemCh:
+			if !ok {
+				itemCh = nil
+				continue
+			}
+
+			items = append(items, item)
+		case e, ok := <-errorCh:
+			if !ok {
+				errorCh = nil
+				continue
+			}
+
+			err = e
+		case <-timeout:
+			t.Fatal("Search did not finish")
+		}
+	}
+
+	return items, err
+}
+
+func ids(items []datasources.Item) []string {
+	result := []string{}
+	for _, item := range items {
+		result = append(result, item.ID)
+	}
+
+	return result
+}
+
+const (
+	version6 = `{"name":"node","version":{"number":"6.8.23"}}`
+	version7 = `{"name":"node","version":{"number":"7.17.9"}}`
+	version8 = `{"name":"node","version":{"number":"8.11.1"}}`
+
+	opensearch = `{"name":"node","version":{"distribution":"opensearch","number":"2.11.0"}}`
+)
+
+func TestSearchPointInTime(t *testing.T) {
+	s, ts := newStub(t,
+		exchange{"GET /", 0, version7},
+		exchange{"POST /logs-%2A/_pit?keep_alive=5m", 0, `{"id":"pit-1"}`},
+		exchange{"POST /_search", 0, `{
+			"pit_id": "pit-2",
+			"hits": {
+				"total": {"value": 3, "relation": "eq"},
+				"hits": [
+					{"_index": "logs-1", "_id": "1", "_source": {"user": {"name": "alice"}, "ip": "10.0.0.1"}, "sort": [1, 10]},
+					{"_index": "logs-1", "_id": "2", "_source": {"user": {"name": "bob"}}, "sort": [2, 11]}
+				]
+			}
+		}`},
+		exchange{"POST /_search", 0, `{
+			"pit_id": "pit-2",
+			"hits": {
+				"total": {"value": 3, "relation": "eq"},
+				"hits": [
+					{"_index": "logs-2", "_id": "3", "_source": {"user": {"name": "carol"}}, "highlight": {"user.name": ["<em>carol</em>"]}, "sort": [3, 12]}
+				]
+			}
+		}`},
+		exchange{"POST /_search", 0, `{"pit_id": "pit-2", "hits": {"total": {"value": 3, "relation": "eq"}, "hits": []}}`},
+		exchange{"DELETE /_pit", 0, `{"succeeded": true, "num_freed": 1}`},
+	)
+	defer ts.Close()
+
+	i := newIndex(t, ts, "elasticsearch7")
+
+	items, err := collect(t, i.Search(context.Background(), datasources.SearchOptions{
+		Query: "alice",
+	}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := ids(items); !reflect.DeepEqual(got, []string{"1", "2", "3"}) {
+		t.Fatalf("Expected items 1, 2 and 3, got %v", got)
+	}
+
+	if !reflect.DeepEqual(items[0].Fields, map[string]interface{}{"user.name": "alice", "ip": "10.0.0.1"}) {
+		t.Errorf("Expected flattened fields, got %v", items[0].Fields)
+	} else if items[0].Index != "logs-1" {
+		t.Errorf("Expected index logs-1, got %s", items[0].Index)
+	} else if !reflect.DeepEqual(items[2].Highlight, map[string][]string{"user.name": {"<em>carol</em>"}}) {
+		t.Errorf("Expected highlight, got %v", items[2].Highlight)
+	}
+
+	searches := s.requests("POST /_search")
+	if len(searches) != 3 {
+		t.Fatalf("Expected 3 searches, got %d", len(searches))
+	}
+
+	// the pit id of the previous response is used, paging using search after
+	if id := searches[1]["pit"].(map[string]interface{})["id"]; id != "pit-2" {
+		t.Errorf("Expected pit-2, got %v", id)
+	} else if _, ok := searches[0]["search_after"]; ok {
+		t.Errorf("Expected no search after for the first page")
+	} else if after := jsonString(searches[1]["search_after"]); after != "[2,11]" {
+		t.Errorf("Expected search after [2,11], got %s", after)
+	} else if q := jsonString(searches[0]["query"]); !strings.Contains(q, `"query":"alice"`) {
+		t.Errorf("Expected query string, got %s", q)
+	}
+
+	if closed := s.requests("DELETE /_pit"); len(closed) != 1 {
+		t.Fatalf("Expected point in time to be closed")
+	} else if closed[0]["id"] != "pit-2" {
+		t.Errorf("Expected pit-2 to be closed, got %v", closed[0]["id"])
+	}
+}
+
+func TestSearchScroll(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		flavour string
+		version string
+	}{
+		{"elasticsearch 6", "elasticsearch6", version6},
+		{"opensearch", "opensearch", opensearch},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s, ts := newStub(t,
+				exchange{"GET /", 0, tt.version},
+				exchange{"POST /logs-%2A/_search?scroll=5m", 0, `{
+					"_scroll_id": "scroll-1",
+					"hits": {
+						"total": 3,
+						"hits": [
+							{"_index": "logs-1", "_id": "1", "_source": {"user": "alice"}},
+							{"_index": "logs-1", "_id": "2", "_source": {"user": "bob"}}
+						]
+					}
+				}`},
+				exchange{"POST /_search/scroll", 0, `{
+					"_scroll_id": "scroll-2",
+					"hits": {"total": 3, "hits": [{"_index": "logs-1", "_id": "3", "_source": {"user": "carol"}}]}
+				}`},
+				exchange{"POST /_search/scroll", 0, `{"_scroll_id": "scroll-2", "hits": {"total": 3, "hits": []}}`},
+				exchange{"DELETE /_search/scroll", 0, `{"succeeded": true, "num_freed": 1}`},
+			)
+			defer ts.Close()
+
+			i := newIndex(t, ts, tt.flavour)
+
+			items, err := collect(t, i.Search(context.Background(), datasources.SearchOptions{
+				Query: "*",
+			}))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := ids(items); !reflect.DeepEqual(got, []string{"1", "2", "3"}) {
+				t.Fatalf("Expected items 1, 2 and 3, got %v", got)
+			}
+
+			scrolls := s.requests("POST /_search/scroll")
+			if len(scrolls) != 2 {
+				t.Fatalf("Expected 2 scrolls, got %d", len(scrolls))
+			} else if scrolls[1]["scroll_id"] != "scroll-2" {
+				t.Errorf("Expected scroll-2, got %v", scrolls[1]["scroll_id"])
+			}
+
+			if cleared := s.requests("DELETE /_search/scroll"); len(cleared) != 1 {
+				t.Fatalf("Expected scroll to be cleared")
+			}
+		})
+	}
+}
+
+func TestSearchSize(t *testing.T) {
+	s, ts := newStub(t,
+		exchange{"GET /", 0, version8},
+		exchange{"POST /logs-%2A/_pit?keep_alive=5m", 0, `{"id":"pit-1"}`},
+		exchange{"POST /_search", 0, `{
+			"hits": {
+				"hits": [
+					{"_id": "1", "_source": {}, "sort": [1]},
+					{"_id": "2", "_source": {}, "sort": [2]}
+				]
+			}
+		}`},
+		exchange{"DELETE /_pit", 0, `{}`},
+	)
+	defer ts.Close()
+
+	i := newIndex(t, ts, "elasticsearch8")
+
+	items, err := collect(t, i.Search(context.Background(), datasources.SearchOptions{
+		Query: "*",
+		Size:  2,
+	}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(items) != 2 {
+		t.Fatalf("Expected 2 items, got %d", len(items))
+	}
+
+	if searches := s.requests("POST /_search"); len(searches) != 1 {
+		t.Fatalf("Expected a single search, got %d", len(searches))
+	} else if size := searches[0]["size"]; size != float64(2) {
+		t.Errorf("Expected size 2, got %v", size)
+	}
+}
+
+func TestSearchContinue(t *testing.T) {
+	page := `{"pit_id": "pit-1", "hits": {"hits": [
+		{"_id": "1", "_source": {}, "sort": [1]},
+		{"_id": "2", "_source": {}, "sort": [2]},
+		{"_id": "3", "_source": {}, "sort": [3]}
+	]}}`
+
+	next := `{"pit_id": "pit-1", "hits": {"hits": [
+		{"_id": "4", "_source": {}, "sort": [4]},
+		{"_id": "5", "_source": {}, "sort": [5]}
+	]}}`
+
+	last := `{"pit_id": "pit-1", "hits": {"hits": []}}`
+
+	expired := `{"error": {"type": "search_context_missing_exception", "reason": "No search context found"}, "status": 404}`
+
+	for _, tt := range []struct {
+		name     string
+		searches []exchange
+		pits     int
+	}{
+		{"resumed", []exchange{
+			{"POST /_search", 0, page},
+			{"POST /_search", 0, next},
+			{"POST /_search", 0, last},
+		}, 1},
+		{"expired", []exchange{
+			{"POST /_search", 0, page},
+			{"POST /_search", http.StatusNotFound, expired},
+			{"POST /_search", 0, page},
+			{"POST /_search", 0, next},
+			{"POST /_search", 0, last},
+		}, 2},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s, ts := newStub(t, append([]exchange{
+				{"GET /", 0, version7},
+				{"POST /logs-%2A/_pit?keep_alive=5m", 0, `{"id":"pit-1"}`},
+				{"DELETE /_pit", 0, `{}`},
+			}, tt.searches...)...)
+			defer ts.Close()
+
+			i := newIndex(t, ts, "elasticsearch7")
+
+			// the server searches an extra result to know whether there
+			// are more results
+			items, err := collect(t, i.Search(context.Background(), datasources.SearchOptions{
+				Query:        "*",
+				Size:         3,
+				Continuation: "continuation",
+			}))
+
+			if err != nil {
+				t.Fatal(err)
+			} else if got := ids(items); !reflect.DeepEqual(got, []string{"1", "2", "3"}) {
+				t.Fatalf("Expected items 1, 2 and 3, got %v", got)
+			}
+
+			if closed := s.requests("DELETE /_pit"); len(closed) != 0 {
+				t.Fatal("Expected point in time to be kept")
+			}
+
+			items, err = collect(t, i.Search(context.Background(), datasources.SearchOptions{
+				Query:        "*",
+				From:         2,
+				Size:         3,
+				Continuation: "continuation",
+			}))
+
+			if err != nil {
+				t.Fatal(err)
+			} else if got := ids(items); !reflect.DeepEqual(got, []string{"3", "4", "5"}) {
+				t.Fatalf("Expected items 3, 4 and 5, got %v", got)
+			}
+
+			items, err = collect(t, i.Search(context.Background(), datasources.SearchOptions{
+				Query:        "*",
+				From:         4,
+				Size:         3,
+				Continuation: "continuation",
+			}))
+
+			if err != nil {
+				t.Fatal(err)
+			} else if got := ids(items); !reflect.DeepEqual(got, []string{"5"}) {
+				t.Fatalf("Expected item 5, got %v", got)
+			}
+
+			if n := len(s.requests("POST /logs-%2A/_pit?keep_alive=5m")); n != tt.pits {
+				t.Errorf("Expected %d points in time, got %d", tt.pits, n)
+			}
+
+			searches := s.requests("POST /_search")
+			if len(searches) != len(tt.searches) {
+				t.Fatalf("Expected %d searches, got %d", len(tt.searches), len(searches))
+			}
+
+			// the search continues after the last hit returned
+			if after := jsonString(searches[len(searches)-2]["search_after"]); after != "[3]" {
+				t.Errorf("Expected search after [3], got %s", after)
+			} else if after := jsonString(searches[len(searches)-1]["search_after"]); after != "[5]" {
+				t.Errorf("Expected search after [5], got %s", after)
+			}
+
+			if closed := s.requests("DELETE /_pit"); len(closed) != 1 {
+				t.Fatal("Expected point in time to be closed")
+			}
+		})
+	}
+}
+
+func TestSearchError(t *testing.T) {
+	_, ts := newStub(t,
+		exchange{"GET /", 0, version7},
+		exchange{"POST /logs-%2A/_pit?keep_alive=5m", http.StatusBadRequest, `{
+			"error": {"type": "parse_exception", "reason": "Failed to parse query"},
+			"status": 400
+		}`},
+	)
+	defer ts.Close()
+
+	i := newIndex(t, ts, "elasticsearch7")
+
+	_, err := collect(t, i.Search(context.Background(), datasources.SearchOptions{
+		Query: "a:",
+	}))
+
+	if err == nil {
+		t.Fatal("Expected error")
+	} else if err.Error() != "parse_exception: Failed to parse query" {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+}
+
+func TestPing(t *testing.T) {
+	_, ts := newStub(t,
+		exchange{"HEAD /logs-%2A", http.StatusNotFound, ``},
+	)
+	defer ts.Close()
+
+	i := newIndex(t, ts, "elasticsearch7")
+
+	if err := i.Ping(context.Background()); err == nil {
+		t.Fatal("Expected error")
+	} else if err.Error() != "Index does not exist: logs-*" {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+}
+
+func TestGetFields(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		response string
+	}{
+		{"typed", `{
+			"logs-1": {"mappings": {"doc": {"properties": {
+				"user": {"properties": {"name": {"type": "keyword"}}},
+				"ip": {"type": "ip"}
+			}}}},
+			"logs-2": {"mappings": {"doc": {"properties": {
+				"ip": {"type": "keyword"}
+			}}}}
+		}`},
+		{"typeless", `{
+			"logs-1": {"mappings": {"properties": {
+				"user": {"properties": {"name": {"type": "keyword"}}},
+				"ip": {"type": "ip"}
+			}}},
+			"logs-2": {"mappings": {"properties": {
+				"ip": {"type": "keyword"}
+			}}}
+		}`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, ts := newStub(t,
+				exchange{"GET /logs-%2A/_mapping", 0, tt.response},
+			)
+			defer ts.Close()
+
+			i := newIndex(t, ts, "elasticsearch7")
+
+			fields, err := i.GetFields(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sort.Slice(fields, func(a, b int) bool {
+				return fields[a].Path < fields[b].Path
+			})
+
+			// conflicting types resolve to the type of the first index
+			expected := []datasources.Field{
+				{Path: "ip", Type: "ip"},
+				{Path: "user.name", Type: "keyword"},
+			}
+
+			if !reflect.DeepEqual(fields, expected) {
+				t.Fatalf("Expected %v, got %v", expected, fields)
+			}
+		})
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	s, ts := newStub(t,
+		exchange{"POST /logs-%2A/_search", 0, `{
+			"aggregations": {"values": {
+				"after_key": {"0": "bob", "1": 2},
+				"buckets": [
+					{"key": {"0": "alice", "1": 1}, "doc_count": 10},
+					{"key": {"0": "bob", "1": null}, "doc_count": 5},
+					{"key": {"0": null, "1": null}, "doc_count": 3}
+				]
+			}}
+		}`},
+		exchange{"POST /logs-%2A/_search", 0, `{
+			"aggregations": {"values": {
+				"buckets": []
+			}}
+		}`},
+	)
+	defer ts.Close()
+
+	i := newIndex(t, ts, "elasticsearch7")
+
+	buckets, err := i.Aggregate(context.Background(), datasources.SearchOptions{
+		Query:  "*",
+		Fields: []string{"user", "port"},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// buckets without values are skipped
+	expected := []datasources.Bucket{
+		{Values: map[string]string{"user": "alice", "port": "1"}, Count: 10},
+		{Values: map[string]string{"user": "bob"}, Count: 5},
+	}
+
+	if !reflect.DeepEqual(buckets, expected) {
+		t.Fatalf("Expected %v, got %v", expected, buckets)
+	}
+
+	searches := s.requests("POST /logs-%2A/_search")
+	if len(searches) != 2 {
+		t.Fatalf("Expected 2 pages, got %d", len(searches))
+	}
+
+	composite := searches[1]["aggs"].(map[string]interface{})["values"].(map[string]interface{})["composite"].(map[string]interface{})
+	if after := jsonString(composite["after"]); after != `{"0":"bob","1":2}` {
+		t.Errorf("Expected after key of the first page, got %s", after)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	response := `{
+		"aggregations": {"histogram": {"buckets": [
+			{"key_as_string": "2020-01-01T00:00:00.000Z", "key": 1577836800000, "doc_count": 4}
+		]}}
+	}`
+
+	for _, tt := range []struct {
+		name     string
+		version  string
+		interval string
+		expected string
+	}{
+		{"interval", version6, "1h", `{"field":"@timestamp","interval":"1h","min_doc_count":1}`},
+		{"fixed interval", version7, "1h", `{"field":"@timestamp","fixed_interval":"1h","min_doc_count":1}`},
+		{"calendar week", version8, "1w", `{"calendar_interval":"1w","field":"@timestamp","min_doc_count":1}`},
+		{"weeks", opensearch, "2w", `{"field":"@timestamp","fixed_interval":"14d","min_doc_count":1}`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s, ts := newStub(t,
+				exchange{"GET /", 0, tt.version},
+				exchange{"POST /logs-%2A/_search", 0, response},
+			)
+			defer ts.Close()
+
+			i := newIndex(t, ts, "elasticsearch7")
+
+			interval, err := datasources.ParseInterval(tt.interval)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			buckets, err := i.Histogram(context.Background(), datasources.HistogramOptions{
+				SearchOptions: datasources.SearchOptions{
+					Query: "*",
+				},
+				Field:    "@timestamp",
+				Interval: interval,
+			})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expected := []datasources.HistogramBucket{
+				{Time: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), Count: 4},
+			}
+
+			if !reflect.DeepEqual(buckets, expected) {
+				t.Fatalf("Expected %v, got %v", expected, buckets)
+			}
+
+			body := s.requests("POST /logs-%2A/_search")[0]
+
+			histogram := body["aggs"].(map[string]interface{})["histogram"].(map[string]interface{})["date_histogram"]
+			if got := jsonString(histogram); got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package es7
+
+import (
+	"encoding/json"
+
+	"github.com/dutchcoders/marija/server/datasources"
+)
+
+func jsonString(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+
+	return string(data)
+}
+
+func flattenFields(root string, m map[string]interface{}) map[string]interface{} {
+	fields := map[string]interface{}{}
+
+	for k, v := range m {
+		key := k
+		if root != "" {
+			key = root + "." + key
+		}
+
+		switch s2 := v.(type) {
+		case map[string]interface{}:
+			for k2, v2 := range flattenFields(key, s2) {
+				fields[k2] = v2
+			}
+		default:
+			fields[key] = v
+		}
+	}
+
+	return fields
+}
+
+// mappingFields returns the fields of the mapping of an index. Since
+// Elasticsearch 7 mappings are typeless and contain the properties directly,
+// before they are keyed by the mapping type.
+func mappingFields(mapping map[string]interface{}) (fields []datasources.Field) {
+	if properties, ok := mapping["properties"].(map[string]interface{}); ok {
+		return flatten("", properties)
+	}
+
+	for _, v := range mapping {
+		typed, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		if properties, ok := typed["properties"].(map[string]interface{}); ok {
+			fields = append(fields, flatten("", properties)...)
+		}
+	}
+
+	return
+}
+
+// flatten returns the fields of the properties, objects are flattened using
+// dotted paths.
+func flatten(root string, properties map[string]interface{}) (fields []datasources.Field) {
+	for k, v := range properties {
+		property, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		key := k
+		if root != "" {
+			key = root + "." + key
+		}
+
+		if nested, ok := property["properties"].(map[string]interface{}); ok {
+			fields = append(fields, flatten(key, nested)...)
+		} else if t, ok := property["type"].(string); ok {
+			fields = append(fields, datasources.Field{
+				Path: key,
+				Type: t,
+			})
+		}
+	}
+
+	return
+}
+
+func unique(fields []datasources.Field) []datasources.Field {
+	newFields := []datasources.Field{}
+
+	seen := map[string]bool{}
+	for _, f := range fields {
+		if seen[f.Path] {
+			continue
+		}
+
+		seen[f.Path] = true
+		newFields = append(newFields, f)
+	}
+
+	return newFields
+}
@@ -0,0 +1,136 @@
+// Package file implements a datasource for a directory of static files, like
+// exports of other tools. CSV, TSV, JSON lines and GraphML files are read at
+// startup into an index kept in memory and searched using the Marija query
+// language.
+package file
+
+import (
+	"context"
+	"errors"
+
+	"github.com/op/go-logging"
+
+	"github.com/dutchcoders/marija/server/datasources"
+	"github.com/dutchcoders/marija/server/datasources/query"
+)
+
+var (
+	_ = datasources.Register("file", New)
+)
+
+var log = logging.MustGetLogger("marija/datasources/file")
+
+func New(options ...func(datasources.Index) error) (datasources.Index, error) {
+	f := File{}
+
+	for _, optionFn := range options {
+		optionFn(&f)
+	}
+
+	if f.Path == "" {
+		return nil, errors.New("No path set")
+	}
+
+	idx, err := load(f.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info("Indexed %d items of %s", len(idx.items), f.Path)
+
+	f.index = idx
+	return &f, nil
+}
+
+type File struct {
+	// Path is the directory containing the files, or a single file.
+	Path string
+
+	index *index
+}
+
+func (f *File) Type() string {
+	return "file"
+}
+
+func (f *File) UnmarshalTOML(p interface{}) error {
+	data, _ := p.(map[string]interface{})
+
+	if v, ok := data["path"]; !ok {
+	} else if v, ok := v.(string); !ok {
+	} else {
+		f.Path = v
+	}
+
+	return nil
+}
+
+// Translate returns the query for the query tree, the files are searched
+// using the Marija query language itself.
+func (f *File) Translate(n query.Node) string {
+	return query.Lucene(n)
+}
+
+func (f *File) Search(ctx context.Context, so datasources.SearchOptions) datasources.SearchResponse {
+	itemCh := make(chan datasources.Item)
+	errorCh := make(chan error)
+
+	go func() {
+		defer close(itemCh)
+		defer close(errorCh)
+
+		n, err := expr(so)
+		if err != nil {
+			// queries that can't be parsed are searched as phrase
+			n = query.Term{Value: so.Query, Phrase: true}
+		}
+
+		m, err := query.NewMatcher(n)
+		if err != nil {
+			errorCh <- err
+			return
+		}
+
+		skipped, sent := 0, 0
+
+		for _, i := range f.index.candidates(n) {
+			item := f.index.items[i]
+			if !m.Match(item.Fields) {
+				continue
+			}
+
+			if skipped < so.From {
+				skipped++
+				continue
+			}
+
+			select {
+			case itemCh <- item:
+			case <-ctx.Done():
+				return
+			}
+
+			sent++
+
+			if so.Size > 0 && sent >= so.Size {
+				return
+			}
+		}
+	}()
+
+	return datasources.NewSearchResponse(itemCh, errorCh)
+}
+
+// expr returns the query tree of the search, native queries are written in the
+// query language as well.
+func expr(so datasources.SearchOptions) (query.Node, error) {
+	if so.Expr != nil {
+		return so.Expr, nil
+	}
+
+	return query.Parse(so.Query)
+}
+
+func (f *File) GetFields(ctx context.Context) ([]datasources.Field, error) {
+	return f.index.fields, nil
+}
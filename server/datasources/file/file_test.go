@@ -0,0 +1,232 @@
+package file
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/dutchcoders/marija/server/datasources"
+)
+
+func newFile(t *testing.T) *File {
+	index, err := New(func(i datasources.Index) error {
+		i.(*File).Path = "testdata"
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return index.(*File)
+}
+
+func search(t *testing.T, f *File, so datasources.SearchOptions) []string {
+	response := f.Search(context.Background(), so)
+
+	ids := []string{}
+
+	itemCh, errorCh := response.Item(), response.Error()
+	for itemCh != nil || errorCh != nil {
+		select {
+		case item, ok := <-itemCh:
+			if !ok {
+				itemCh = nil
+				continue
+			}
+
+			ids = append(ids, item.ID)
+		case err, ok := <-errorCh:
+			if !ok {
+				errorCh = nil
+				continue
+			}
+
+			t.Fatal(err)
+		}
+	}
+
+	return ids
+}
+
+func TestSearch(t *testing.T) {
+	f := newFile(t)
+
+	tests := []struct {
+		query string
+		ids   []string
+	}{
+		{"*", []string{
+			"calls/calls.tsv:1", "calls/calls.tsv:2",
+			"events.jsonl:1", "events.jsonl:2",
+			"graph.graphml:n1", "graph.graphml:n2", "graph.graphml:e1", "graph.graphml:edge2",
+			"persons.csv:1", "persons.csv:2", "persons.csv:3",
+		}},
+		{"alice", []string{"events.jsonl:1", "graph.graphml:n1", "persons.csv:1"}},
+		{"ALICE", []string{"events.jsonl:1", "graph.graphml:n1", "persons.csv:1"}},
+		{"name:alice", []string{"persons.csv:1"}},
+		{"user.name:bob", []string{"events.jsonl:2"}},
+		{`"alice smith"`, []string{"graph.graphml:n1", "persons.csv:1"}},
+		{`"smith alice"`, []string{}},
+		{"name:(alice OR carol)", []string{"persons.csv:1", "persons.csv:3"}},
+		{"email:*@example.com", []string{"persons.csv:1", "persons.csv:2"}},
+		{"email:*", []string{"persons.csv:1", "persons.csv:2"}},
+		{"age:[30 TO 40]", []string{"persons.csv:1"}},
+		{"age:>40", []string{"persons.csv:2"}},
+		{"joined:>=2020-01-01", []string{"persons.csv:1"}},
+		{"caller:0612345678", []string{"calls/calls.tsv:1"}},
+		{"0687654321", []string{"calls/calls.tsv:1", "calls/calls.tsv:2"}},
+		{"success:true", []string{"events.jsonl:1"}},
+		{"tags:vpn AND -action:logout", []string{"events.jsonl:1"}},
+		{"kind:person", []string{"graph.graphml:n1"}},
+		{"kind:company OR type:works-at", []string{"graph.graphml:n2", "graph.graphml:e1"}},
+		{"nobody", []string{}},
+		{"alice AND nobody", []string{}},
+		// queries that can't be parsed are searched as phrase
+		{"Carol,", []string{"persons.csv:3"}},
+		{"(Carol", []string{"persons.csv:3"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if ids := search(t, f, datasources.SearchOptions{Query: tt.query}); !reflect.DeepEqual(ids, tt.ids) {
+				t.Fatalf("Expected %v, got %v", tt.ids, ids)
+			}
+		})
+	}
+}
+
+func TestSearchPaging(t *testing.T) {
+	f := newFile(t)
+
+	tests := []struct {
+		from, size int
+		ids        []string
+	}{
+		{0, 2, []string{"calls/calls.tsv:1", "calls/calls.tsv:2"}},
+		{2, 2, []string{"persons.csv:1", "persons.csv:2"}},
+		{3, 0, []string{"persons.csv:2", "persons.csv:3"}},
+		{5, 2, []string{}},
+	}
+
+	for _, tt := range tests {
+		ids := search(t, f, datasources.SearchOptions{
+			Query: "calls:* OR caller:* OR name:*",
+			From:  tt.from,
+			Size:  tt.size,
+		})
+
+		if !reflect.DeepEqual(ids, tt.ids) {
+			t.Errorf("From %d, size %d: expected %v, got %v", tt.from, tt.size, tt.ids, ids)
+		}
+	}
+}
+
+func TestGetFields(t *testing.T) {
+	f := newFile(t)
+
+	fields, err := f.GetFields(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	types := map[string]string{}
+	for _, field := range fields {
+		types[field.Path] = field.Type
+	}
+
+	expected := map[string]string{
+		"action":    "string",
+		"age":       "double",
+		"callee":    "long",
+		"caller":    "long",
+		"duration":  "long",
+		"email":     "string",
+		"id":        "string",
+		"joined":    "date",
+		"kind":      "string",
+		"label":     "string",
+		"name":      "string",
+		"source":    "string",
+		"success":   "boolean",
+		"tags":      "string",
+		"target":    "string",
+		"type":      "string",
+		"user.ip":   "string",
+		"user.name": "string",
+		"weight":    "double",
+	}
+
+	if !reflect.DeepEqual(types, expected) {
+		t.Fatalf("Expected %v, got %v", expected, types)
+	}
+
+	for i := 1; i < len(fields); i++ {
+		if fields[i-1].Path >= fields[i].Path {
+			t.Fatalf("Expected fields to be sorted, got %v", fields)
+		}
+	}
+}
+
+func TestGraphMLRelations(t *testing.T) {
+	f := newFile(t)
+
+	relations := map[string][]datasources.Relation{}
+	for _, item := range f.index.items {
+		if len(item.Relations) > 0 {
+			relations[item.ID] = item.Relations
+		}
+	}
+
+	expected := map[string][]datasources.Relation{
+		"graph.graphml:e1":    {{Type: "works-at", Field: "id", Source: "n1", Target: "n2", Weight: 2.5}},
+		"graph.graphml:edge2": {{Type: "edge", Field: "id", Source: "n2", Target: "n1"}},
+	}
+
+	if !reflect.DeepEqual(relations, expected) {
+		t.Fatalf("Expected %v, got %v", expected, relations)
+	}
+}
+
+func TestMergeType(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want string
+	}{
+		{"", "long", "long"},
+		{"long", "", "long"},
+		{"long", "long", "long"},
+		{"long", "double", "double"},
+		{"double", "long", "double"},
+		{"long", "date", "string"},
+		{"boolean", "string", "string"},
+	}
+
+	for _, tt := range tests {
+		if got := mergeType(tt.a, tt.b); got != tt.want {
+			t.Errorf("mergeType(%s, %s) = %s, want %s", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestIntersectUnion(t *testing.T) {
+	tests := []struct {
+		a, b      []int
+		intersect []int
+		union     []int
+	}{
+		{[]int{}, []int{1}, []int{}, []int{1}},
+		{[]int{1, 3, 5}, []int{2, 3, 4, 5}, []int{3, 5}, []int{1, 2, 3, 4, 5}},
+		{[]int{1, 2}, []int{3, 4}, []int{}, []int{1, 2, 3, 4}},
+	}
+
+	for _, tt := range tests {
+		if got := intersect(tt.a, tt.b); !reflect.DeepEqual(got, tt.intersect) {
+			t.Errorf("intersect(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.intersect)
+		}
+
+		if got := union(tt.a, tt.b); !reflect.DeepEqual(got, tt.union) {
+			t.Errorf("union(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.union)
+		}
+	}
+}
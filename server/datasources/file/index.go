@@ -0,0 +1,236 @@
+package file
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/dutchcoders/marija/server/datasources"
+	"github.com/dutchcoders/marija/server/datasources/query"
+)
+
+// posting is a word in a field, the empty field is any field.
+type posting struct {
+	field string
+	word  string
+}
+
+// index contains the items of the files, with the items containing a word for
+// each word to find the candidates of a query. Candidates are matched against
+// the query.
+type index struct {
+	items  []datasources.Item
+	fields []datasources.Field
+
+	postings map[posting][]int
+	types    map[string]string
+}
+
+func newIndex() *index {
+	return &index{
+		postings: map[posting][]int{},
+		types:    map[string]string{},
+	}
+}
+
+func (idx *index) add(item datasources.Item) {
+	i := len(idx.items)
+	idx.items = append(idx.items, item)
+
+	for field, v := range item.Fields {
+		for _, value := range query.Values(v) {
+			for _, word := range query.Tokens(value) {
+				idx.post(posting{field, word}, i)
+				idx.post(posting{"", word}, i)
+			}
+		}
+
+		idx.types[field] = mergeType(idx.types[field], fieldType(v))
+	}
+}
+
+// post adds item i to the items of p, items are added in order.
+func (idx *index) post(p posting, i int) {
+	items := idx.postings[p]
+	if len(items) > 0 && items[len(items)-1] == i {
+		return
+	}
+
+	idx.postings[p] = append(items, i)
+}
+
+// finish sorts the fields, after all items have been added.
+func (idx *index) finish() {
+	idx.fields = []datasources.Field{}
+
+	for field, typ := range idx.types {
+		if typ == "" {
+			typ = "string"
+		}
+
+		idx.fields = append(idx.fields, datasources.Field{
+			Path: field,
+			Type: typ,
+		})
+	}
+
+	sort.Slice(idx.fields, func(i, j int) bool {
+		return idx.fields[i].Path < idx.fields[j].Path
+	})
+}
+
+// candidates returns the items that may match the query, in order.
+func (idx *index) candidates(n query.Node) []int {
+	if items, ok := idx.lookup(n); ok {
+		return items
+	}
+
+	items := make([]int, len(idx.items))
+	for i := range items {
+		items[i] = i
+	}
+
+	return items
+}
+
+// lookup returns the items containing the words of the terms of the query,
+// it returns false when the query can't be looked up.
+func (idx *index) lookup(n query.Node) ([]int, bool) {
+	switch n := n.(type) {
+	case query.Term:
+		words := query.Tokens(n.Value)
+		if len(words) == 0 {
+			return nil, false
+		}
+
+		items := idx.postings[posting{n.Field, words[0]}]
+		for _, word := range words[1:] {
+			items = intersect(items, idx.postings[posting{n.Field, word}])
+		}
+
+		return items, true
+	case query.And:
+		items, found := []int(nil), false
+
+		for _, child := range n.Nodes {
+			childItems, ok := idx.lookup(child)
+			if !ok {
+				continue
+			} else if !found {
+				items, found = childItems, true
+			} else {
+				items = intersect(items, childItems)
+			}
+		}
+
+		return items, found
+	case query.Or:
+		items := []int{}
+
+		for _, child := range n.Nodes {
+			childItems, ok := idx.lookup(child)
+			if !ok {
+				return nil, false
+			}
+
+			items = union(items, childItems)
+		}
+
+		return items, true
+	}
+
+	return nil, false
+}
+
+func intersect(a, b []int) []int {
+	result := []int{}
+
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		if a[i] < b[j] {
+			i++
+		} else if a[i] > b[j] {
+			j++
+		} else {
+			result = append(result, a[i])
+			i, j = i+1, j+1
+		}
+	}
+
+	return result
+}
+
+func union(a, b []int) []int {
+	result := []int{}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if a[i] < b[j] {
+			result = append(result, a[i])
+			i++
+		} else if a[i] > b[j] {
+			result = append(result, b[j])
+			j++
+		} else {
+			result = append(result, a[i])
+			i, j = i+1, j+1
+		}
+	}
+
+	result = append(result, a[i:]...)
+	return append(result, b[j:]...)
+}
+
+// fieldType returns the type of a value, the types of all values of a field
+// are merged into the type of the field.
+func fieldType(v interface{}) string {
+	switch v := v.(type) {
+	case bool:
+		return "boolean"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "long"
+		}
+
+		return "double"
+	case string:
+		if _, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return "long"
+		} else if _, err := strconv.ParseFloat(v, 64); err == nil {
+			return "double"
+		} else if isDate(v) {
+			return "date"
+		}
+	case []interface{}:
+		typ := ""
+		for _, value := range v {
+			typ = mergeType(typ, fieldType(value))
+		}
+
+		return typ
+	}
+
+	return "string"
+}
+
+func mergeType(a, b string) string {
+	if a == "" || a == b {
+		return b
+	} else if b == "" {
+		return a
+	} else if (a == "long" && b == "double") || (a == "double" && b == "long") {
+		return "double"
+	}
+
+	return "string"
+}
+
+func isDate(s string) bool {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"} {
+		if _, err := time.Parse(layout, s); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
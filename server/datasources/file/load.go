@@ -0,0 +1,304 @@
+package file
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dutchcoders/marija/server/datasources"
+)
+
+// readers read the items of a file, by extension.
+var readers = map[string]func(io.Reader, string) ([]datasources.Item, error){
+	".csv":     readCSV(','),
+	".tsv":     readCSV('\t'),
+	".jsonl":   readJSONL,
+	".ndjson":  readJSONL,
+	".graphml": readGraphML,
+}
+
+// load indexes the files of the directory and its subdirectories, files of
+// unknown types are skipped.
+func load(root string) (*index, error) {
+	idx := newIndex()
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		} else if info.IsDir() {
+			return nil
+		}
+
+		reader, ok := readers[strings.ToLower(filepath.Ext(path))]
+		if !ok {
+			log.Debug("Skipping file %s", path)
+			return nil
+		}
+
+		name, err := filepath.Rel(root, path)
+		if err != nil || name == "." {
+			name = filepath.Base(path)
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+
+		defer f.Close()
+
+		items, err := reader(f, filepath.ToSlash(name))
+		if err != nil {
+			return fmt.Errorf("Error reading %s: %s", path, err.Error())
+		}
+
+		for _, item := range items {
+			idx.add(item)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	idx.finish()
+	return idx, nil
+}
+
+// readCSV reads the rows of a file with a header as items, empty values are
+// left out.
+func readCSV(comma rune) func(io.Reader, string) ([]datasources.Item, error) {
+	return func(r io.Reader, name string) ([]datasources.Item, error) {
+		reader := csv.NewReader(r)
+		reader.Comma = comma
+		reader.LazyQuotes = true
+		reader.FieldsPerRecord = -1
+
+		header, err := reader.Read()
+		if err == io.EOF {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		for i := range header {
+			header[i] = strings.TrimSpace(strings.TrimPrefix(header[i], "\ufeff"))
+			if header[i] == "" {
+				header[i] = fmt.Sprintf("column%d", i+1)
+			}
+		}
+
+		items := []datasources.Item{}
+
+		for row := 1; ; row++ {
+			record, err := reader.Read()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+
+			fields := map[string]interface{}{}
+			for i, value := range record {
+				if i < len(header) && value != "" {
+					fields[header[i]] = value
+				}
+			}
+
+			items = append(items, datasources.Item{
+				ID:     fmt.Sprintf("%s:%d", name, row),
+				Index:  name,
+				Fields: fields,
+			})
+		}
+
+		return items, nil
+	}
+}
+
+// readJSONL reads json objects as items, nested objects are flattened using
+// dots.
+func readJSONL(r io.Reader, name string) ([]datasources.Item, error) {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+
+	items := []datasources.Item{}
+
+	for row := 1; ; row++ {
+		doc := map[string]interface{}{}
+		if err := decoder.Decode(&doc); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("object %d: %s", row, err.Error())
+		}
+
+		items = append(items, datasources.Item{
+			ID:     fmt.Sprintf("%s:%d", name, row),
+			Index:  name,
+			Fields: flattenFields("", doc),
+		})
+	}
+
+	return items, nil
+}
+
+func flattenFields(root string, m map[string]interface{}) map[string]interface{} {
+	fields := map[string]interface{}{}
+
+	for k, v := range m {
+		key := k
+		if root != "" {
+			key = root + "." + key
+		}
+
+		switch s2 := v.(type) {
+		case map[string]interface{}:
+			for k2, v2 := range flattenFields(key, s2) {
+				fields[k2] = v2
+			}
+		default:
+			fields[key] = v
+		}
+	}
+
+	return fields
+}
+
+type graphml struct {
+	Keys   []graphmlKey   `xml:"key"`
+	Graphs []graphmlGraph `xml:"graph"`
+}
+
+type graphmlKey struct {
+	ID      string `xml:"id,attr"`
+	For     string `xml:"for,attr"`
+	Name    string `xml:"attr.name,attr"`
+	Default string `xml:"default"`
+}
+
+type graphmlGraph struct {
+	Nodes []graphmlNode `xml:"node"`
+	Edges []graphmlEdge `xml:"edge"`
+}
+
+type graphmlData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type graphmlNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphmlData `xml:"data"`
+}
+
+type graphmlEdge struct {
+	ID     string        `xml:"id,attr"`
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphmlData `xml:"data"`
+}
+
+// readGraphML reads the nodes and edges of a graph as items. Nodes have their
+// id in field id, edges are relations between the ids of the nodes, of the
+// type in their type or label data.
+func readGraphML(r io.Reader, name string) ([]datasources.Item, error) {
+	doc := graphml{}
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]graphmlKey{}
+	for _, key := range doc.Keys {
+		if key.Name == "" {
+			key.Name = key.ID
+		}
+
+		keys[key.ID] = key
+	}
+
+	// fields returns the data of a node or edge by the names of their keys,
+	// with the defaults of the keys
+	fields := func(kind string, data []graphmlData) map[string]interface{} {
+		values := map[string]interface{}{}
+
+		for _, key := range doc.Keys {
+			if (key.For == kind || key.For == "all") && key.Default != "" {
+				values[keys[key.ID].Name] = strings.TrimSpace(key.Default)
+			}
+		}
+
+		for _, d := range data {
+			key, ok := keys[d.Key]
+			if !ok {
+				key.Name = d.Key
+			}
+
+			if value := strings.TrimSpace(d.Value); value != "" {
+				values[key.Name] = value
+			}
+		}
+
+		return values
+	}
+
+	items := []datasources.Item{}
+
+	for _, graph := range doc.Graphs {
+		for _, node := range graph.Nodes {
+			values := fields("node", node.Data)
+			values["id"] = node.ID
+
+			items = append(items, datasources.Item{
+				ID:     fmt.Sprintf("%s:%s", name, node.ID),
+				Index:  name,
+				Fields: values,
+			})
+		}
+
+		for i, edge := range graph.Edges {
+			values := fields("edge", edge.Data)
+			values["source"] = edge.Source
+			values["target"] = edge.Target
+
+			relation := datasources.Relation{
+				Type:   "edge",
+				Field:  "id",
+				Source: edge.Source,
+				Target: edge.Target,
+			}
+
+			if v, ok := values["type"].(string); ok {
+				relation.Type = v
+			} else if v, ok := values["label"].(string); ok {
+				relation.Type = v
+			}
+
+			if v, ok := values["weight"].(string); !ok {
+			} else if weight, err := strconv.ParseFloat(v, 64); err == nil {
+				relation.Weight = weight
+			}
+
+			id := edge.ID
+			if id == "" {
+				id = fmt.Sprintf("edge%d", i+1)
+			}
+
+			items = append(items, datasources.Item{
+				ID:        fmt.Sprintf("%s:%s", name, id),
+				Index:     name,
+				Fields:    values,
+				Relations: []datasources.Relation{relation},
+			})
+		}
+	}
+
+	return items, nil
+}
@@ -5,4 +5,11 @@ type Graph struct {
 	Fields     map[string]interface{} `json:"fields"`
 	Count      int                    `json:"count"`
 	Datasource string                 `json:"datasource"`
+
+	// Indices are the indices the items of the node originate from.
+	Indices []string `json:"indices,omitempty"`
+
+	// Provenance is the number of items per datasource of entity nodes,
+	// which are shared by the datasources.
+	Provenance map[string]int64 `json:"provenance,omitempty"`
 }
@@ -0,0 +1,116 @@
+package datasources
+
+// Highlight configures the highlighting of the parts of items matching the
+// query.
+type Highlight struct {
+	Enabled bool
+
+	// Fields are the fields to highlight, wildcards are allowed.
+	Fields []string
+
+	// FragmentSize is the size of the fragments in characters, with 0 the
+	// whole field is returned.
+	FragmentSize int
+
+	PreTags  []string
+	PostTags []string
+}
+
+// DefaultHighlight is disabled, as highlighting all fields is expensive on
+// large indices. When enabled all fields are highlighted, returning the whole
+// field.
+var DefaultHighlight = Highlight{
+	Enabled:  false,
+	Fields:   []string{"*"},
+	PreTags:  []string{"<em>"},
+	PostTags: []string{"</em>"},
+}
+
+func stringOrStrings(v interface{}) ([]string, bool) {
+	switch v := v.(type) {
+	case string:
+		return []string{v}, true
+	case []interface{}:
+		values := []string{}
+		for _, s := range v {
+			if s, ok := s.(string); ok {
+				values = append(values, s)
+			}
+		}
+
+		return values, true
+	}
+
+	return nil, false
+}
+
+// ParseHighlight returns the highlight configuration of the highlight option
+// of a datasource, which is either a boolean or a table. A table enables
+// highlighting, unless enabled is false.
+func ParseHighlight(data map[string]interface{}) Highlight {
+	h := DefaultHighlight
+
+	switch v := data["highlight"].(type) {
+	case bool:
+		h.Enabled = v
+	case map[string]interface{}:
+		h.Enabled = true
+
+		if v, ok := v["enabled"]; !ok {
+		} else if v, ok := v.(bool); !ok {
+		} else {
+			h.Enabled = v
+		}
+
+		if v, ok := v["fields"]; !ok {
+		} else if v, ok := stringOrStrings(v); !ok {
+		} else {
+			h.Fields = v
+		}
+
+		if v, ok := v["fragment-size"]; !ok {
+		} else if v, ok := v.(int64); !ok {
+		} else {
+			h.FragmentSize = int(v)
+		}
+
+		if v, ok := v["pre-tags"]; !ok {
+		} else if v, ok := stringOrStrings(v); !ok {
+		} else {
+			h.PreTags = v
+		}
+
+		if v, ok := v["post-tags"]; !ok {
+		} else if v, ok := stringOrStrings(v); !ok {
+		} else {
+			h.PostTags = v
+		}
+	}
+
+	return h
+}
+
+// ElasticHighlight returns the highlight section of an Elasticsearch search
+// request.
+func ElasticHighlight(h Highlight) map[string]interface{} {
+	fields := map[string]interface{}{}
+
+	for _, field := range h.Fields {
+		f := map[string]interface{}{}
+
+		if h.FragmentSize > 0 {
+			f["fragment_size"] = h.FragmentSize
+		} else {
+			f["number_of_fragments"] = 0
+		}
+
+		fields[field] = f
+	}
+
+	return map[string]interface{}{
+		"fields":              fields,
+		"require_field_match": false,
+		"pre_tags":            h.PreTags,
+		"post_tags":           h.PostTags,
+	}
+}
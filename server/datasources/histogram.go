@@ -0,0 +1,189 @@
+package datasources
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HistogramOptions are the options of a date histogram, items matching the
+// search options are counted per interval of the date field.
+type HistogramOptions struct {
+	SearchOptions
+
+	// Field is the date field.
+	Field string
+
+	// Interval is the width of the buckets.
+	Interval Interval
+}
+
+// HistogramBucket is the number of items from Time until the next bucket.
+type HistogramBucket struct {
+	Time  time.Time `json:"time"`
+	Count int64     `json:"count"`
+}
+
+// Interval is a fixed interval, a number with unit s, m, h, d or w. Buckets
+// are aligned in UTC, weeks start on monday.
+type Interval struct {
+	Value int
+	Unit  string
+}
+
+var intervalUnits = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+	"d": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour,
+}
+
+// ParseInterval parses intervals like 30s, 5m, 1h, 1d and 1w.
+func ParseInterval(s string) (Interval, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Interval{}, fmt.Errorf("No interval set")
+	}
+
+	unit := s[len(s)-1:]
+	if _, ok := intervalUnits[unit]; !ok {
+		return Interval{}, fmt.Errorf("Invalid interval unit: %s", s)
+	}
+
+	value, err := strconv.Atoi(s[:len(s)-1])
+	if err != nil || value <= 0 {
+		return Interval{}, fmt.Errorf("Invalid interval: %s", s)
+	}
+
+	return Interval{
+		Value: value,
+		Unit:  unit,
+	}, nil
+}
+
+func (i Interval) String() string {
+	return fmt.Sprintf("%d%s", i.Value, i.Unit)
+}
+
+// Duration returns the width of the interval.
+func (i Interval) Duration() time.Duration {
+	return time.Duration(i.Value) * intervalUnits[i.Unit]
+}
+
+// Truncate returns the start of the bucket containing t.
+func (i Interval) Truncate(t time.Time) time.Time {
+	// truncate rounds down since january 1 of year 1, which was a monday
+	return t.UTC().Truncate(i.Duration())
+}
+
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.000-0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	time.RFC1123Z,
+	time.RubyDate,
+	"2006-01-02",
+}
+
+// ParseTime returns the time of a field value, either formatted or as unix
+// timestamp in seconds or milliseconds.
+func ParseTime(v interface{}) (time.Time, bool) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, true
+	case float64:
+		return unixTime(v), true
+	case int64:
+		return unixTime(float64(v)), true
+	case int:
+		return unixTime(float64(v)), true
+	case []interface{}:
+		if len(v) > 0 {
+			return ParseTime(v[0])
+		}
+	case string:
+		for _, layout := range timeLayouts {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t, true
+			}
+		}
+
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return unixTime(f), true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// unixTime converts timestamps in seconds or, when too large to be seconds,
+// in milliseconds.
+func unixTime(f float64) time.Time {
+	if math.Abs(f) > 1e11 {
+		f = f / 1000
+	}
+
+	sec, frac := math.Modf(f)
+	return time.Unix(int64(sec), int64(frac*1e9)).UTC()
+}
+
+// HistogramFromSearch calculates the histogram by searching the datasource
+// and counting the items, for datasources that can't aggregate themselves.
+// Items without a valid date are skipped.
+func HistogramFromSearch(ctx context.Context, index Index, o HistogramOptions) ([]HistogramBucket, error) {
+	counts := map[time.Time]int64{}
+
+	// the search is canceled when returning early
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	response := index.Search(ctx, o.SearchOptions)
+	defer Drain(response)
+
+	itemCh, errorCh := response.Item(), response.Error()
+	for itemCh != nil || errorCh != nil {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case err, ok := <-errorCh:
+			if !ok {
+				errorCh = nil
+				continue
+			}
+
+			return nil, err
+		case item, ok := <-itemCh:
+			if !ok {
+				itemCh = nil
+				continue
+			}
+
+			t, ok := ParseTime(item.Fields[o.Field])
+			if !ok {
+				continue
+			}
+
+			counts[o.Interval.Truncate(t)]++
+		}
+	}
+
+	buckets := []HistogramBucket{}
+	for t, count := range counts {
+		buckets = append(buckets, HistogramBucket{
+			Time:  t,
+			Count: count,
+		})
+	}
+
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].Time.Before(buckets[j].Time)
+	})
+
+	return buckets, nil
+}
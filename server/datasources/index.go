@@ -1,6 +1,10 @@
 package datasources
 
-import "context"
+import (
+	"context"
+
+	"github.com/dutchcoders/marija/server/datasources/query"
+)
 
 type Index interface {
 	Search(context.Context, SearchOptions) SearchResponse
@@ -10,6 +14,37 @@ type Index interface {
 	Type() string
 }
 
+// Translator is implemented by datasources that search using the query tree
+// of the search options, it returns the native query for the tree.
+type Translator interface {
+	Translate(query.Node) string
+}
+
+// Pinger is implemented by datasources that can check whether their backend
+// is reachable.
+type Pinger interface {
+	Ping(context.Context) error
+}
+
+// Aggregator is implemented by datasources that can count the combinations of
+// values of so.Fields in the backend, returning at most so.Size buckets.
+type Aggregator interface {
+	Aggregate(ctx context.Context, so SearchOptions) ([]Bucket, error)
+}
+
+// Histogrammer is implemented by datasources that can count the items per
+// interval of a date field in the backend.
+type Histogrammer interface {
+	Histogram(ctx context.Context, o HistogramOptions) ([]HistogramBucket, error)
+}
+
+// Sampler is implemented by datasources that can return the results of a
+// search in random order, the first results being a random sample. The order
+// is the same for searches with the same seed.
+type Sampler interface {
+	Sample(ctx context.Context, so SearchOptions, seed int64) SearchResponse
+}
+
 type SetNamerer interface {
 	SetName(name string) string
 }
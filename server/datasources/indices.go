@@ -0,0 +1,68 @@
+package datasources
+
+import (
+	"net/url"
+	"strings"
+)
+
+// SplitIndices splits a comma separated list of indices, commas within date
+// math expressions like <logs-{now/d}> are kept.
+func SplitIndices(s string) []string {
+	indices := []string{}
+
+	depth := 0
+	start := 0
+
+	add := func(index string) {
+		if index = strings.TrimSpace(index); index != "" {
+			indices = append(indices, index)
+		}
+	}
+
+	for i, r := range s {
+		switch r {
+		case '<':
+			depth++
+		case '>':
+			if depth > 0 {
+				depth--
+			}
+		case ',':
+			if depth > 0 {
+				continue
+			}
+
+			add(s[start:i])
+			start = i + 1
+		}
+	}
+
+	add(s[start:])
+	return indices
+}
+
+// ElasticIndices returns the indices of an Elasticsearch datasource. These are
+// taken from the index option, either a string or list of strings, and
+// otherwise from the path of the url. Indices can be lists, wildcards and date
+// math expressions.
+func ElasticIndices(data map[string]interface{}, u *url.URL) []string {
+	switch v := data["index"].(type) {
+	case string:
+		return SplitIndices(v)
+	case []interface{}:
+		indices := []string{}
+		for _, index := range v {
+			if index, ok := index.(string); ok {
+				indices = append(indices, SplitIndices(index)...)
+			}
+		}
+
+		return indices
+	}
+
+	if u == nil {
+		return []string{}
+	}
+
+	return SplitIndices(strings.TrimPrefix(u.Path, "/"))
+}
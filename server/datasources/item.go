@@ -4,4 +4,16 @@ type Item struct {
 	ID        string                 `json:"id"`
 	Fields    map[string]interface{} `json:"fields"`
 	Highlight map[string][]string    `json:"highlight"`
+
+	// Index is the index the item originates from, for datasources querying
+	// multiple indices.
+	Index string `json:"index,omitempty"`
+
+	// Datasource is the datasource the item originates from, set when the
+	// item is received.
+	Datasource string `json:"datasource,omitempty"`
+
+	// Relations are the relationships the datasource knows of between
+	// values of the item.
+	Relations []Relation `json:"relations,omitempty"`
 }
@@ -1,10 +1,21 @@
 package datasources
 
+import "github.com/dutchcoders/marija/server/datasources/query"
+
 type SearchOptions struct {
 	Size  int
 	From  int
 	Query string
 
+	// Expr is the parsed query when it has been written in the Marija
+	// query language, it is nil for native queries.
+	Expr query.Node
+
 	AdvancedQueries []AdvancedQuery
 	Fields          []string
+
+	// Continuation identifies the search when it can be continued, the
+	// datasource can keep its position within the results to continue
+	// from, instead of skipping the first results.
+	Continuation string
 }
@@ -0,0 +1,93 @@
+package datasources
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// maxPaused is the number of paused searches kept per datasource, the oldest
+// are closed first.
+const maxPaused = 64
+
+type pausedSearch struct {
+	position io.Closer
+	expires  time.Time
+}
+
+// Paused keeps the positions of searches within the results, like scrolls,
+// so they can be continued. Positions are closed when they expire.
+type Paused struct {
+	m        sync.Mutex
+	searches map[string]pausedSearch
+	keys     []string
+}
+
+// Pause keeps the position of the search with the continuation key until it
+// expires.
+func (p *Paused) Pause(key string, position io.Closer, expires time.Time) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	if p.searches == nil {
+		p.searches = map[string]pausedSearch{}
+	}
+
+	if ps, ok := p.searches[key]; ok {
+		go ps.position.Close()
+	}
+
+	now := time.Now()
+
+	keys := []string{}
+	for _, k := range p.keys {
+		if ps := p.searches[k]; k == key {
+		} else if now.After(ps.expires) {
+			go ps.position.Close()
+			delete(p.searches, k)
+		} else {
+			keys = append(keys, k)
+		}
+	}
+
+	for len(keys) >= maxPaused {
+		go p.searches[keys[0]].position.Close()
+		delete(p.searches, keys[0])
+
+		keys = keys[1:]
+	}
+
+	p.keys = append(keys, key)
+	p.searches[key] = pausedSearch{
+		position: position,
+		expires:  expires,
+	}
+}
+
+// Resume returns the position of the search with the continuation key, when
+// it hasn't expired. The position is no longer kept.
+func (p *Paused) Resume(key string) (io.Closer, bool) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	ps, ok := p.searches[key]
+	if !ok {
+		return nil, false
+	}
+
+	delete(p.searches, key)
+
+	for n, k := range p.keys {
+		if k == key {
+			p.keys = append(p.keys[:n], p.keys[n+1:]...)
+			break
+		}
+	}
+
+	if time.Now().After(ps.expires) {
+		go ps.position.Close()
+		return nil, false
+	}
+
+	return ps.position, true
+}
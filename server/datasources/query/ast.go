@@ -0,0 +1,107 @@
+// Package query implements the Marija query language, which is parsed into an
+// abstract syntax tree and translated to the query languages of the
+// datasources, or matched against items by datasources without one.
+//
+// The language resembles the Lucene query syntax:
+//
+//	value                       value in any field
+//	"a phrase"                  phrase in any field
+//	field:value                 value in field
+//	field:"a phrase"            phrase in field
+//	field:val*                  wildcard, * and ? can be escaped using \
+//	field:*                     field exists
+//	field:[1 TO 5]              inclusive range, * for an open bound
+//	field:{1 TO 5}              exclusive range
+//	field:>5 field:<=5          comparisons
+//	field:(a OR b)              group within a field
+//	a AND b, a OR b, NOT a      boolean operators, && || ! are allowed too
+//	a b                         implicit AND
+//	-a                          NOT a
+package query
+
+// Node is a node of the query tree.
+type Node interface {
+	node()
+}
+
+// MatchAll matches everything, it is the result of an empty query or *.
+type MatchAll struct{}
+
+// And matches when all of its nodes match.
+type And struct {
+	Nodes []Node
+}
+
+// Or matches when any of its nodes matches.
+type Or struct {
+	Nodes []Node
+}
+
+// Not matches when its node doesn't match.
+type Not struct {
+	Node Node
+}
+
+// Term matches a value or phrase in field, or in any field when no field has
+// been set.
+type Term struct {
+	Field  string
+	Value  string
+	Phrase bool
+}
+
+// Wildcard matches the pattern in field, or in any field when no field has
+// been set. The pattern contains unescaped * and ? wildcards, literal *, ?
+// and \ are escaped using \.
+type Wildcard struct {
+	Field   string
+	Pattern string
+}
+
+// Range matches the values of field between From and To, an empty bound is
+// open.
+type Range struct {
+	Field string
+
+	From        string
+	IncludeFrom bool
+
+	To        string
+	IncludeTo bool
+}
+
+// Exists matches when field has a value.
+type Exists struct {
+	Field string
+}
+
+func (MatchAll) node() {}
+func (And) node()      {}
+func (Or) node()       {}
+func (Not) node()      {}
+func (Term) node()     {}
+func (Wildcard) node() {}
+func (Range) node()    {}
+func (Exists) node()   {}
+
+// Terms returns a query matching any of the values for the fields, fields and
+// values are kept in the order given.
+func Terms(fields []string, values map[string][]string) Node {
+	or := Or{}
+
+	for _, field := range fields {
+		for _, v := range values[field] {
+			or.Nodes = append(or.Nodes, Term{
+				Field:  field,
+				Value:  v,
+				Phrase: true,
+			})
+		}
+	}
+
+	if len(or.Nodes) == 1 {
+		return or.Nodes[0]
+	}
+
+	return or
+}
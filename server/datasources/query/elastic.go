@@ -0,0 +1,123 @@
+package query
+
+import (
+	"fmt"
+)
+
+// Elastic translates the query to the Elasticsearch query DSL.
+func Elastic(n Node) map[string]interface{} {
+	switch n := n.(type) {
+	case MatchAll:
+		return map[string]interface{}{
+			"match_all": map[string]interface{}{},
+		}
+	case And:
+		return map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must": elasticList(n.Nodes),
+			},
+		}
+	case Or:
+		if len(n.Nodes) == 0 {
+			return map[string]interface{}{
+				"match_none": map[string]interface{}{},
+			}
+		}
+
+		return map[string]interface{}{
+			"bool": map[string]interface{}{
+				"should":               elasticList(n.Nodes),
+				"minimum_should_match": 1,
+			},
+		}
+	case Not:
+		return map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must_not": []interface{}{Elastic(n.Node)},
+			},
+		}
+	case Term:
+		if n.Field == "" {
+			return elasticQueryString(Lucene(n))
+		}
+
+		if n.Phrase {
+			return map[string]interface{}{
+				"match_phrase": map[string]interface{}{
+					n.Field: n.Value,
+				},
+			}
+		}
+
+		return map[string]interface{}{
+			"match": map[string]interface{}{
+				n.Field: map[string]interface{}{
+					"query":    n.Value,
+					"operator": "and",
+				},
+			},
+		}
+	case Wildcard:
+		if n.Field == "" {
+			return elasticQueryString(Lucene(n))
+		}
+
+		return map[string]interface{}{
+			"wildcard": map[string]interface{}{
+				n.Field: map[string]interface{}{
+					"value": n.Pattern,
+				},
+			},
+		}
+	case Range:
+		bounds := map[string]interface{}{}
+
+		if n.From == "" {
+		} else if n.IncludeFrom {
+			bounds["gte"] = n.From
+		} else {
+			bounds["gt"] = n.From
+		}
+
+		if n.To == "" {
+		} else if n.IncludeTo {
+			bounds["lte"] = n.To
+		} else {
+			bounds["lt"] = n.To
+		}
+
+		return map[string]interface{}{
+			"range": map[string]interface{}{
+				n.Field: bounds,
+			},
+		}
+	case Exists:
+		return map[string]interface{}{
+			"exists": map[string]interface{}{
+				"field": n.Field,
+			},
+		}
+	}
+
+	panic(fmt.Sprintf("query: unknown node %T", n))
+}
+
+func elasticList(nodes []Node) []interface{} {
+	list := make([]interface{}, len(nodes))
+	for i, n := range nodes {
+		list[i] = Elastic(n)
+	}
+
+	return list
+}
+
+// elasticQueryString searches all fields for the lucene query.
+func elasticQueryString(q string) map[string]interface{} {
+	return map[string]interface{}{
+		"query_string": map[string]interface{}{
+			"query":         q,
+			"default_field": "*",
+			"lenient":       true,
+		},
+	}
+}
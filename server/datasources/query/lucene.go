@@ -0,0 +1,106 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+)
+
+var (
+	luceneEscaper = strings.NewReplacer(
+		`\`, `\\`, `+`, `\+`, `-`, `\-`, `!`, `\!`, `(`, `\(`, `)`, `\)`,
+		`:`, `\:`, `^`, `\^`, `[`, `\[`, `]`, `\]`, `"`, `\"`, `{`, `\{`,
+		`}`, `\}`, `~`, `\~`, `*`, `\*`, `?`, `\?`, `|`, `\|`, `&`, `\&`,
+		`/`, `\/`, ` `, `\ `,
+	)
+
+	lucenePhraseEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+	// wildcard patterns keep their escaped wildcards
+	luceneWildcardEscaper = strings.NewReplacer(
+		`+`, `\+`, `-`, `\-`, `!`, `\!`, `(`, `\(`, `)`, `\)`,
+		`:`, `\:`, `^`, `\^`, `[`, `\[`, `]`, `\]`, `"`, `\"`, `{`, `\{`,
+		`}`, `\}`, `~`, `\~`, `|`, `\|`, `&`, `\&`, `/`, `\/`, ` `, `\ `,
+	)
+)
+
+// Lucene translates the query to the Lucene query syntax, as used by Solr and
+// the query_string query of Elasticsearch.
+func Lucene(n Node) string {
+	switch n := n.(type) {
+	case MatchAll:
+		return "*:*"
+	case And:
+		return luceneJoin(n.Nodes, " AND ")
+	case Or:
+		if len(n.Nodes) == 0 {
+			return "NOT *:*"
+		}
+
+		return luceneJoin(n.Nodes, " OR ")
+	case Not:
+		return "NOT " + luceneGroup(n.Node)
+	case Term:
+		value := luceneEscaper.Replace(n.Value)
+		if n.Phrase {
+			value = `"` + lucenePhraseEscaper.Replace(n.Value) + `"`
+		}
+
+		return luceneField(n.Field) + value
+	case Wildcard:
+		return luceneField(n.Field) + luceneWildcardEscaper.Replace(n.Pattern)
+	case Range:
+		from, to := "*", "*"
+		if n.From != "" {
+			from = luceneBound(n.From)
+		}
+
+		if n.To != "" {
+			to = luceneBound(n.To)
+		}
+
+		open, close := "{", "}"
+		if n.IncludeFrom || n.From == "" {
+			open = "["
+		}
+
+		if n.IncludeTo || n.To == "" {
+			close = "]"
+		}
+
+		return fmt.Sprintf("%s%s%s TO %s%s", luceneField(n.Field), open, from, to, close)
+	case Exists:
+		return luceneField(n.Field) + "*"
+	}
+
+	panic(fmt.Sprintf("query: unknown node %T", n))
+}
+
+func luceneField(field string) string {
+	if field == "" {
+		return ""
+	}
+
+	return luceneEscaper.Replace(field) + ":"
+}
+
+func luceneBound(v string) string {
+	return `"` + lucenePhraseEscaper.Replace(v) + `"`
+}
+
+func luceneGroup(n Node) string {
+	switch n := n.(type) {
+	case And, Or, Not:
+		return "(" + Lucene(n) + ")"
+	}
+
+	return Lucene(n)
+}
+
+func luceneJoin(nodes []Node, sep string) string {
+	parts := make([]string, len(nodes))
+	for i, n := range nodes {
+		parts[i] = luceneGroup(n)
+	}
+
+	return strings.Join(parts, sep)
+}
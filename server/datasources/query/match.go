@@ -0,0 +1,282 @@
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Matcher evaluates a query tree against the fields of items, for datasources
+// without a query language of their own.
+//
+// Terms match the words of values case insensitively, phrases a sequence of
+// words. Wildcards match a whole value or one of its words. Ranges compare
+// numbers, dates or otherwise strings.
+type Matcher struct {
+	n Node
+
+	patterns map[string]*regexp.Regexp
+}
+
+// NewMatcher returns a matcher for the query tree.
+func NewMatcher(n Node) (*Matcher, error) {
+	m := &Matcher{
+		n:        n,
+		patterns: map[string]*regexp.Regexp{},
+	}
+
+	if err := m.compile(n); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func (m *Matcher) compile(n Node) error {
+	switch n := n.(type) {
+	case And:
+		for _, child := range n.Nodes {
+			if err := m.compile(child); err != nil {
+				return err
+			}
+		}
+	case Or:
+		for _, child := range n.Nodes {
+			if err := m.compile(child); err != nil {
+				return err
+			}
+		}
+	case Not:
+		return m.compile(n.Node)
+	case Wildcard:
+		re, err := regexp.Compile("(?i)^" + wildcardRegexp(n.Pattern) + "$")
+		if err != nil {
+			return err
+		}
+
+		m.patterns[n.Pattern] = re
+	}
+
+	return nil
+}
+
+// wildcardRegexp returns the regular expression of a wildcard pattern.
+func wildcardRegexp(pattern string) string {
+	expr := ""
+	escaped := false
+
+	for _, r := range pattern {
+		if escaped {
+			expr += regexp.QuoteMeta(string(r))
+			escaped = false
+		} else if r == '\\' {
+			escaped = true
+		} else if r == '*' {
+			expr += ".*"
+		} else if r == '?' {
+			expr += "."
+		} else {
+			expr += regexp.QuoteMeta(string(r))
+		}
+	}
+
+	return expr
+}
+
+// Match returns true when the fields match the query.
+func (m *Matcher) Match(fields map[string]interface{}) bool {
+	return m.match(m.n, fields)
+}
+
+func (m *Matcher) match(n Node, fields map[string]interface{}) bool {
+	switch n := n.(type) {
+	case MatchAll:
+		return true
+	case And:
+		for _, child := range n.Nodes {
+			if !m.match(child, fields) {
+				return false
+			}
+		}
+
+		return true
+	case Or:
+		for _, child := range n.Nodes {
+			if m.match(child, fields) {
+				return true
+			}
+		}
+
+		return false
+	case Not:
+		return !m.match(n.Node, fields)
+	case Term:
+		words := Tokens(n.Value)
+
+		return matchValues(n.Field, fields, func(value string) bool {
+			if len(words) == 0 {
+				return strings.EqualFold(value, n.Value)
+			}
+
+			return containsWords(Tokens(value), words)
+		})
+	case Wildcard:
+		re := m.patterns[n.Pattern]
+
+		return matchValues(n.Field, fields, func(value string) bool {
+			if re.MatchString(value) {
+				return true
+			}
+
+			for _, word := range Tokens(value) {
+				if re.MatchString(word) {
+					return true
+				}
+			}
+
+			return false
+		})
+	case Range:
+		return matchValues(n.Field, fields, func(value string) bool {
+			if n.From != "" {
+				if c := compare(value, n.From); c < 0 || (c == 0 && !n.IncludeFrom) {
+					return false
+				}
+			}
+
+			if n.To != "" {
+				if c := compare(value, n.To); c > 0 || (c == 0 && !n.IncludeTo) {
+					return false
+				}
+			}
+
+			return true
+		})
+	case Exists:
+		return matchValues(n.Field, fields, func(value string) bool {
+			return value != ""
+		})
+	}
+
+	panic(fmt.Sprintf("query: unknown node %T", n))
+}
+
+// matchValues returns true when fn matches any value of field, or of any
+// field when field is empty.
+func matchValues(field string, fields map[string]interface{}, fn func(string) bool) bool {
+	if field != "" {
+		for _, value := range Values(fields[field]) {
+			if fn(value) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	for _, v := range fields {
+		for _, value := range Values(v) {
+			if fn(value) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Values returns the values of a field as strings, lists are returned per
+// value.
+func Values(v interface{}) []string {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []interface{}:
+		values := []string{}
+		for _, s := range v {
+			values = append(values, Values(s)...)
+		}
+
+		return values
+	default:
+		return []string{fmt.Sprintf("%v", v)}
+	}
+}
+
+// Tokens returns the lower case words of a value, words consist of letters
+// and digits.
+func Tokens(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// containsWords returns true when words occur in sequence in tokens.
+func containsWords(tokens []string, words []string) bool {
+	for i := 0; i+len(words) <= len(tokens); i++ {
+		found := true
+
+		for j, word := range words {
+			if tokens[i+j] != word {
+				found = false
+				break
+			}
+		}
+
+		if found {
+			return true
+		}
+	}
+
+	return false
+}
+
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+func parseDate(s string) (time.Time, bool) {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// compare compares a value with a bound as numbers, as dates or otherwise as
+// strings.
+func compare(value, bound string) int {
+	if a, err := strconv.ParseFloat(value, 64); err != nil {
+	} else if b, err := strconv.ParseFloat(bound, 64); err != nil {
+	} else if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	} else {
+		return 0
+	}
+
+	if a, ok := parseDate(value); !ok {
+	} else if b, ok := parseDate(bound); !ok {
+	} else if a.Before(b) {
+		return -1
+	} else if a.After(b) {
+		return 1
+	} else {
+		return 0
+	}
+
+	return strings.Compare(value, bound)
+}
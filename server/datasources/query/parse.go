@@ -0,0 +1,575 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenType int
+
+const (
+	tokenEOF tokenType = iota
+	tokenWord
+	tokenField
+	tokenPhrase
+	tokenLParen
+	tokenRParen
+	tokenLBracket
+	tokenRBracket
+	tokenLBrace
+	tokenRBrace
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenTo
+)
+
+func (t tokenType) String() string {
+	switch t {
+	case tokenEOF:
+		return "end of query"
+	case tokenWord:
+		return "value"
+	case tokenField:
+		return "field"
+	case tokenPhrase:
+		return "phrase"
+	case tokenLParen:
+		return "("
+	case tokenRParen:
+		return ")"
+	case tokenLBracket:
+		return "["
+	case tokenRBracket:
+		return "]"
+	case tokenLBrace:
+		return "{"
+	case tokenRBrace:
+		return "}"
+	case tokenAnd:
+		return "AND"
+	case tokenOr:
+		return "OR"
+	case tokenNot:
+		return "NOT"
+	case tokenTo:
+		return "TO"
+	}
+
+	return "unknown"
+}
+
+type token struct {
+	typ tokenType
+	pos int
+
+	// raw contains the text as written, value the unescaped text.
+	raw   string
+	value string
+}
+
+// ParseError is returned for queries that can't be parsed.
+type ParseError struct {
+	Pos     int
+	Message string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("Error parsing query at position %d: %s", e.Pos, e.Message)
+}
+
+type lexer struct {
+	input []rune
+	pos   int
+
+	// value is true after a field, colons are part of its value
+	value bool
+}
+
+func isDelimiter(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune(`()[]{}"`, r)
+}
+
+func isFieldName(s string) bool {
+	for i, r := range s {
+		if unicode.IsLetter(r) || r == '_' || r == '@' {
+			continue
+		} else if i > 0 && (unicode.IsDigit(r) || r == '.' || r == '-') {
+			continue
+		}
+
+		return false
+	}
+
+	return s != ""
+}
+
+func (l *lexer) next() (token, error) {
+	for l.pos < len(l.input) && unicode.IsSpace(l.input[l.pos]) {
+		l.pos++
+
+		l.value = false
+	}
+
+	start := l.pos
+
+	if l.pos >= len(l.input) {
+		return token{typ: tokenEOF, pos: start}, nil
+	}
+
+	r := l.input[l.pos]
+
+	single := map[rune]tokenType{
+		'(': tokenLParen,
+		')': tokenRParen,
+		'[': tokenLBracket,
+		']': tokenRBracket,
+		'{': tokenLBrace,
+		'}': tokenRBrace,
+	}
+
+	if typ, ok := single[r]; ok {
+		l.pos++
+		l.value = false
+
+		return token{typ: typ, pos: start, raw: string(r)}, nil
+	}
+
+	if r == '"' {
+		l.pos++
+
+		value := []rune{}
+
+		for {
+			if l.pos >= len(l.input) {
+				return token{}, &ParseError{Pos: start, Message: "unterminated phrase"}
+			}
+
+			r := l.input[l.pos]
+			l.pos++
+
+			if r == '\\' && l.pos < len(l.input) {
+				value = append(value, l.input[l.pos])
+				l.pos++
+				continue
+			} else if r == '"' {
+				break
+			}
+
+			value = append(value, r)
+		}
+
+		l.value = false
+
+		return token{typ: tokenPhrase, pos: start, raw: string(l.input[start:l.pos]), value: string(value)}, nil
+	}
+
+	if !l.value {
+		if l.hasPrefix("&&") {
+			l.pos += 2
+			return token{typ: tokenAnd, pos: start, raw: "&&"}, nil
+		} else if l.hasPrefix("||") {
+			l.pos += 2
+			return token{typ: tokenOr, pos: start, raw: "||"}, nil
+		} else if r == '!' || r == '-' {
+			l.pos++
+			return token{typ: tokenNot, pos: start, raw: string(r)}, nil
+		} else if r == '+' {
+			// required, which is the default
+			l.pos++
+			return l.next()
+		}
+	}
+
+	value := []rune{}
+
+	for l.pos < len(l.input) {
+		r := l.input[l.pos]
+
+		if r == '\\' && l.pos+1 < len(l.input) {
+			value = append(value, l.input[l.pos+1])
+			l.pos += 2
+			continue
+		} else if isDelimiter(r) {
+			break
+		} else if r == ':' && !l.value && isFieldName(string(l.input[start:l.pos])) {
+			l.pos++
+			l.value = true
+
+			return token{typ: tokenField, pos: start, raw: string(l.input[start : l.pos-1]), value: string(value)}, nil
+		}
+
+		value = append(value, r)
+		l.pos++
+	}
+
+	raw := string(l.input[start:l.pos])
+
+	if !l.value {
+		switch raw {
+		case "AND":
+			return token{typ: tokenAnd, pos: start, raw: raw}, nil
+		case "OR":
+			return token{typ: tokenOr, pos: start, raw: raw}, nil
+		case "NOT":
+			return token{typ: tokenNot, pos: start, raw: raw}, nil
+		case "TO":
+			return token{typ: tokenTo, pos: start, raw: raw}, nil
+		}
+	}
+
+	l.value = false
+
+	return token{typ: tokenWord, pos: start, raw: raw, value: string(value)}, nil
+}
+
+func (l *lexer) hasPrefix(s string) bool {
+	return strings.HasPrefix(string(l.input[l.pos:]), s)
+}
+
+type parser struct {
+	lexer *lexer
+	tok   token
+}
+
+// Parse parses the query into a tree.
+func Parse(s string) (Node, error) {
+	p := &parser{
+		lexer: &lexer{input: []rune(s)},
+	}
+
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	if p.tok.typ == tokenEOF {
+		return MatchAll{}, nil
+	}
+
+	n, err := p.parseOr("")
+	if err != nil {
+		return nil, err
+	}
+
+	if p.tok.typ != tokenEOF {
+		return nil, p.unexpected()
+	}
+
+	return n, nil
+}
+
+func (p *parser) advance() error {
+	tok, err := p.lexer.next()
+	if err != nil {
+		return err
+	}
+
+	p.tok = tok
+	return nil
+}
+
+func (p *parser) unexpected() error {
+	return &ParseError{Pos: p.tok.pos, Message: fmt.Sprintf("unexpected %s", p.tok.typ)}
+}
+
+func (p *parser) expect(typ tokenType) (token, error) {
+	tok := p.tok
+	if tok.typ != typ {
+		return tok, &ParseError{Pos: tok.pos, Message: fmt.Sprintf("expected %s, got %s", typ, tok.typ)}
+	}
+
+	return tok, p.advance()
+}
+
+func (p *parser) parseOr(field string) (Node, error) {
+	n, err := p.parseAnd(field)
+	if err != nil {
+		return nil, err
+	}
+
+	or := Or{Nodes: []Node{n}}
+
+	for p.tok.typ == tokenOr {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+
+		n, err := p.parseAnd(field)
+		if err != nil {
+			return nil, err
+		}
+
+		or.Nodes = append(or.Nodes, n)
+	}
+
+	if len(or.Nodes) == 1 {
+		return or.Nodes[0], nil
+	}
+
+	return or, nil
+}
+
+func (p *parser) parseAnd(field string) (Node, error) {
+	n, err := p.parseNot(field)
+	if err != nil {
+		return nil, err
+	}
+
+	and := And{Nodes: []Node{n}}
+
+	for {
+		switch p.tok.typ {
+		case tokenAnd:
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+		case tokenEOF, tokenOr, tokenRParen:
+			if len(and.Nodes) == 1 {
+				return and.Nodes[0], nil
+			}
+
+			return and, nil
+		}
+
+		// implicit and
+		n, err := p.parseNot(field)
+		if err != nil {
+			return nil, err
+		}
+
+		and.Nodes = append(and.Nodes, n)
+	}
+}
+
+func (p *parser) parseNot(field string) (Node, error) {
+	if p.tok.typ != tokenNot {
+		return p.parsePrimary(field)
+	}
+
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	n, err := p.parseNot(field)
+	if err != nil {
+		return nil, err
+	}
+
+	return Not{Node: n}, nil
+}
+
+func (p *parser) parsePrimary(field string) (Node, error) {
+	switch p.tok.typ {
+	case tokenLParen:
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+
+		n, err := p.parseOr(field)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := p.expect(tokenRParen); err != nil {
+			return nil, err
+		}
+
+		return n, nil
+	case tokenField:
+		if field != "" {
+			return nil, &ParseError{Pos: p.tok.pos, Message: "nested field"}
+		}
+
+		field := p.tok.value
+
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+
+		switch p.tok.typ {
+		case tokenLParen:
+			return p.parsePrimary(field)
+		case tokenLBracket, tokenLBrace:
+			return p.parseRange(field)
+		case tokenWord, tokenPhrase:
+			return p.parseValue(field)
+		}
+
+		return nil, p.unexpected()
+	case tokenWord, tokenPhrase:
+		return p.parseValue(field)
+	}
+
+	return nil, p.unexpected()
+}
+
+func (p *parser) parseValue(field string) (Node, error) {
+	tok := p.tok
+
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	if tok.typ == tokenPhrase {
+		return Term{Field: field, Value: tok.value, Phrase: true}, nil
+	}
+
+	if tok.raw == "*" {
+		if field == "" {
+			return MatchAll{}, nil
+		}
+
+		return Exists{Field: field}, nil
+	}
+
+	if field != "" {
+		for _, op := range []string{">=", "<=", ">", "<"} {
+			if !strings.HasPrefix(tok.raw, op) || len(tok.raw) == len(op) {
+				continue
+			}
+
+			value := tok.value[len(op):]
+
+			switch op {
+			case ">=":
+				return Range{Field: field, From: value, IncludeFrom: true}, nil
+			case "<=":
+				return Range{Field: field, To: value, IncludeTo: true}, nil
+			case ">":
+				return Range{Field: field, From: value}, nil
+			default:
+				return Range{Field: field, To: value}, nil
+			}
+		}
+	}
+
+	if hasWildcard(tok.raw) {
+		return Wildcard{Field: field, Pattern: wildcardPattern(tok.raw)}, nil
+	}
+
+	return Term{Field: field, Value: tok.value}, nil
+}
+
+func (p *parser) parseRange(field string) (Node, error) {
+	r := Range{
+		Field:       field,
+		IncludeFrom: p.tok.typ == tokenLBracket,
+	}
+
+	// bounds are always values
+	p.lexer.value = true
+
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	from, err := p.parseBound()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.tok.typ != tokenTo {
+		return nil, p.unexpected()
+	}
+
+	p.lexer.value = true
+
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	to, err := p.parseBound()
+	if err != nil {
+		return nil, err
+	}
+
+	switch p.tok.typ {
+	case tokenRBracket:
+		r.IncludeTo = true
+	case tokenRBrace:
+	default:
+		return nil, p.unexpected()
+	}
+
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	r.From = from
+	r.To = to
+
+	if from == "" {
+		r.IncludeFrom = false
+	}
+
+	if to == "" {
+		r.IncludeTo = false
+	}
+
+	return r, nil
+}
+
+func (p *parser) parseBound() (string, error) {
+	tok := p.tok
+
+	if tok.typ != tokenWord && tok.typ != tokenPhrase {
+		return "", p.unexpected()
+	}
+
+	// TO isn't a value
+	if tok.typ == tokenWord && tok.raw == "TO" {
+		return "", p.unexpected()
+	}
+
+	if err := p.advance(); err != nil {
+		return "", err
+	}
+
+	if tok.typ == tokenWord && tok.raw == "*" {
+		return "", nil
+	}
+
+	return tok.value, nil
+}
+
+// hasWildcard returns true when the raw value contains an unescaped * or ?.
+func hasWildcard(raw string) bool {
+	escaped := false
+
+	for _, r := range raw {
+		if escaped {
+			escaped = false
+		} else if r == '\\' {
+			escaped = true
+		} else if r == '*' || r == '?' {
+			return true
+		}
+	}
+
+	return false
+}
+
+// wildcardPattern keeps the escapes of wildcard characters and backslashes,
+// other characters are unescaped.
+func wildcardPattern(raw string) string {
+	pattern := []rune{}
+	escaped := false
+
+	for _, r := range raw {
+		if escaped {
+			if r == '*' || r == '?' || r == '\\' {
+				pattern = append(pattern, '\\')
+			}
+
+			pattern = append(pattern, r)
+			escaped = false
+		} else if r == '\\' {
+			escaped = true
+		} else {
+			pattern = append(pattern, r)
+		}
+	}
+
+	return string(pattern)
+}
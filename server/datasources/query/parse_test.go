@@ -0,0 +1,87 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		query string
+		want  Node
+	}{
+		{"", MatchAll{}},
+		{"*", MatchAll{}},
+		{"alice", Term{Value: "alice"}},
+		{`"a phrase"`, Term{Value: "a phrase", Phrase: true}},
+		{"user:alice", Term{Field: "user", Value: "alice"}},
+		{`user:"alice smith"`, Term{Field: "user", Value: "alice smith", Phrase: true}},
+		{`host:"x\"y"`, Term{Field: "host", Value: `x"y`, Phrase: true}},
+		{"ip:10.0.0.1", Term{Field: "ip", Value: "10.0.0.1"}},
+		{"a:b:c", Term{Field: "a", Value: "b:c"}},
+		{`url:http\://x`, Term{Field: "url", Value: "http://x"}},
+		{"user:al*", Wildcard{Field: "user", Pattern: "al*"}},
+		{`user:a\*b?`, Wildcard{Field: "user", Pattern: `a\*b?`}},
+		{"user:*", Exists{Field: "user"}},
+		{"n:[1 TO 5]", Range{Field: "n", From: "1", IncludeFrom: true, To: "5", IncludeTo: true}},
+		{"n:{1 TO *]", Range{Field: "n", From: "1"}},
+		{"n:>5", Range{Field: "n", From: "5"}},
+		{"n:>=5", Range{Field: "n", From: "5", IncludeFrom: true}},
+		{"n:<5", Range{Field: "n", To: "5"}},
+		{"n:<=5", Range{Field: "n", To: "5", IncludeTo: true}},
+		{"user:(a OR b)", Or{[]Node{
+			Term{Field: "user", Value: "a"},
+			Term{Field: "user", Value: "b"},
+		}}},
+		{"a b", And{[]Node{
+			Term{Value: "a"},
+			Term{Value: "b"},
+		}}},
+		{"a AND b OR c", Or{[]Node{
+			And{[]Node{Term{Value: "a"}, Term{Value: "b"}}},
+			Term{Value: "c"},
+		}}},
+		{"-a", Not{Term{Value: "a"}}},
+		{"NOT a AND b", And{[]Node{
+			Not{Term{Value: "a"}},
+			Term{Value: "b"},
+		}}},
+		{"a && (b || !c)", And{[]Node{
+			Term{Value: "a"},
+			Or{[]Node{Term{Value: "b"}, Not{Term{Value: "c"}}}},
+		}}},
+	}
+
+	for _, tt := range tests {
+		got, err := Parse(tt.query)
+		if err != nil {
+			t.Errorf("Parse(%q): %s", tt.query, err.Error())
+		} else if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q) = %#v, want %#v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestParseError(t *testing.T) {
+	tests := []struct {
+		query    string
+		position int
+	}{
+		{"a OR", 4},
+		{"(a", 2},
+		{"user:", 5},
+		{"n:[1 5]", 5},
+		{"AND", 0},
+	}
+
+	for _, tt := range tests {
+		_, err := Parse(tt.query)
+		if err == nil {
+			t.Errorf("Parse(%q): expected error", tt.query)
+		} else if perr, ok := err.(*ParseError); !ok {
+			t.Errorf("Parse(%q): expected parse error, got %#v", tt.query, err)
+		} else if perr.Pos != tt.position {
+			t.Errorf("Parse(%q): error at %d, want %d", tt.query, perr.Pos, tt.position)
+		}
+	}
+}
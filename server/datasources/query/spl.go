@@ -0,0 +1,137 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+)
+
+var splEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// SPL translates the query to a Splunk search, without the search command.
+func SPL(n Node) string {
+	switch n := n.(type) {
+	case MatchAll:
+		return "*"
+	case And:
+		return splJoin(n.Nodes, " AND ")
+	case Or:
+		if len(n.Nodes) == 0 {
+			return "NOT *"
+		}
+
+		return splJoin(n.Nodes, " OR ")
+	case Not:
+		return "NOT " + splGroup(n.Node)
+	case Term:
+		value := `"` + splEscaper.Replace(n.Value) + `"`
+		if n.Field == "" {
+			return value
+		}
+
+		return splField(n.Field) + "=" + value
+	case Wildcard:
+		// splunk only supports *, literal wildcards can't be expressed
+		pattern := []rune{}
+		escaped := false
+
+		for _, r := range n.Pattern {
+			if escaped {
+				pattern = append(pattern, r)
+				escaped = false
+			} else if r == '\\' {
+				escaped = true
+			} else if r == '?' {
+				pattern = append(pattern, '*')
+			} else {
+				pattern = append(pattern, r)
+			}
+		}
+
+		value := `"` + splEscaper.Replace(string(pattern)) + `"`
+		if n.Field == "" {
+			return value
+		}
+
+		return splField(n.Field) + "=" + value
+	case Range:
+		parts := []string{}
+
+		if n.From == "" {
+		} else if n.IncludeFrom {
+			parts = append(parts, splField(n.Field)+">="+splValue(n.From))
+		} else {
+			parts = append(parts, splField(n.Field)+">"+splValue(n.From))
+		}
+
+		if n.To == "" {
+		} else if n.IncludeTo {
+			parts = append(parts, splField(n.Field)+"<="+splValue(n.To))
+		} else {
+			parts = append(parts, splField(n.Field)+"<"+splValue(n.To))
+		}
+
+		if len(parts) == 0 {
+			return splField(n.Field) + "=*"
+		} else if len(parts) == 1 {
+			return parts[0]
+		}
+
+		return "(" + strings.Join(parts, " AND ") + ")"
+	case Exists:
+		return splField(n.Field) + "=*"
+	}
+
+	panic(fmt.Sprintf("query: unknown node %T", n))
+}
+
+// splField quotes field names containing other characters than letters,
+// digits, underscores and dots.
+func splField(field string) string {
+	for _, r := range field {
+		if r == '_' || r == '.' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			continue
+		}
+
+		return `'` + strings.Replace(field, `'`, `\'`, -1) + `'`
+	}
+
+	return field
+}
+
+// splValue doesn't quote numbers, so they are compared numerically.
+func splValue(v string) string {
+	numeric := v != ""
+
+	for i, r := range v {
+		if (r >= '0' && r <= '9') || r == '.' || (i == 0 && r == '-') {
+			continue
+		}
+
+		numeric = false
+		break
+	}
+
+	if numeric {
+		return v
+	}
+
+	return `"` + splEscaper.Replace(v) + `"`
+}
+
+func splGroup(n Node) string {
+	switch n := n.(type) {
+	case And, Or, Not:
+		return "(" + SPL(n) + ")"
+	}
+
+	return SPL(n)
+}
+
+func splJoin(nodes []Node, sep string) string {
+	parts := make([]string, len(nodes))
+	for i, n := range nodes {
+		parts[i] = splGroup(n)
+	}
+
+	return strings.Join(parts, sep)
+}
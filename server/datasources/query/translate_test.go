@@ -0,0 +1,109 @@
+package query
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestLucene(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"*", "*:*"},
+		{"alice", "alice"},
+		{"user:alice", "user:alice"},
+		{`user:"alice smith"`, `user:"alice smith"`},
+		{`host:"x\"y"`, `host:"x\"y"`},
+		{"user:al*", "user:al*"},
+		{`user:a\*b?`, `user:a\*b?`},
+		{"user:*", "user:*"},
+		{"n:[1 TO 5]", `n:["1" TO "5"]`},
+		{"n:{1 TO *]", `n:{"1" TO *]`},
+		{"n:<=5", `n:[* TO "5"]`},
+		{"user:(a OR b)", "user:a OR user:b"},
+		{"a b", "a AND b"},
+		{"a AND b OR c", "(a AND b) OR c"},
+		{"-a", "NOT a"},
+		{"a && (b || !c)", "a AND (b OR (NOT c))"},
+		{"a:b:c", `a:b\:c`},
+		{"t:2020-01-01", `t:2020\-01\-01`},
+		{`url:http\://x`, `url:http\:\/\/x`},
+	}
+
+	for _, tt := range tests {
+		n, err := Parse(tt.query)
+		if err != nil {
+			t.Fatalf("Parse(%q): %s", tt.query, err.Error())
+		}
+
+		if got := Lucene(n); got != tt.want {
+			t.Errorf("Lucene(%q) = %s, want %s", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestSPL(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"*", "*"},
+		{"alice", `"alice"`},
+		{"user:alice", `user="alice"`},
+		{`user:"alice smith"`, `user="alice smith"`},
+		{`host:"x\"y"`, `host="x\"y"`},
+		{"user:al*", `user="al*"`},
+		{`user:a\*b?`, `user="a*b*"`},
+		{"user:*", "user=*"},
+		{"n:[1 TO 5]", "(n>=1 AND n<=5)"},
+		{"n:{1 TO *]", "n>1"},
+		{"n:<=5", "n<=5"},
+		{"user:(a OR b)", `user="a" OR user="b"`},
+		{"a AND b OR c", `("a" AND "b") OR "c"`},
+		{"-a", `NOT "a"`},
+	}
+
+	for _, tt := range tests {
+		n, err := Parse(tt.query)
+		if err != nil {
+			t.Fatalf("Parse(%q): %s", tt.query, err.Error())
+		}
+
+		if got := SPL(n); got != tt.want {
+			t.Errorf("SPL(%q) = %s, want %s", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestElastic(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"*", `{"match_all":{}}`},
+		{"user:alice", `{"match":{"user":{"operator":"and","query":"alice"}}}`},
+		{`user:"alice smith"`, `{"match_phrase":{"user":"alice smith"}}`},
+		{"user:al*", `{"wildcard":{"user":{"value":"al*"}}}`},
+		{"user:*", `{"exists":{"field":"user"}}`},
+		{"n:[1 TO 5]", `{"range":{"n":{"gte":"1","lte":"5"}}}`},
+		{"n:>1", `{"range":{"n":{"gt":"1"}}}`},
+		{"n:<=5", `{"range":{"n":{"lte":"5"}}}`},
+	}
+
+	for _, tt := range tests {
+		n, err := Parse(tt.query)
+		if err != nil {
+			t.Fatalf("Parse(%q): %s", tt.query, err.Error())
+		}
+
+		data, err := json.Marshal(Elastic(n))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := string(data); got != tt.want {
+			t.Errorf("Elastic(%q) = %s, want %s", tt.query, got, tt.want)
+		}
+	}
+}
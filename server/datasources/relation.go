@@ -0,0 +1,27 @@
+package datasources
+
+import (
+	"time"
+)
+
+// Relation is a relationship between two values known by the datasource, like
+// a follower of a user or a transfer between addresses. The values become
+// nodes of their own, connected by an edge of the type of the relation.
+type Relation struct {
+	// Type is the type of the relationship, like follows or transfer.
+	Type string `json:"type"`
+
+	// Field is the kind of the values, like address. Values of the same
+	// field are the same node, whatever side of relations they are on.
+	Field string `json:"field"`
+
+	Source string `json:"source"`
+	Target string `json:"target"`
+
+	// Weight is the weight of the relationship, like the amount
+	// transferred. Edges sum the weights of their relations.
+	Weight float64 `json:"weight,omitempty"`
+
+	// Time is the time the relationship has been seen, if known.
+	Time *time.Time `json:"time,omitempty"`
+}
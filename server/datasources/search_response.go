@@ -24,3 +24,23 @@ func (sr *searchResponse) Item() chan Item {
 func (sr *searchResponse) Error() chan error {
 	return sr.errorChan
 }
+
+// Drain reads the items and errors of the response until the datasource
+// closes it, so a canceled search doesn't block on sending them.
+func Drain(response SearchResponse) {
+	go func() {
+		itemCh, errorCh := response.Item(), response.Error()
+		for itemCh != nil || errorCh != nil {
+			select {
+			case _, ok := <-itemCh:
+				if !ok {
+					itemCh = nil
+				}
+			case _, ok := <-errorCh:
+				if !ok {
+					errorCh = nil
+				}
+			}
+		}
+	}()
+}
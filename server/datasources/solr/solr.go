@@ -1,268 +1,265 @@
 package solr
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-
-	"github.com/op/go-logging"
-
 	"net/http"
 	"net/url"
+	"strings"
+
+	"github.com/op/go-logging"
 
 	"github.com/dutchcoders/marija/server/datasources"
+	"github.com/dutchcoders/marija/server/datasources/query"
 )
 
+var (
+	_ = datasources.Register("solr", New)
+)
+
+var log = logging.MustGetLogger("marija/datasources/solr")
+
+const batchSize = 100
+
 type Response struct {
-	FacetCounts struct {
-		FacetFields struct {
-		} `json:"facet_fields"`
-		FacetHeatmaps struct {
-		} `json:"facet_heatmaps"`
-		FacetIntervals struct {
-		} `json:"facet_intervals"`
-		FacetQueries struct {
-		} `json:"facet_queries"`
-		FacetRanges struct {
-		} `json:"facet_ranges"`
-	} `json:"facet_counts"`
 	Response struct {
 		Docs     []map[string]interface{} `json:"docs"`
 		NumFound int64                    `json:"numFound"`
 		Start    int64                    `json:"start"`
 	} `json:"response"`
 	ResponseHeader struct {
-		Params struct {
-			Facet string `json:"facet"`
-			Q     string `json:"q"`
-			Rows  string `json:"rows"`
-			Wt    string `json:"wt"`
-		} `json:"params"`
-		QTime       int64
-		Status      int64 `json:"status"`
-		ZkConnected bool  `json:"zkConnected"`
+		QTime  int64
+		Status int64 `json:"status"`
 	} `json:"responseHeader"`
+	Error *struct {
+		Code int64  `json:"code"`
+		Msg  string `json:"msg"`
+	} `json:"error"`
 }
 
-var log = logging.MustGetLogger("marija/datasources/elasticsearch")
+type SchemaFieldsResponse struct {
+	Fields []struct {
+		Name string `json:"name"`
+		Type string `json:"type"`
+	} `json:"fields"`
+}
 
-type Solr struct {
+func New(options ...func(datasources.Index) error) (datasources.Index, error) {
+	s := Solr{
+		Config: Config{
+			IDField: "id",
+		},
+	}
+
+	for _, optionFn := range options {
+		optionFn(&s)
+	}
+
+	s.client = &http.Client{}
+
+	return &s, nil
+}
+
+type Config struct {
+	// URL is the url of the core or collection.
 	URL url.URL
 
 	Username string
 	Password string
+
+	// IDField is the unique key of the documents.
+	IDField string
+}
+
+// Solr is a datasource for a Solr core or collection, queries are in the
+// Lucene syntax of the standard query parser.
+type Solr struct {
+	Config
+
+	client *http.Client
+}
+
+func (m *Solr) Type() string {
+	return "solr"
 }
 
 func (m *Solr) UnmarshalTOML(p interface{}) error {
 	data, _ := p.(map[string]interface{})
 
-	username := ""
 	if v, ok := data["username"]; !ok {
 	} else if v, ok := v.(string); !ok {
 	} else {
-		username = v
+		m.Username = v
 	}
 
-	password := ""
 	if v, ok := data["password"]; !ok {
 	} else if v, ok := v.(string); !ok {
 	} else {
-		password = v
+		m.Password = v
 	}
 
-	_ = username
-	_ = password
+	if v, ok := data["id-field"]; !ok {
+	} else if v, ok := v.(string); !ok {
+	} else {
+		m.IDField = v
+	}
 
 	if v, ok := data["url"]; !ok {
 	} else if v, ok := v.(string); !ok {
 	} else if u, err := url.Parse(v); err != nil {
 		return err
 	} else {
-		m.URL = *u
-
-		u.Path = ""
-
-		/*
-			errorlog := log2.New(os.Stdout, "APP ", log2.LstdFlags)
-			params := []elastic.ClientOptionFunc{
-				elastic.SetURL(u.String()),
-				elastic.SetSniff(false),
-				elastic.SetErrorLog(errorlog),
-			}
-
-			if username != "" {
-				params = append(params, elastic.SetBasicAuth(username, password))
-			}
+		// relative paths resolve against the core
+		if !strings.HasSuffix(u.Path, "/") {
+			u.Path += "/"
+		}
 
-			if client, err := elastic.NewClient(
-				params...,
-			); err != nil {
-				return fmt.Errorf("Error connecting to: %s: %s", u.String(), err)
-			} else {
-				m.client = client
-			}
-		*/
+		m.URL = *u
 	}
 
 	return nil
 }
 
-func (i *Solr) Search(so datasources.SearchOptions) ([]datasources.Item, int, error) {
-	size := 200
-	if so.Size > 0 {
-		size = so.Size
-	}
+// Translate returns the Lucene query for the query tree.
+func (i *Solr) Translate(n query.Node) string {
+	return query.Lucene(n)
+}
 
-	rel, err := url.Parse(fmt.Sprintf("select?indent=on&q=%s&wt=json&start=%d&rows=%d", so.Query, so.From, size))
+// get requests the path relative to the core and decodes the json response
+// into v.
+func (i *Solr) get(ctx context.Context, path string, params url.Values, v interface{}) error {
+	rel, err := url.Parse(path)
 	if err != nil {
-		return []datasources.Item{}, 0, err
+		return err
 	}
 
+	params.Set("wt", "json")
+	rel.RawQuery = params.Encode()
+
 	u := i.URL.ResolveReference(rel)
 
-	resp, err := http.DefaultClient.Get(u.String())
+	req, err := http.NewRequest("GET", u.String(), nil)
 	if err != nil {
-		return []datasources.Item{}, 0, err
+		return err
 	}
 
-	response := Response{}
+	if i.Username != "" {
+		req.SetBasicAuth(i.Username, i.Password)
+	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return []datasources.Item{}, 0, err
+	resp, err := i.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
 	}
 
-	items := make([]datasources.Item, len(response.Response.Docs))
-	for i, doc := range response.Response.Docs {
+	defer resp.Body.Close()
 
-		items[i] = datasources.Item{
-			ID:     doc["md5_name"].(string),
-			Fields: doc,
-		}
+	if resp.StatusCode == http.StatusOK {
+		return json.NewDecoder(resp.Body).Decode(v)
+	}
+
+	response := Response{}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil || response.Error == nil {
+		return fmt.Errorf("Solr error: %s", http.StatusText(resp.StatusCode))
 	}
 
-	return items, int(response.Response.NumFound), nil
-	/*
-		q := elastic.NewQueryStringQuery(so.Query)
-		results, err := i.client.Search().
-			Index(index).
-			Highlight(hl).
-			Query(q).
-			From(so.From).Size(so.Size).
-			Do(context.Background())
-		if err != nil {
-			return nil, 0, err
+	return fmt.Errorf("Solr error: %s", response.Error.Msg)
+}
+
+func (i *Solr) Search(ctx context.Context, so datasources.SearchOptions) datasources.SearchResponse {
+	itemCh := make(chan datasources.Item)
+	errorCh := make(chan error)
+
+	go func() {
+		defer close(itemCh)
+		defer close(errorCh)
+
+		q := so.Query
+		if so.Expr != nil {
+			q = i.Translate(so.Expr)
 		}
 
-		log.Debugf("%#v\n", results)
+		if q == "" {
+			q = "*:*"
+		}
+
+		log.Debugf("Search query=%s", q)
+
+		offset := so.From
 
-		items := make([]datasources.Item, len(results.Hits.Hits))
-		for i, hit := range results.Hits.Hits {
-			var fields map[string]interface{}
-			if err := json.Unmarshal(*hit.Source, &fields); err != nil {
-				continue
+		for {
+			count := batchSize
+			if so.Size > 0 && so.From+so.Size-offset < count {
+				count = so.From + so.Size - offset
 			}
 
-			items[i] = datasources.Item{
-				ID:        hit.Id,
-				Fields:    fields,
-				Highlight: hit.Highlight,
+			if count <= 0 {
+				return
 			}
-		}
 
-		return items, int(results.Hits.TotalHits), nil
-	*/
-}
+			params := url.Values{}
+			params.Set("q", q)
+			params.Set("start", fmt.Sprintf("%d", offset))
+			params.Set("rows", fmt.Sprintf("%d", count))
+
+			response := Response{}
+			if err := i.get(ctx, "select", params, &response); ctx.Err() != nil {
+				return
+			} else if err != nil {
+				errorCh <- err
+				return
+			}
+
+			for _, doc := range response.Response.Docs {
+				id := ""
+				if v, ok := doc[i.IDField]; ok {
+					id = fmt.Sprintf("%v", v)
+				}
 
-func flatten(root string, m map[string]interface{}) (fields []datasources.Field) {
-	for k, v := range m {
-		if k == "mappings" {
-			fields = append(fields, flatten(root, v.(map[string]interface{}))...)
-		} else if k == "properties" {
-			fields = append(fields, flatten(root, v.(map[string]interface{}))...)
-		} else if k == "fields" {
-			fields = append(fields, flatten(root, v.(map[string]interface{}))...)
-		} else {
-			if v2, ok := v.(map[string]interface{}); ok {
-				key := k
-				if root != "" {
-					key = root + "." + key
+				select {
+				case itemCh <- datasources.Item{
+					ID:     id,
+					Fields: doc,
+				}:
+				case <-ctx.Done():
+					return
 				}
-				fields = append(fields, flatten(key, v2)...)
-			} else if k == "type" {
-				fields = append(fields, datasources.Field{
-					Path: root,
-					Type: v.(string),
-				})
+			}
+
+			offset += len(response.Response.Docs)
+
+			if len(response.Response.Docs) == 0 || int64(offset) >= response.Response.NumFound {
+				return
 			}
 		}
-	}
+	}()
 
-	return
+	return datasources.NewSearchResponse(
+		itemCh,
+		errorCh,
+	)
 }
 
-func (i *Solr) Fields() (fields []datasources.Field, err error) {
-	/*
-		index := path.Base(i.URL.Path)
-		log.Debug("Using index: ", path.Base(i.URL.Path))
-
-		mapping, err := i.client.GetMapping().
-			Index(index).
-			Do(context.Background())
+// GetFields returns the fields of the schema, internal fields like
+// _version_ are left out.
+func (i *Solr) GetFields(ctx context.Context) ([]datasources.Field, error) {
+	response := SchemaFieldsResponse{}
+	if err := i.get(ctx, "schema/fields", url.Values{}, &response); err != nil {
+		return nil, fmt.Errorf("Error retrieving fields: %s", err.Error())
+	}
 
-		if err != nil {
-			return nil, fmt.Errorf("Error retrieving fields for index: %s: %s", index, err.Error())
+	fields := []datasources.Field{}
+	for _, f := range response.Fields {
+		if strings.HasPrefix(f.Name, "_") {
+			continue
 		}
 
-		mapping = mapping[index].(map[string]interface{})
-		mapping = mapping["mappings"].(map[string]interface{})
-		for _, v := range mapping {
-			// types
-			fields = append(fields, flatten("", v.(map[string]interface{}))...)
-		}
-	*/
-	fields = append(fields, datasources.Field{
-		Path: "nlp_keywords",
-		Type: "string",
-	})
-
-	fields = append(fields, datasources.Field{
-		Path: "email_from_string",
-		Type: "string",
-	})
-
-	fields = append(fields, datasources.Field{
-		Path: "email_cc_string",
-		Type: "string",
-	})
-
-	fields = append(fields, datasources.Field{
-		Path: "type",
-		Type: "string",
-	})
-
-	fields = append(fields, datasources.Field{
-		Path: "email_to_string",
-		Type: "string",
-	})
-
-	fields = append(fields, datasources.Field{
-		Path: "email_bcc_string",
-		Type: "string",
-	})
-
-	fields = append(fields, datasources.Field{
-		Path: "file_name",
-		Type: "string",
-	})
-
-	fields = append(fields, datasources.Field{
-		Path: "GDPR_EMAIL",
-		Type: "string",
-	})
-
-	fields = append(fields, datasources.Field{
-		Path: "GDPR_NAME",
-		Type: "string",
-	})
-
-	return
+		fields = append(fields, datasources.Field{
+			Path: f.Name,
+			Type: f.Type,
+		})
+	}
+
+	return fields, nil
 }
@@ -0,0 +1,244 @@
+package solr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/dutchcoders/marija/server/datasources"
+	"github.com/dutchcoders/marija/server/datasources/query"
+)
+
+// stub is a core of n documents, recording the parameters of the selects.
+type stub struct {
+	n int
+
+	m       sync.Mutex
+	selects []url.Values
+}
+
+func (s *stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.URL.Path {
+	case "/solr/core/select":
+		s.m.Lock()
+		s.selects = append(s.selects, r.URL.Query())
+		s.m.Unlock()
+
+		if r.URL.Query().Get("q") == "bad" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":{"msg":"undefined field bad","code":400}}`)
+			return
+		}
+
+		start, _ := strconv.Atoi(r.URL.Query().Get("start"))
+		rows, _ := strconv.Atoi(r.URL.Query().Get("rows"))
+
+		response := Response{}
+		response.Response.NumFound = int64(s.n)
+		response.Response.Start = int64(start)
+		response.Response.Docs = []map[string]interface{}{}
+
+		for i := start; i < start+rows && i < s.n; i++ {
+			response.Response.Docs = append(response.Response.Docs, map[string]interface{}{
+				"id":   fmt.Sprintf("doc%d", i),
+				"name": []string{"alice"},
+			})
+		}
+
+		json.NewEncoder(w).Encode(response)
+	case "/solr/core/schema/fields":
+		fmt.Fprint(w, `{"fields":[{"name":"_version_","type":"plong"},{"name":"id","type":"string"},{"name":"name","type":"text_general"}]}`)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newSolr(t *testing.T, n int) (*Solr, *stub) {
+	s := &stub{n: n}
+
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+
+	index, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	solr := index.(*Solr)
+	if err := solr.UnmarshalTOML(map[string]interface{}{"url": ts.URL + "/solr/core"}); err != nil {
+		t.Fatal(err)
+	}
+
+	return solr, s
+}
+
+func search(solr *Solr, so datasources.SearchOptions) ([]string, error) {
+	response := solr.Search(context.Background(), so)
+
+	ids := []string{}
+
+	var err error
+
+	itemCh, errorCh := response.Item(), response.Error()
+	for itemCh != nil || errorCh != nil {
+		select {
+		case item, ok := <-itemCh:
+			if !ok {
+				itemCh = nil
+				continue
+			}
+
+			ids = append(ids, item.ID)
+		case e, ok := <-errorCh:
+			if !ok {
+				errorCh = nil
+				continue
+			}
+
+			err = e
+		}
+	}
+
+	return ids, err
+}
+
+func TestSearch(t *testing.T) {
+	tests := []struct {
+		name    string
+		n       int
+		so      datasources.SearchOptions
+		ids     int
+		selects [][2]string
+	}{
+		{
+			name:    "native query",
+			n:       3,
+			so:      datasources.SearchOptions{Query: "name:alice"},
+			ids:     3,
+			selects: [][2]string{{"0", "100"}},
+		},
+		{
+			name:    "paged",
+			n:       250,
+			so:      datasources.SearchOptions{Query: "name:alice"},
+			ids:     250,
+			selects: [][2]string{{"0", "100"}, {"100", "100"}, {"200", "100"}},
+		},
+		{
+			name:    "limited",
+			n:       250,
+			so:      datasources.SearchOptions{Query: "name:alice", From: 50, Size: 120},
+			ids:     120,
+			selects: [][2]string{{"50", "100"}, {"150", "20"}},
+		},
+		{
+			name:    "empty",
+			n:       0,
+			so:      datasources.SearchOptions{Query: "name:bob"},
+			ids:     0,
+			selects: [][2]string{{"0", "100"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			solr, s := newSolr(t, tt.n)
+
+			ids, err := search(solr, tt.so)
+			if err != nil {
+				t.Fatal(err)
+			} else if len(ids) != tt.ids {
+				t.Errorf("Search(%q) = %d items, want %d", tt.so.Query, len(ids), tt.ids)
+			}
+
+			selects := [][2]string{}
+			for _, params := range s.selects {
+				selects = append(selects, [2]string{params.Get("start"), params.Get("rows")})
+
+				if q := params.Get("q"); q != tt.so.Query {
+					t.Errorf("Expected query %q, got %q", tt.so.Query, q)
+				}
+			}
+
+			if !reflect.DeepEqual(selects, tt.selects) {
+				t.Errorf("Search(%q) selected %v, want %v", tt.so.Query, selects, tt.selects)
+			}
+		})
+	}
+}
+
+func TestSearchTranslate(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"*", "*:*"},
+		{"name:alice AND NOT status:500", "name:alice AND (NOT status:500)"},
+		{"status:[200 TO 299]", `status:["200" TO "299"]`},
+		{`title:"a phrase"`, `title:"a phrase"`},
+	}
+
+	for _, tt := range tests {
+		solr, s := newSolr(t, 1)
+
+		expr, err := query.Parse(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := search(solr, datasources.SearchOptions{Query: tt.query, Expr: expr}); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := s.selects[0].Get("q"); got != tt.want {
+			t.Errorf("Search(%q) queried %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestSearchError(t *testing.T) {
+	solr, _ := newSolr(t, 1)
+
+	_, err := search(solr, datasources.SearchOptions{Query: "bad"})
+	if err == nil || err.Error() != "Solr error: undefined field bad" {
+		t.Errorf("Expected the error of solr, got %v", err)
+	}
+}
+
+func TestSearchID(t *testing.T) {
+	solr, _ := newSolr(t, 2)
+
+	ids, err := search(solr, datasources.SearchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(ids, []string{"doc0", "doc1"}) {
+		t.Errorf("Search() = %v, want [doc0 doc1]", ids)
+	}
+}
+
+func TestGetFields(t *testing.T) {
+	solr, _ := newSolr(t, 0)
+
+	fields, err := solr.GetFields(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []datasources.Field{
+		{Path: "id", Type: "string"},
+		{Path: "name", Type: "text_general"},
+	}
+
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("GetFields() = %v, want %v", fields, want)
+	}
+}
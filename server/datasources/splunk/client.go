@@ -19,7 +19,7 @@ var (
 var debug = false
 
 type JobResponse struct {
-	SID string `json:"sid`
+	SID string `json:"sid"`
 }
 
 type SummaryResponse struct {
@@ -99,6 +99,8 @@ func (c *Client) Do(req *http.Request, v interface{}) error {
 		return err
 	}
 
+	defer resp.Body.Close()
+
 	if debug {
 		data, _ := httputil.DumpResponse(resp, false)
 		fmt.Println(string(data))
@@ -0,0 +1,10 @@
+package splunk
+
+import (
+	"github.com/dutchcoders/marija/server/datasources/query"
+)
+
+// Translate returns the search for the query tree.
+func (i *Splunk) Translate(n query.Node) string {
+	return query.SPL(n)
+}
@@ -106,7 +106,12 @@ func (i *Splunk) Search(ctx context.Context, so datasources.SearchOptions) datas
 		data := url.Values{}
 		data.Add("output_mode", "json")
 		data.Add("rf", "*")
-		data.Add("search", fmt.Sprintf("search %s", so.Query))
+		q := so.Query
+		if so.Expr != nil {
+			q = i.Translate(so.Expr)
+		}
+
+		data.Add("search", fmt.Sprintf("search %s", q))
 
 		req, err := i.client.NewRequest("POST", "/services/search/jobs", strings.NewReader(data.Encode()))
 		if err != nil {
@@ -116,24 +121,42 @@ func (i *Splunk) Search(ctx context.Context, so datasources.SearchOptions) datas
 
 		response := JobResponse{}
 
-		if err := i.client.Do(req, &response); err != nil {
+		if err := i.client.Do(req.WithContext(ctx), &response); err != nil {
 			errorCh <- err
 			return
 		}
 
 		sid := response.SID
 
+		defer func() {
+			if ctx.Err() == nil && so.Size == 0 {
+				return
+			}
+
+			// the search has been canceled or limited, stop the job as well
+			i.cancelJob(sid)
+		}()
+
 		hits := make(chan map[string]interface{})
 
 		go func() {
 			defer close(hits)
 
-			offset := 0
+			offset := so.From
 
 			for {
+				count := i.BatchCount
+				if so.Size > 0 && so.From+so.Size-offset < count {
+					count = so.From + so.Size - offset
+				}
+
+				if count <= 0 {
+					return
+				}
+
 				data = url.Values{}
 				data.Add("output_mode", "json")
-				data.Add("count", fmt.Sprintf("%d", i.BatchCount))
+				data.Add("count", fmt.Sprintf("%d", count))
 				data.Add("offset", fmt.Sprintf("%d", offset))
 
 				req, err = i.client.NewRequest("GET", fmt.Sprintf("/services/search/jobs/%s/results/?%s", sid, data.Encode()), nil)
@@ -143,9 +166,16 @@ func (i *Splunk) Search(ctx context.Context, so datasources.SearchOptions) datas
 				}
 
 				rr := ResultsResponse{}
-				if err := i.client.Do(req, &rr); err == ErrNoContent {
-					time.Sleep(time.Second * 1)
+				if err := i.client.Do(req.WithContext(ctx), &rr); err == ErrNoContent {
+					select {
+					case <-time.After(time.Second * 1):
+					case <-ctx.Done():
+						return
+					}
+
 					continue
+				} else if ctx.Err() != nil {
+					return
 				} else if err != nil {
 					errorCh <- err
 					return
@@ -188,15 +218,16 @@ func (i *Splunk) Search(ctx context.Context, so datasources.SearchOptions) datas
 					uniqueFields[key] = true
 				}
 
-				itemCh <- datasources.Item{
+				select {
+				case itemCh <- datasources.Item{
 					ID:        "", // fields["_bkt"].(string),
 					Fields:    fields,
 					Highlight: nil,
+				}:
+				case <-ctx.Done():
 				}
 			}
 		}
-
-		return
 	}()
 
 	return datasources.NewSearchResponse(
@@ -254,7 +285,43 @@ func flatten(root string, m map[string]interface{}) (fields []datasources.Field)
 	return
 }
 
-func (i *Splunk) GetFields(context.Context) (fields []datasources.Field, err error) {
+// cancelJob cancels the search job at the server, it uses its own context as
+// the context of the search has been canceled already.
+func (i *Splunk) cancelJob(sid string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	data := url.Values{}
+	data.Add("output_mode", "json")
+	data.Add("action", "cancel")
+
+	req, err := i.client.NewRequest("POST", fmt.Sprintf("/services/search/jobs/%s/control", sid), strings.NewReader(data.Encode()))
+	if err != nil {
+		log.Errorf("Error canceling job %s: %s", sid, err.Error())
+		return
+	}
+
+	var response map[string]interface{}
+	if err := i.client.Do(req.WithContext(ctx), &response); err != nil {
+		log.Errorf("Error canceling job %s: %s", sid, err.Error())
+		return
+	}
+
+	log.Debug("Canceled job %s", sid)
+}
+
+// Ping checks whether the server can be reached using the credentials.
+func (i *Splunk) Ping(ctx context.Context) error {
+	req, err := i.client.NewRequest("GET", "/services/server/info?output_mode=json", nil)
+	if err != nil {
+		return err
+	}
+
+	var response map[string]interface{}
+	return i.client.Do(req.WithContext(ctx), &response)
+}
+
+func (i *Splunk) GetFields(ctx context.Context) (fields []datasources.Field, err error) {
 	data := url.Values{}
 	data.Add("output_mode", "json")
 	data.Add("preview", "true")
@@ -270,12 +337,20 @@ func (i *Splunk) GetFields(context.Context) (fields []datasources.Field, err err
 	}
 
 	response := JobResponse{}
-	if err := i.client.Do(req, &response); err != nil {
+	if err := i.client.Do(req.WithContext(ctx), &response); err != nil {
 		return nil, err
 	}
 
 	sid := response.SID
 
+	defer func() {
+		if ctx.Err() == nil {
+			return
+		}
+
+		i.cancelJob(sid)
+	}()
+
 	data = url.Values{}
 	data.Add("output_mode", "json")
 	data.Add("min_freq", "0")
@@ -289,8 +364,13 @@ func (i *Splunk) GetFields(context.Context) (fields []datasources.Field, err err
 
 		sr := SummaryResponse{}
 
-		if err := i.client.Do(req, &sr); err == ErrNoContent {
-			time.Sleep(time.Second * 1)
+		if err := i.client.Do(req.WithContext(ctx), &sr); err == ErrNoContent {
+			select {
+			case <-time.After(time.Second * 1):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+
 			continue
 		} else if err != nil {
 			return nil, err
@@ -308,3 +388,95 @@ func (i *Splunk) GetFields(context.Context) (fields []datasources.Field, err err
 
 	return
 }
+
+// Histogram counts the events per interval using timechart. Timechart counts
+// by event time, histograms of other fields are calculated from the results.
+func (i *Splunk) Histogram(ctx context.Context, o datasources.HistogramOptions) ([]datasources.HistogramBucket, error) {
+	if o.Field != "" && o.Field != "_time" {
+		return datasources.HistogramFromSearch(ctx, i, o)
+	}
+
+	q := o.Query
+	if o.Expr != nil {
+		q = i.Translate(o.Expr)
+	}
+
+	data := url.Values{}
+	data.Add("output_mode", "json")
+	data.Add("search", fmt.Sprintf("search %s | timechart span=%s count", q, o.Interval.String()))
+
+	req, err := i.client.NewRequest("POST", "/services/search/jobs", strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	response := JobResponse{}
+	if err := i.client.Do(req.WithContext(ctx), &response); err != nil {
+		return nil, err
+	}
+
+	sid := response.SID
+
+	defer func() {
+		if ctx.Err() == nil {
+			return
+		}
+
+		i.cancelJob(sid)
+	}()
+
+	buckets := []datasources.HistogramBucket{}
+
+	offset := 0
+
+	for {
+		data = url.Values{}
+		data.Add("output_mode", "json")
+		data.Add("count", fmt.Sprintf("%d", i.BatchCount))
+		data.Add("offset", fmt.Sprintf("%d", offset))
+
+		req, err = i.client.NewRequest("GET", fmt.Sprintf("/services/search/jobs/%s/results/?%s", sid, data.Encode()), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		rr := ResultsResponse{}
+		if err := i.client.Do(req.WithContext(ctx), &rr); err == ErrNoContent {
+			select {
+			case <-time.After(time.Second * 1):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		if len(rr.Results) == 0 {
+			break
+		}
+
+		for _, result := range rr.Results {
+			t, ok := datasources.ParseTime(result["_time"])
+			if !ok {
+				continue
+			}
+
+			count, _ := strconv.ParseInt(fmt.Sprintf("%v", result["count"]), 10, 64)
+			if count == 0 {
+				// timechart returns empty intervals as well
+				continue
+			}
+
+			buckets = append(buckets, datasources.HistogramBucket{
+				Time:  t.UTC(),
+				Count: count,
+			})
+		}
+
+		offset += len(rr.Results)
+	}
+
+	return buckets, nil
+}
@@ -0,0 +1,5 @@
+package sql
+
+import (
+	_ "github.com/lib/pq"
+)
@@ -0,0 +1,384 @@
+// Package sql implements a datasource for relational databases, like
+// PostgreSQL, MySQL and SQLite. Searches execute named query templates, the
+// rows returned are the items.
+//
+// The postgres and mysql drivers are always included, the sqlite3 driver
+// requires cgo.
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/op/go-logging"
+
+	"github.com/dutchcoders/marija/server/datasources"
+	"github.com/dutchcoders/marija/server/datasources/query"
+)
+
+var (
+	_ = datasources.Register("sql", New)
+)
+
+var log = logging.MustGetLogger("marija/datasources/sql")
+
+func New(options ...func(datasources.Index) error) (datasources.Index, error) {
+	s := SQL{}
+
+	for _, optionFn := range options {
+		optionFn(&s)
+	}
+
+	if s.Driver == "" {
+		return nil, errors.New("No driver set")
+	} else if s.DSN == "" {
+		return nil, errors.New("No dsn set")
+	} else if len(s.Queries) == 0 {
+		return nil, errors.New("No queries set")
+	}
+
+	found := false
+	for _, driver := range sql.Drivers() {
+		found = found || driver == s.Driver
+	}
+
+	if !found {
+		return nil, fmt.Errorf("Unknown driver %s, supported drivers are %s", s.Driver, strings.Join(sql.Drivers(), ", "))
+	}
+
+	db, err := sql.Open(s.Driver, s.DSN)
+	if err != nil {
+		return nil, err
+	}
+
+	s.db = db
+
+	names := []string{}
+	for name := range s.Queries {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		s.templates = append(s.templates, parseTemplate(name, s.Queries[name], placeholder(s.Driver)))
+	}
+
+	return &s, nil
+}
+
+type SQL struct {
+	Driver string
+	DSN    string
+
+	// Queries are the query templates by name, the rows of all templates
+	// are returned.
+	Queries map[string]string
+
+	db        *sql.DB
+	templates []*template
+}
+
+func (s *SQL) Type() string {
+	return "sql"
+}
+
+func (s *SQL) UnmarshalTOML(p interface{}) error {
+	data, _ := p.(map[string]interface{})
+
+	if v, ok := data["driver"]; !ok {
+	} else if v, ok := v.(string); !ok {
+	} else {
+		s.Driver = v
+	}
+
+	if v, ok := data["dsn"]; !ok {
+	} else if v, ok := v.(string); !ok {
+	} else {
+		s.DSN = v
+	}
+
+	if v, ok := data["queries"]; !ok {
+	} else if v, ok := v.(map[string]interface{}); !ok {
+	} else {
+		s.Queries = map[string]string{}
+
+		for name, q := range v {
+			if q, ok := q.(string); ok {
+				s.Queries[name] = q
+			}
+		}
+	}
+
+	return nil
+}
+
+// Translate returns the text of the terms without field in the query tree,
+// which is bound to the query parameter of the templates. The values of the
+// fields are bound to the parameters named after them.
+func (s *SQL) Translate(n query.Node) string {
+	return strings.Join(text(n), " ")
+}
+
+func (s *SQL) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// Close closes the connections to the database.
+func (s *SQL) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQL) Search(ctx context.Context, so datasources.SearchOptions) datasources.SearchResponse {
+	itemCh := make(chan datasources.Item)
+	errorCh := make(chan error)
+
+	go func() {
+		defer close(itemCh)
+		defer close(errorCh)
+
+		limit := math.MaxInt32
+		if so.Size > 0 {
+			limit = so.From + so.Size
+		}
+
+		// native queries are written in the query language as well
+		n := so.Expr
+		if n == nil {
+			var err error
+			if n, err = query.Parse(so.Query); err != nil {
+				// queries that can't be parsed are searched as phrase
+				n = query.Term{Value: so.Query, Phrase: true}
+			}
+		}
+
+		params := map[string]interface{}{
+			paramQuery: s.Translate(n),
+			paramLimit: limit,
+		}
+
+		combinations := bindings(n)
+
+		skipped, sent := 0, 0
+
+		for _, t := range s.templates {
+			executed := map[string]bool{}
+
+			for _, binding := range combinations {
+				args, ok := t.args(params, binding)
+				if !ok || executed[key(args)] {
+					continue
+				}
+
+				executed[key(args)] = true
+
+				// rows are checked against the parts of the query the
+				// template doesn't search for
+				m, err := query.NewMatcher(t.bound(n, binding))
+				if err != nil {
+					errorCh <- err
+					return
+				}
+
+				log.Debug("Executing query %s with %v", t.name, args)
+
+				err = s.rows(ctx, t, args, func(item datasources.Item) bool {
+					if !m.Match(item.Fields) {
+						return true
+					}
+
+					if skipped < so.From {
+						skipped++
+						return true
+					}
+
+					select {
+					case itemCh <- item:
+					case <-ctx.Done():
+						return false
+					}
+
+					sent++
+					return so.Size == 0 || sent < so.Size
+				})
+
+				if ctx.Err() != nil {
+					return
+				} else if err != nil {
+					errorCh <- fmt.Errorf("Error executing query %s: %s", t.name, err.Error())
+					return
+				} else if so.Size > 0 && sent >= so.Size {
+					return
+				}
+			}
+		}
+	}()
+
+	return datasources.NewSearchResponse(itemCh, errorCh)
+}
+
+// rows executes the template, calling fn with the rows as items until it
+// returns false.
+func (s *SQL) rows(ctx context.Context, t *template, args []interface{}, fn func(datasources.Item) bool) error {
+	rows, err := s.db.QueryContext(ctx, t.query, args...)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	for n := 1; rows.Next(); n++ {
+		values := make([]interface{}, len(columns))
+
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+
+		fields := map[string]interface{}{}
+		for i, column := range columns {
+			if v := value(values[i]); v != nil {
+				fields[column] = v
+			}
+		}
+
+		id := fmt.Sprintf("%s:%d", t.name, n)
+		if v, ok := fields["id"]; ok {
+			id = fmt.Sprintf("%s:%v", t.name, v)
+		}
+
+		if !fn(datasources.Item{
+			ID:     id,
+			Index:  t.name,
+			Fields: fields,
+		}) {
+			return nil
+		}
+	}
+
+	return rows.Err()
+}
+
+// value returns the value of a column, text is returned as string and times
+// are formatted as RFC3339.
+func value(v interface{}) interface{} {
+	switch v := v.(type) {
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	}
+
+	return v
+}
+
+// GetFields returns the columns of the templates, these are executed with all
+// parameters null to get their columns.
+func (s *SQL) GetFields(ctx context.Context) ([]datasources.Field, error) {
+	fields := []datasources.Field{}
+
+	seen := map[string]bool{}
+
+	for _, t := range s.templates {
+		args := make([]interface{}, len(t.params))
+		for i, param := range t.params {
+			if param == paramLimit {
+				args[i] = 0
+			}
+		}
+
+		columns, err := s.columns(ctx, t, args)
+		if err != nil {
+			return nil, fmt.Errorf("Error executing query %s: %s", t.name, err.Error())
+		}
+
+		for _, column := range columns {
+			if seen[column.Name()] {
+				continue
+			}
+
+			seen[column.Name()] = true
+
+			fields = append(fields, datasources.Field{
+				Path: column.Name(),
+				Type: fieldType(column),
+			})
+		}
+	}
+
+	return fields, nil
+}
+
+func (s *SQL) columns(ctx context.Context, t *template, args []interface{}) ([]*sql.ColumnType, error) {
+	rows, err := s.db.QueryContext(ctx, t.query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	return rows.ColumnTypes()
+}
+
+var types = map[string]string{
+	"INT":         "long",
+	"INTEGER":     "long",
+	"INT2":        "long",
+	"INT4":        "long",
+	"INT8":        "long",
+	"TINYINT":     "long",
+	"SMALLINT":    "long",
+	"MEDIUMINT":   "long",
+	"BIGINT":      "long",
+	"SERIAL":      "long",
+	"BIGSERIAL":   "long",
+	"YEAR":        "long",
+	"FLOAT":       "double",
+	"FLOAT4":      "double",
+	"FLOAT8":      "double",
+	"DOUBLE":      "double",
+	"REAL":        "double",
+	"NUMERIC":     "double",
+	"DECIMAL":     "double",
+	"BOOL":        "boolean",
+	"BOOLEAN":     "boolean",
+	"DATE":        "date",
+	"TIME":        "date",
+	"TIMETZ":      "date",
+	"DATETIME":    "date",
+	"TIMESTAMP":   "date",
+	"TIMESTAMPTZ": "date",
+}
+
+// fieldType returns the type of the field of a column, by its database type.
+// Other types are strings.
+func fieldType(column *sql.ColumnType) string {
+	typ := strings.ToUpper(column.DatabaseTypeName())
+	typ = strings.TrimPrefix(typ, "UNSIGNED ")
+
+	// sqlite returns the declared type, like DECIMAL(10,2)
+	if i := strings.Index(typ, "("); i != -1 {
+		typ = strings.TrimSpace(typ[:i])
+	}
+
+	if t, ok := types[typ]; ok {
+		return t
+	}
+
+	return "string"
+}
@@ -0,0 +1,274 @@
+//go:build cgo
+// +build cgo
+
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dutchcoders/marija/server/datasources"
+	"github.com/dutchcoders/marija/server/datasources/query"
+)
+
+const schema = `
+CREATE TABLE persons (id INTEGER PRIMARY KEY, name TEXT, email TEXT, age INTEGER);
+CREATE TABLE calls (id INTEGER PRIMARY KEY, caller TEXT, callee TEXT, started DATETIME, duration REAL);
+
+INSERT INTO persons VALUES (1, 'Alice Smith', 'alice@example.com', 34);
+INSERT INTO persons VALUES (2, 'Bob Jones', 'bob@example.com', 41);
+INSERT INTO persons VALUES (3, 'Carol Smith', NULL, 29);
+
+INSERT INTO calls VALUES (1, '0612345678', '0687654321', '2020-03-01 10:00:00', 61.5);
+INSERT INTO calls VALUES (2, '0687654321', '0611111111', '2020-03-02 11:30:00', 12);
+INSERT INTO calls VALUES (3, '0622222222', '0612345678', '2020-03-03 09:15:00', 300);
+`
+
+// newSQL returns the datasource for a new sqlite database, containing the
+// persons and calls tables.
+func newSQL(t *testing.T) *SQL {
+	dsn := filepath.Join(t.TempDir(), "cases.db")
+
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	if _, err := db.Exec(schema); err != nil {
+		t.Fatal(err)
+	}
+
+	index, err := New(func(i datasources.Index) error {
+		s := i.(*SQL)
+		s.Driver = "sqlite3"
+		s.DSN = dsn
+		s.Queries = map[string]string{
+			"persons": "SELECT id, name, email, age FROM persons WHERE name LIKE '%' || :query || '%' ORDER BY id LIMIT :limit",
+			"calls":   "SELECT id, caller, callee, started, duration FROM calls WHERE caller = :phone OR callee = :phone ORDER BY started",
+		}
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := index.(*SQL)
+	t.Cleanup(func() {
+		s.Close()
+	})
+
+	return s
+}
+
+func search(t *testing.T, s *SQL, so datasources.SearchOptions) []datasources.Item {
+	response := s.Search(context.Background(), so)
+
+	items := []datasources.Item{}
+
+	itemCh, errorCh := response.Item(), response.Error()
+	for itemCh != nil || errorCh != nil {
+		select {
+		case item, ok := <-itemCh:
+			if !ok {
+				itemCh = nil
+				continue
+			}
+
+			items = append(items, item)
+		case err, ok := <-errorCh:
+			if !ok {
+				errorCh = nil
+				continue
+			}
+
+			t.Fatal(err)
+		}
+	}
+
+	return items
+}
+
+func ids(items []datasources.Item) []string {
+	ids := []string{}
+	for _, item := range items {
+		ids = append(ids, item.ID)
+	}
+
+	return ids
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(func(i datasources.Index) error {
+		s := i.(*SQL)
+		s.Driver = "oracle"
+		s.DSN = "oracle://localhost"
+		s.Queries = map[string]string{"persons": "SELECT 1"}
+		return nil
+	})
+
+	if err == nil {
+		t.Fatal("expected error")
+	} else if !strings.Contains(err.Error(), "sqlite3") {
+		t.Fatalf("expected the supported drivers, got %s", err.Error())
+	}
+}
+
+func TestSearch(t *testing.T) {
+	s := newSQL(t)
+
+	tests := []struct {
+		query string
+		ids   []string
+	}{
+		{"Smith", []string{"persons:1", "persons:3"}},
+		{"Bob", []string{"persons:2"}},
+		{"Nobody", []string{}},
+		{"phone:0612345678", []string{"calls:1", "calls:3"}},
+		{"phone:0611111111 OR phone:0622222222", []string{"calls:2", "calls:3"}},
+		{"phone:(0612345678 OR 0622222222)", []string{"calls:1", "calls:3", "calls:3"}},
+		{"other:0612345678", []string{}},
+		{"Smith AND NOT name:Carol", []string{"persons:1"}},
+		{"Smith AND age:[30 TO 40]", []string{"persons:1"}},
+		{"name:Sm*", []string{"persons:1", "persons:3"}},
+		{"email:*", []string{"persons:1", "persons:2"}},
+		{"phone:0612345678 AND NOT caller:0622222222", []string{"calls:1"}},
+		{"phone:0612345678 AND duration:>100", []string{"calls:3"}},
+		{"phone:0612345678 AND Smith", []string{}},
+		{"Smith (", []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if got := ids(search(t, s, datasources.SearchOptions{Query: tt.query})); !reflect.DeepEqual(got, tt.ids) {
+				t.Fatalf("Expected %v, got %v", tt.ids, got)
+			}
+		})
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	s := newSQL(t)
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"Smith", "Smith"},
+		{`"Alice Smith" OR Bob`, "Alice Smith Bob"},
+		{"Smith AND NOT Carol", "Smith"},
+		{"name:Smith", ""},
+		{"*", ""},
+	}
+
+	for _, tt := range tests {
+		n, err := query.Parse(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := s.Translate(n); got != tt.want {
+			t.Errorf("Translate(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestSearchFields(t *testing.T) {
+	s := newSQL(t)
+
+	items := search(t, s, datasources.SearchOptions{Query: "phone:0687654321"})
+
+	expected := []datasources.Item{
+		{
+			ID:    "calls:1",
+			Index: "calls",
+			Fields: map[string]interface{}{
+				"id":       int64(1),
+				"caller":   "0612345678",
+				"callee":   "0687654321",
+				"started":  "2020-03-01T10:00:00Z",
+				"duration": 61.5,
+			},
+		},
+		{
+			ID:    "calls:2",
+			Index: "calls",
+			Fields: map[string]interface{}{
+				"id":       int64(2),
+				"caller":   "0687654321",
+				"callee":   "0611111111",
+				"started":  "2020-03-02T11:30:00Z",
+				"duration": float64(12),
+			},
+		},
+	}
+
+	if !reflect.DeepEqual(items, expected) {
+		t.Fatalf("Expected %#v, got %#v", expected, items)
+	}
+
+	// null columns are left out
+	items = search(t, s, datasources.SearchOptions{Query: "Carol"})
+
+	if len(items) != 1 {
+		t.Fatalf("Expected 1 item, got %d", len(items))
+	} else if _, ok := items[0].Fields["email"]; ok {
+		t.Fatalf("Expected no email, got %v", items[0].Fields)
+	} else if items[0].Fields["age"] != int64(29) {
+		t.Fatalf("Expected age 29, got %#v", items[0].Fields["age"])
+	}
+}
+
+func TestSearchPaging(t *testing.T) {
+	s := newSQL(t)
+
+	tests := []struct {
+		from, size int
+		ids        []string
+	}{
+		{0, 0, []string{"persons:1", "persons:2", "persons:3"}},
+		{0, 2, []string{"persons:1", "persons:2"}},
+		{1, 1, []string{"persons:2"}},
+		{2, 5, []string{"persons:3"}},
+		{3, 5, []string{}},
+	}
+
+	for _, tt := range tests {
+		// the empty query matches all persons
+		got := ids(search(t, s, datasources.SearchOptions{From: tt.from, Size: tt.size}))
+
+		if !reflect.DeepEqual(got, tt.ids) {
+			t.Errorf("From %d, size %d: expected %v, got %v", tt.from, tt.size, tt.ids, got)
+		}
+	}
+}
+
+func TestGetFields(t *testing.T) {
+	s := newSQL(t)
+
+	fields, err := s.GetFields(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []datasources.Field{
+		{Path: "id", Type: "long"},
+		{Path: "caller", Type: "string"},
+		{Path: "callee", Type: "string"},
+		{Path: "started", Type: "date"},
+		{Path: "duration", Type: "double"},
+		{Path: "name", Type: "string"},
+		{Path: "email", Type: "string"},
+		{Path: "age", Type: "long"},
+	}
+
+	if !reflect.DeepEqual(fields, expected) {
+		t.Fatalf("Expected %v, got %v", expected, fields)
+	}
+}
@@ -0,0 +1,244 @@
+package sql
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/dutchcoders/marija/server/datasources/query"
+)
+
+// Parameters bound for every search, other parameters are bound to the values
+// of the fields in the query. The query parameter is the text of the terms
+// without field.
+const (
+	paramQuery = "query"
+	paramLimit = "limit"
+)
+
+// Maximum number of combinations of parameters a template is executed with.
+const maxBindings = 100
+
+// template is a query with named parameters like :email, which are replaced
+// by the placeholders of the driver.
+type template struct {
+	name string
+
+	query  string
+	params []string
+}
+
+// parseTemplate replaces the named parameters of the query by placeholders,
+// names within quotes and casts like ::text are left alone.
+func parseTemplate(name, s string, placeholder func(int) string) *template {
+	t := &template{
+		name: name,
+	}
+
+	runes := []rune(s)
+	quote := rune(0)
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		if quote != 0 {
+			if r == quote {
+				quote = 0
+			}
+
+			t.query += string(r)
+			continue
+		}
+
+		if r == '\'' || r == '"' || r == '`' {
+			quote = r
+		} else if r == ':' && i+1 < len(runes) && runes[i+1] == ':' {
+			t.query += "::"
+			i++
+			continue
+		} else if r == ':' && i+1 < len(runes) && isParamStart(runes[i+1]) {
+			j := i + 1
+			for j < len(runes) && isParam(runes[j]) {
+				j++
+			}
+
+			t.params = append(t.params, string(runes[i+1:j]))
+			t.query += placeholder(len(t.params))
+
+			i = j - 1
+			continue
+		}
+
+		t.query += string(r)
+	}
+
+	return t
+}
+
+func isParamStart(r rune) bool {
+	return unicode.IsLetter(r) || r == '_'
+}
+
+func isParam(r rune) bool {
+	return isParamStart(r) || unicode.IsDigit(r)
+}
+
+// placeholder returns the placeholders of the driver, postgres numbers them.
+func placeholder(driver string) func(int) string {
+	if driver == "postgres" || driver == "pgx" {
+		return func(n int) string {
+			return fmt.Sprintf("$%d", n)
+		}
+	}
+
+	return func(int) string {
+		return "?"
+	}
+}
+
+// args returns the arguments of the template for the parameters of the
+// search and the values of the binding, it returns false when a parameter
+// hasn't been bound.
+func (t *template) args(params map[string]interface{}, binding map[string]string) ([]interface{}, bool) {
+	args := []interface{}{}
+
+	for _, param := range t.params {
+		if v, ok := params[param]; ok {
+			args = append(args, v)
+		} else if v, ok := binding[param]; ok {
+			args = append(args, v)
+		} else {
+			return nil, false
+		}
+	}
+
+	return args, true
+}
+
+// key identifies the arguments, to execute a template once per combination.
+func key(args []interface{}) string {
+	values := []string{}
+	for _, arg := range args {
+		values = append(values, fmt.Sprintf("%q", arg))
+	}
+
+	return strings.Join(values, ",")
+}
+
+// bindings returns the combinations of values of the fields in the query.
+// Terms combined using AND are bound together, terms combined using OR are
+// bound separately, so a template is executed for each of them.
+func bindings(n query.Node) []map[string]string {
+	switch n := n.(type) {
+	case query.Term:
+		if n.Field == "" {
+			break
+		}
+
+		return []map[string]string{
+			{n.Field: n.Value},
+		}
+	case query.And:
+		result := []map[string]string{{}}
+
+		for _, child := range n.Nodes {
+			combined := []map[string]string{}
+
+			for _, a := range result {
+				for _, b := range bindings(child) {
+					if len(combined) == maxBindings {
+						break
+					}
+
+					binding := map[string]string{}
+					for k, v := range a {
+						binding[k] = v
+					}
+
+					for k, v := range b {
+						binding[k] = v
+					}
+
+					combined = append(combined, binding)
+				}
+			}
+
+			result = combined
+		}
+
+		return result
+	case query.Or:
+		result := []map[string]string{}
+
+		for _, child := range n.Nodes {
+			result = append(result, bindings(child)...)
+		}
+
+		if len(result) > maxBindings {
+			result = result[:maxBindings]
+		}
+
+		return result
+	}
+
+	return []map[string]string{{}}
+}
+
+// text returns the values of the terms without field, which are bound to the
+// query parameter. Negated terms are left out.
+func text(n query.Node) []string {
+	switch n := n.(type) {
+	case query.Term:
+		if n.Field == "" {
+			return []string{n.Value}
+		}
+	case query.And:
+		values := []string{}
+		for _, child := range n.Nodes {
+			values = append(values, text(child)...)
+		}
+
+		return values
+	case query.Or:
+		values := []string{}
+		for _, child := range n.Nodes {
+			values = append(values, text(child)...)
+		}
+
+		return values
+	}
+
+	return nil
+}
+
+// bound returns the query tree the rows of the template still need to match,
+// when executed with the binding. Terms the template searches for itself,
+// using its parameters, are left to the template.
+func (t *template) bound(n query.Node, binding map[string]string) query.Node {
+	switch n := n.(type) {
+	case query.Term:
+		for _, param := range t.params {
+			if n.Field == "" && param == paramQuery {
+				return query.MatchAll{}
+			} else if n.Field != "" && param == n.Field && binding[param] == n.Value {
+				return query.MatchAll{}
+			}
+		}
+	case query.And:
+		and := query.And{}
+		for _, child := range n.Nodes {
+			and.Nodes = append(and.Nodes, t.bound(child, binding))
+		}
+
+		return and
+	case query.Or:
+		or := query.Or{}
+		for _, child := range n.Nodes {
+			or.Nodes = append(or.Nodes, t.bound(child, binding))
+		}
+
+		return or
+	}
+
+	return n
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"time"
 
 	"github.com/op/go-logging"
 
@@ -130,9 +131,22 @@ func (b *Tronscan) Search(ctx context.Context, so datasources.SearchOptions) dat
 					"tokenName":           doc.TokenName,
 				}
 
+				amount, _ := doc.Amount.(float64)
+				timestamp := time.Unix(0, doc.Timestamp*int64(time.Millisecond))
+
 				item := datasources.Item{
 					ID:     doc.TransactionHash,
 					Fields: fields,
+					Relations: []datasources.Relation{
+						{
+							Type:   "transfer",
+							Field:  "address",
+							Source: doc.TransferFromAddress,
+							Target: doc.TransferToAddress,
+							Weight: amount,
+							Time:   &timestamp,
+						},
+					},
 				}
 
 				select {
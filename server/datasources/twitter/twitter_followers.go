@@ -107,6 +107,15 @@ func (i *TwitterFollowers) Search(ctx context.Context, so datasources.SearchOpti
 				item := datasources.Item{
 					ID:     so.Query + user.ScreenName,
 					Fields: fields,
+					Relations: []datasources.Relation{
+						{
+							Type:   "follows",
+							Field:  "screen_name",
+							Source: user.ScreenName,
+							Target: so.Query,
+							Weight: 1,
+						},
+					},
 				}
 
 				select {
@@ -107,6 +107,15 @@ func (i *TwitterFriends) Search(ctx context.Context, so datasources.SearchOption
 				item := datasources.Item{
 					ID:     so.Query + user.ScreenName,
 					Fields: fields,
+					Relations: []datasources.Relation{
+						{
+							Type:   "follows",
+							Field:  "screen_name",
+							Source: so.Query,
+							Target: user.ScreenName,
+							Weight: 1,
+						},
+					},
 				}
 
 				select {
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/dghubble/go-twitter/twitter"
 	"github.com/dghubble/oauth1"
@@ -105,6 +106,8 @@ func (i *TwitterTweets) Search(ctx context.Context, so datasources.SearchOptions
 		}
 
 		for _, tweet := range search.Statuses {
+			mentions := mention.GetTags('@', strings.NewReader(tweet.Text), ':')
+
 			fields := map[string]interface{}{
 				"text":                      tweet.Text,
 				"created_at":                tweet.CreatedAt,
@@ -120,7 +123,7 @@ func (i *TwitterTweets) Search(ctx context.Context, so datasources.SearchOptions
 				"user.screen_name":   tweet.User.ScreenName,
 				"user.profile_image": tweet.User.ProfileImageURLHttps,
 				"tags":               mention.GetTags('#', strings.NewReader(tweet.Text), ':'),
-				"mentions":           mention.GetTags('@', strings.NewReader(tweet.Text), ':'),
+				"mentions":           mentions,
 			}
 
 			if tweet.Coordinates == nil {
@@ -131,8 +134,9 @@ func (i *TwitterTweets) Search(ctx context.Context, so datasources.SearchOptions
 			}
 
 			item := datasources.Item{
-				ID:     tweet.IDStr,
-				Fields: fields,
+				ID:        tweet.IDStr,
+				Fields:    fields,
+				Relations: tweetRelations(tweet, mentions),
 			}
 
 			select {
@@ -213,3 +217,38 @@ func (i *TwitterTweets) GetFields(ctx context.Context) (fields []datasources.Fie
 
 	return
 }
+
+// tweetRelations returns the relations of the user of the tweet with the users
+// mentioned and the user being replied to.
+func tweetRelations(tweet twitter.Tweet, mentions []string) []datasources.Relation {
+	var t *time.Time
+	if v, err := tweet.CreatedAtTime(); err == nil {
+		t = &v
+	}
+
+	relations := []datasources.Relation{}
+
+	for _, screenName := range mentions {
+		relations = append(relations, datasources.Relation{
+			Type:   "mentions",
+			Field:  "screen_name",
+			Source: tweet.User.ScreenName,
+			Target: screenName,
+			Weight: 1,
+			Time:   t,
+		})
+	}
+
+	if tweet.InReplyToScreenName != "" {
+		relations = append(relations, datasources.Relation{
+			Type:   "replies-to",
+			Field:  "screen_name",
+			Source: tweet.User.ScreenName,
+			Target: tweet.InReplyToScreenName,
+			Weight: 1,
+			Time:   t,
+		})
+	}
+
+	return relations
+}
@@ -0,0 +1,598 @@
+package server
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/dutchcoders/marija/server/datasources"
+)
+
+const (
+	// Maximum number of writes batched into a single transaction.
+	maxPending = 1000
+
+	// Time writes are batched before they are committed.
+	flushInterval = 100 * time.Millisecond
+)
+
+var (
+	nodesBucket    = []byte("nodes")
+	itemsBucket    = []byte("items")
+	idsBucket      = []byte("ids")
+	sessionsBucket = []byte("sessions")
+)
+
+// DiskStore is an ItemStore kept in a bolt database. The items of a node are
+// stored in the order they were added, under the key of the node and a
+// sequence number. The nodes bucket keeps the size of the nodes, when they
+// expire and when they were last used, the least recently used nodes are
+// evicted when the store holds more than maxEntries nodes or maxSize bytes.
+//
+// Writes are batched and committed together, every commit syncs the file.
+// The store keeps the sessions as well, so sessions and their items can be
+// resumed after a restart.
+type DiskStore struct {
+	db *bolt.DB
+
+	maxEntries int
+	maxSize    int64
+	ttl        time.Duration
+
+	m       sync.Mutex
+	size    int64
+	entries map[string]*list.Element
+	lru     *list.List
+
+	pending []diskWrite
+	timer   *time.Timer
+}
+
+type diskEntry struct {
+	key     string
+	size    int64
+	expires time.Time
+}
+
+// diskNode is the record of a node in the nodes bucket.
+type diskNode struct {
+	Size     int64  `json:"size"`
+	Sequence uint64 `json:"sequence"`
+	Expires  int64  `json:"expires,omitempty"`
+	Used     int64  `json:"used"`
+}
+
+// diskWrite is a write waiting to be committed, it either appends an item or
+// replaces the items of the node.
+type diskWrite struct {
+	key    string
+	items  []datasources.Item
+	append bool
+
+	queued  time.Time
+	expires int64
+}
+
+// OpenDiskStore opens or creates the disk store at path. A maxEntries, maxSize
+// or ttl of zero means no limit.
+func OpenDiskStore(path string, maxEntries int, maxSize int64, ttl time.Duration) (*DiskStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	ds := &DiskStore{
+		db:         db,
+		maxEntries: maxEntries,
+		maxSize:    maxSize,
+		ttl:        ttl,
+	}
+
+	if err := ds.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{nodesBucket, itemsBucket, idsBucket, sessionsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+
+		if err := ds.index(tx); err != nil {
+			return err
+		}
+
+		return ds.evict(tx)
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return ds, nil
+}
+
+// index builds the index of the nodes, ordered by the time they were last
+// used. Expired nodes are removed.
+func (ds *DiskStore) index(tx *bolt.Tx) error {
+	ds.size = 0
+	ds.entries = map[string]*list.Element{}
+	ds.lru = list.New()
+
+	type used struct {
+		entry *diskEntry
+		used  int64
+	}
+
+	nodes := []used{}
+	expired := []string{}
+
+	now := time.Now()
+
+	if err := tx.Bucket(nodesBucket).ForEach(func(k, v []byte) error {
+		node := diskNode{}
+		if err := json.Unmarshal(v, &node); err != nil {
+			return err
+		}
+
+		entry := &diskEntry{
+			key:  string(k),
+			size: node.Size,
+		}
+
+		if node.Expires != 0 {
+			entry.expires = time.Unix(0, node.Expires)
+		}
+
+		if !entry.expires.IsZero() && now.After(entry.expires) {
+			expired = append(expired, entry.key)
+			return nil
+		}
+
+		nodes = append(nodes, used{entry, node.Used})
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for _, key := range expired {
+		if err := ds.deleteNode(tx, key); err != nil {
+			return err
+		}
+	}
+
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nodes[i].used < nodes[j].used
+	})
+
+	for _, n := range nodes {
+		ds.entries[n.entry.key] = ds.lru.PushFront(n.entry)
+		ds.size += n.entry.size
+	}
+
+	return nil
+}
+
+// itemPrefix is the prefix of the keys of the items and ids of a node.
+func itemPrefix(key string) []byte {
+	return []byte(key + "\x00")
+}
+
+func sequenceKey(key string, seq uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, seq)
+
+	return append(itemPrefix(key), b...)
+}
+
+// keysWithPrefix returns the keys of the bucket starting with prefix.
+func keysWithPrefix(b *bolt.Bucket, prefix []byte) [][]byte {
+	keys := [][]byte{}
+
+	c := b.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		keys = append(keys, append([]byte{}, k...))
+	}
+
+	return keys
+}
+
+func (ds *DiskStore) node(tx *bolt.Tx, key string) (diskNode, bool, error) {
+	node := diskNode{}
+
+	v := tx.Bucket(nodesBucket).Get([]byte(key))
+	if v == nil {
+		return node, false, nil
+	}
+
+	err := json.Unmarshal(v, &node)
+	return node, err == nil, err
+}
+
+func (ds *DiskStore) putNode(tx *bolt.Tx, key string, node diskNode) error {
+	node.Used = time.Now().UnixNano()
+
+	data, err := json.Marshal(node)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Bucket(nodesBucket).Put([]byte(key), data); err != nil {
+		return err
+	}
+
+	expires := time.Time{}
+	if node.Expires != 0 {
+		expires = time.Unix(0, node.Expires)
+	}
+
+	if e, ok := ds.entries[key]; ok {
+		entry := e.Value.(*diskEntry)
+
+		ds.size += node.Size - entry.size
+
+		entry.size = node.Size
+		entry.expires = expires
+
+		ds.lru.MoveToFront(e)
+	} else {
+		ds.entries[key] = ds.lru.PushFront(&diskEntry{
+			key:     key,
+			size:    node.Size,
+			expires: expires,
+		})
+
+		ds.size += node.Size
+	}
+
+	return nil
+}
+
+// deleteNode removes the node and its items.
+func (ds *DiskStore) deleteNode(tx *bolt.Tx, key string) error {
+	prefix := itemPrefix(key)
+
+	for _, name := range [][]byte{itemsBucket, idsBucket} {
+		b := tx.Bucket(name)
+
+		for _, k := range keysWithPrefix(b, prefix) {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := tx.Bucket(nodesBucket).Delete([]byte(key)); err != nil {
+		return err
+	}
+
+	if e, ok := ds.entries[key]; ok {
+		ds.lru.Remove(e)
+		delete(ds.entries, key)
+
+		ds.size -= e.Value.(*diskEntry).size
+	}
+
+	return nil
+}
+
+// evict removes the least recently used nodes until the store is within its
+// limits.
+func (ds *DiskStore) evict(tx *bolt.Tx) error {
+	for ds.lru.Len() > 0 {
+		if ds.maxEntries > 0 && ds.lru.Len() > ds.maxEntries {
+		} else if ds.maxSize > 0 && ds.size > ds.maxSize {
+		} else {
+			break
+		}
+
+		if err := ds.deleteNode(tx, ds.lru.Back().Value.(*diskEntry).key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// expired returns true when the node exists, but had expired at t.
+func (ds *DiskStore) expired(key string, t time.Time) bool {
+	e, ok := ds.entries[key]
+	if !ok {
+		return false
+	}
+
+	expires := e.Value.(*diskEntry).expires
+	return !expires.IsZero() && t.After(expires)
+}
+
+// put adds the items to the node, items with the same index and id are
+// stored once.
+func (ds *DiskStore) put(tx *bolt.Tx, key string, node diskNode, items []datasources.Item, expires int64) error {
+	itemsb, idsb := tx.Bucket(itemsBucket), tx.Bucket(idsBucket)
+
+	for _, item := range items {
+		k, identified := itemKey(item)
+		if !identified {
+		} else if idsb.Get(append(itemPrefix(key), k...)) != nil {
+			continue
+		} else if err := idsb.Put(append(itemPrefix(key), k...), []byte{}); err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+
+		node.Sequence++
+
+		seq := sequenceKey(key, node.Sequence)
+		if err := itemsb.Put(seq, data); err != nil {
+			return err
+		}
+
+		node.Size += int64(len(seq) + len(data))
+	}
+
+	node.Expires = expires
+
+	return ds.putNode(tx, key, node)
+}
+
+func (ds *DiskStore) write(tx *bolt.Tx, w diskWrite) error {
+	if ds.expired(w.key, w.queued) || !w.append {
+		if err := ds.deleteNode(tx, w.key); err != nil {
+			return err
+		}
+	}
+
+	node, _, err := ds.node(tx, w.key)
+	if err != nil {
+		return err
+	}
+
+	return ds.put(tx, w.key, node, w.items, w.expires)
+}
+
+// flush commits the pending writes in a single transaction.
+func (ds *DiskStore) flush() {
+	if ds.timer != nil {
+		ds.timer.Stop()
+		ds.timer = nil
+	}
+
+	if len(ds.pending) == 0 {
+		return
+	}
+
+	pending := ds.pending
+	ds.pending = nil
+
+	if err := ds.update(func(tx *bolt.Tx) error {
+		for _, w := range pending {
+			if err := ds.write(tx, w); err != nil {
+				return err
+			}
+		}
+
+		return ds.evict(tx)
+	}); err != nil {
+		log.Errorf("Error writing to disk cache: %s", err.Error())
+	}
+}
+
+// update runs fn in a read-write transaction, the index is rebuilt when the
+// transaction has been rolled back.
+func (ds *DiskStore) update(fn func(*bolt.Tx) error) error {
+	err := ds.db.Update(fn)
+	if err == nil {
+		return nil
+	}
+
+	if ierr := ds.db.Update(ds.index); ierr != nil {
+		log.Errorf("Error indexing disk cache: %s", ierr.Error())
+	}
+
+	return err
+}
+
+// queue adds the write to the pending writes, the expiration is relative to
+// the time the write was queued.
+func (ds *DiskStore) queue(w diskWrite) {
+	w.queued = time.Now()
+
+	if ds.ttl > 0 {
+		w.expires = w.queued.Add(ds.ttl).UnixNano()
+	}
+
+	ds.pending = append(ds.pending, w)
+
+	if len(ds.pending) >= maxPending {
+		ds.flush()
+	} else if ds.timer == nil {
+		ds.timer = time.AfterFunc(flushInterval, func() {
+			ds.m.Lock()
+			defer ds.m.Unlock()
+
+			ds.flush()
+		})
+	}
+}
+
+func (ds *DiskStore) Store(key string, items []datasources.Item) {
+	ds.m.Lock()
+	defer ds.m.Unlock()
+
+	ds.queue(diskWrite{key: key, items: items})
+}
+
+func (ds *DiskStore) Append(key string, item datasources.Item) {
+	ds.m.Lock()
+	defer ds.m.Unlock()
+
+	ds.queue(diskWrite{key: key, items: []datasources.Item{item}, append: true})
+}
+
+func (ds *DiskStore) LoadOrStore(key string, value []datasources.Item) ([]datasources.Item, bool) {
+	ds.m.Lock()
+	defer ds.m.Unlock()
+
+	if items, ok := ds.load(key); ok {
+		return items, true
+	}
+
+	ds.queue(diskWrite{key: key, items: value})
+	return nil, false
+}
+
+func (ds *DiskStore) Load(key string) ([]datasources.Item, bool) {
+	ds.m.Lock()
+	defer ds.m.Unlock()
+
+	return ds.load(key)
+}
+
+// load returns the items of the node and marks it as used, the pending writes
+// are committed first.
+func (ds *DiskStore) load(key string) ([]datasources.Item, bool) {
+	ds.flush()
+
+	if _, ok := ds.entries[key]; !ok {
+		return nil, false
+	}
+
+	items := []datasources.Item{}
+
+	if err := ds.update(func(tx *bolt.Tx) error {
+		if ds.expired(key, time.Now()) {
+			items = nil
+			return ds.deleteNode(tx, key)
+		}
+
+		node, ok, err := ds.node(tx, key)
+		if err != nil {
+			return err
+		} else if !ok {
+			items = nil
+			return nil
+		}
+
+		prefix := itemPrefix(key)
+
+		c := tx.Bucket(itemsBucket).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			item := datasources.Item{}
+			if err := json.Unmarshal(v, &item); err != nil {
+				return err
+			}
+
+			items = append(items, item)
+		}
+
+		return ds.putNode(tx, key, node)
+	}); err != nil {
+		log.Errorf("Error reading from disk cache: %s", err.Error())
+		return nil, false
+	}
+
+	return items, items != nil
+}
+
+func (ds *DiskStore) Purge(prefix string) {
+	ds.m.Lock()
+	defer ds.m.Unlock()
+
+	ds.flush()
+
+	if err := ds.update(func(tx *bolt.Tx) error {
+		return ds.purge(tx, prefix)
+	}); err != nil {
+		log.Errorf("Error purging disk cache: %s", err.Error())
+	}
+}
+
+func (ds *DiskStore) purge(tx *bolt.Tx, prefix string) error {
+	keys := []string{}
+	for key := range ds.entries {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+
+	for _, key := range keys {
+		if err := ds.deleteNode(tx, key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Sessions returns the sessions kept in the store.
+func (ds *DiskStore) Sessions() ([]sessionRecord, error) {
+	records := []sessionRecord{}
+
+	err := ds.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(sessionsBucket).ForEach(func(k, v []byte) error {
+			rec := sessionRecord{}
+			if err := json.Unmarshal(v, &rec); err != nil {
+				return err
+			}
+
+			records = append(records, rec)
+			return nil
+		})
+	})
+
+	return records, err
+}
+
+func (ds *DiskStore) StoreSession(rec sessionRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	return ds.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(sessionsBucket).Put([]byte(rec.ID), data)
+	})
+}
+
+// DeleteSession removes the session and its items.
+func (ds *DiskStore) DeleteSession(id string) error {
+	ds.m.Lock()
+	defer ds.m.Unlock()
+
+	ds.flush()
+
+	return ds.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(sessionsBucket)
+
+		v := b.Get([]byte(id))
+		if v == nil {
+			return nil
+		}
+
+		rec := sessionRecord{}
+		if err := json.Unmarshal(v, &rec); err != nil {
+			return err
+		} else if rec.Prefix == "" {
+		} else if err := ds.purge(tx, rec.Prefix); err != nil {
+			return err
+		}
+
+		return b.Delete([]byte(id))
+	})
+}
+
+func (ds *DiskStore) Close() error {
+	ds.m.Lock()
+	defer ds.m.Unlock()
+
+	ds.flush()
+
+	return ds.db.Close()
+}
@@ -0,0 +1,221 @@
+package server
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dutchcoders/marija/server/datasources"
+	"github.com/dutchcoders/marija/server/messages"
+)
+
+func openDiskStore(t *testing.T, path string, maxEntries int, ttl time.Duration) *DiskStore {
+	ds, err := OpenDiskStore(path, maxEntries, 0, ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ds
+}
+
+func TestDiskStoreReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "marija.cache")
+
+	ds := openDiskStore(t, path, 0, 0)
+
+	ds.Append("a", item("index", "1"))
+	ds.Append("a", item("index", "2"))
+	ds.Store("b", []datasources.Item{item("index", "3")})
+	ds.Append("c", item("index", "4"))
+	ds.Load("a")
+
+	if err := ds.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the least recently used node is evicted when reopened with a limit
+	ds = openDiskStore(t, path, 2, 0)
+
+	want := map[string][]string{
+		"a": {"1", "2"},
+		"b": nil,
+		"c": {"4"},
+	}
+
+	for key, ids := range want {
+		if got := loadIDs(ds, key); !reflect.DeepEqual(got, ids) {
+			t.Errorf("Load(%q) = %v, want %v", key, got, ids)
+		}
+	}
+
+	// items are still stored once, and appended in order
+	ds.Append("a", item("index", "1"))
+	ds.Append("a", item("index", "5"))
+
+	if err := ds.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	ds = openDiskStore(t, path, 0, 0)
+	defer ds.Close()
+
+	if got := loadIDs(ds, "a"); !reflect.DeepEqual(got, []string{"1", "2", "5"}) {
+		t.Errorf("Load(a) = %v, want [1 2 5]", got)
+	}
+
+	items, _ := ds.Load("c")
+	if !reflect.DeepEqual(items, []datasources.Item{item("index", "4")}) {
+		t.Errorf("Load(c) = %#v, want the stored item", items)
+	}
+}
+
+func TestDiskStoreReopenExpired(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "marija.cache")
+
+	ds := openDiskStore(t, path, 0, 50*time.Millisecond)
+	ds.Append("a", item("index", "1"))
+	ds.Close()
+
+	time.Sleep(100 * time.Millisecond)
+
+	ds = openDiskStore(t, path, 0, 50*time.Millisecond)
+	defer ds.Close()
+
+	if n := len(ds.entries); n != 0 {
+		t.Errorf("Expected expired nodes to be removed, got %d nodes", n)
+	} else if ds.size != 0 {
+		t.Errorf("Expected size 0, got %d", ds.size)
+	}
+}
+
+func TestDiskStoreSize(t *testing.T) {
+	ds := openDiskStore(t, filepath.Join(t.TempDir(), "marija.cache"), 0, 0)
+	defer ds.Close()
+
+	ds.Append("a", item("index", "1"))
+	ds.Append("b", item("index", "2"))
+	ds.Append("b", item("index", "3"))
+	ds.Load("a")
+
+	first := ds.size
+
+	ds.Purge("b")
+
+	if ds.size <= 0 || ds.size >= first {
+		t.Errorf("Expected size to decrease from %d, got %d", first, ds.size)
+	}
+
+	ds.Purge("")
+
+	if ds.size != 0 || ds.lru.Len() != 0 {
+		t.Errorf("Expected an empty store, got %d nodes of %d bytes", ds.lru.Len(), ds.size)
+	}
+}
+
+func TestDiskStoreSessions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "marija.cache")
+
+	ds := openDiskStore(t, path, 0, 0)
+
+	ss := newSessions(ds, nil)
+
+	kept := ss.Create("kept", "alice")
+	kept.addHistory(messages.SearchRequest{Query: "alice"})
+	kept.state.items.Append("n", item("index", "1"))
+
+	expired := ss.Create("expired", "alice")
+	expired.state.items.Append("n", item("index", "2"))
+
+	// the items of the user are kept when sessions expire
+	user := newState(ds, userPrefix("alice"), nil)
+	user.items.Append("n", item("index", "3"))
+
+	expired.m.Lock()
+	expired.lastSeen = time.Now().Add(-time.Hour)
+	expired.m.Unlock()
+
+	ss.expire(time.Minute)
+
+	ds.Close()
+
+	// the sessions and their items are found after a restart
+	ds = openDiskStore(t, path, 0, 0)
+	defer ds.Close()
+
+	ss = newSessions(ds, nil)
+	if err := ss.load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := ss.Get(expired.ID); ok {
+		t.Error("Expected the expired session to be removed")
+	}
+
+	s, ok := ss.Get(kept.ID)
+	if !ok {
+		t.Fatal("Expected the session to be restored")
+	}
+
+	if s.Name != "kept" || s.Owner != "alice" {
+		t.Errorf("Expected session kept of alice, got %s of %s", s.Name, s.Owner)
+	} else if len(s.history) != 1 || s.history[0].Query != "alice" {
+		t.Errorf("Expected the history to be restored, got %v", s.history)
+	}
+
+	want := map[string][]string{
+		sessionPrefix(kept.ID) + "n":    {"1"},
+		sessionPrefix(expired.ID) + "n": nil,
+		userPrefix("alice") + "n":       {"3"},
+	}
+
+	for key, ids := range want {
+		if got := loadIDs(ds, key); !reflect.DeepEqual(got, ids) {
+			t.Errorf("Load(%q) = %v, want %v", key, got, ids)
+		}
+	}
+
+	// restored sessions are detached and expire
+	s.m.Lock()
+	s.lastSeen = time.Now().Add(-time.Hour)
+	s.m.Unlock()
+
+	ss.expire(time.Minute)
+
+	if records, err := ds.Sessions(); err != nil {
+		t.Fatal(err)
+	} else if len(records) != 0 {
+		t.Errorf("Expected no sessions, got %v", records)
+	}
+
+	if got := loadIDs(ds, sessionPrefix(kept.ID)+"n"); got != nil {
+		t.Errorf("Expected the items of the session to be purged, got %v", got)
+	}
+}
+
+func TestMemorySessionsExpire(t *testing.T) {
+	store := NewItemCache(0, 0, 0)
+
+	ss := newSessions(store, nil)
+
+	s := ss.Create("investigation", "alice")
+	s.state.items.Append("n", item("index", "1"))
+
+	ss.expire(time.Minute)
+
+	if got := loadIDs(s.state.items, "n"); got == nil {
+		t.Fatal("Expected the items of the session to be kept")
+	}
+
+	s.m.Lock()
+	s.lastSeen = time.Now().Add(-time.Hour)
+	s.m.Unlock()
+
+	ss.expire(time.Minute)
+
+	if _, ok := ss.Get(s.ID); ok {
+		t.Error("Expected the session to be removed")
+	} else if got := loadIDs(s.state.items, "n"); got != nil {
+		t.Errorf("Expected the items of the session to be purged, got %v", got)
+	}
+}
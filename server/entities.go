@@ -0,0 +1,151 @@
+package server
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/dutchcoders/marija/server/datasources"
+	"github.com/dutchcoders/marija/server/normalize"
+)
+
+// newEntities returns the name of the entity of every configured field.
+func (server *Server) newEntities() (map[string]string, error) {
+	entities := map[string]string{}
+
+	for _, entity := range server.Entities {
+		if entity.Name == "" {
+			return nil, errors.New("No name set for entity")
+		}
+
+		for _, field := range entity.Fields {
+			if name, ok := entities[field]; ok && name != entity.Name {
+				return nil, fmt.Errorf("Field %s belongs to entities %s and %s", field, name, entity.Name)
+			}
+
+			entities[field] = entity.Name
+		}
+	}
+
+	return entities, nil
+}
+
+// entityIndex resolves equal values of equivalent fields into shared entity
+// nodes, across the searches and datasources of a connection or session.
+type entityIndex struct {
+	m sync.Mutex
+
+	// fields are the names of the entities by field
+	fields   map[string]string
+	entities map[string]*datasources.Node
+}
+
+func newEntityIndex(fields map[string]string) *entityIndex {
+	return &entityIndex{
+		fields:   fields,
+		entities: map[string]*datasources.Node{},
+	}
+}
+
+// entity returns the name of the entity of field.
+func (ei *entityIndex) entity(field string) (string, bool) {
+	name, ok := ei.fields[field]
+	return name, ok
+}
+
+// add counts the value of the entity name found by datasource index, and
+// returns a copy of the entity node.
+func (ei *entityIndex) add(name string, value string, index string) datasources.Node {
+	values := map[string]interface{}{
+		name: value,
+	}
+
+	id := hex.EncodeToString(hashFields(values))
+
+	ei.m.Lock()
+	defer ei.m.Unlock()
+
+	node, ok := ei.entities[id]
+	if !ok {
+		node = &datasources.Node{
+			ID:         id,
+			Fields:     values,
+			Provenance: map[string]int64{},
+		}
+
+		ei.entities[id] = node
+	}
+
+	node.Count++
+	node.Provenance[index]++
+
+	// the node is copied, as it will be updated by other searches
+	copy := *node
+
+	copy.Provenance = map[string]int64{}
+	for k, v := range node.Provenance {
+		copy.Provenance[k] = v
+	}
+
+	return copy
+}
+
+// entityID returns the id of the entity node of the value of entity name.
+func entityID(name string, value string) string {
+	return hex.EncodeToString(hashFields(map[string]interface{}{
+		name: value,
+	}))
+}
+
+// resolve returns the entity nodes of the values of the fields of item that
+// belong to an entity, normalized by n, with edges from the node of the item
+// with id. Nodes in seen have been returned for the item already.
+func (c *connection) resolve(cur *cursor, index string, n *normalize.Normalizer, id string, item datasources.Item, seen map[string]bool) ([]datasources.Node, []datasources.Edge) {
+	entities := c.state().entities
+
+	fields := []string{}
+	for field := range item.Fields {
+		if _, ok := entities.entity(field); ok {
+			fields = append(fields, field)
+		}
+	}
+
+	sort.Strings(fields)
+
+	nodes := []datasources.Node{}
+	edges := []datasources.Edge{}
+
+	linked := map[string]bool{}
+
+	for _, field := range fields {
+		name, _ := entities.entity(field)
+
+		for _, value := range fieldValues(item.Fields[field]) {
+			value = n.String(field, value)
+
+			entity := entityID(name, value)
+
+			if !seen[entity] {
+				seen[entity] = true
+
+				nodes = append(nodes, entities.add(name, value, index))
+
+				c.storeItem(entity, item)
+			}
+
+			if id == "" || id == entity || linked[field+entity] {
+				continue
+			}
+
+			linked[field+entity] = true
+
+			edges = append(edges, cur.edges.add(id, entity, datasources.Relation{
+				Field: field,
+			}))
+		}
+	}
+
+	return nodes, edges
+}
@@ -0,0 +1,289 @@
+package server
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dutchcoders/marija/server/datasources"
+	"github.com/dutchcoders/marija/server/datasources/query"
+	"github.com/dutchcoders/marija/server/messages"
+	"github.com/dutchcoders/marija/server/normalize"
+	"github.com/dutchcoders/marija/server/unique"
+)
+
+// Expand searches the datasources for items sharing the values of fields with
+// the requested nodes. Nodes are identified as by a search, only nodes that
+// are new to the connection are returned. Edges to the nodes they were
+// expanded from are returned for new and known nodes.
+func (c *connection) Expand(ctx context.Context, r messages.ExpandRequest) error {
+	if len(r.Datasources) == 0 {
+		return errors.New("No datasource set")
+	} else if len(r.Nodes) == 0 {
+		return errors.New("No nodes set")
+	} else if len(r.Fields) == 0 {
+		return errors.New("No fields set")
+	}
+
+	c.audit(auditEvent{
+		Action:      "expand",
+		RequestID:   r.RequestID,
+		Datasources: r.Datasources,
+		Items:       r.Nodes,
+	})
+
+	terms := map[string][]string{}
+
+	// origins contains the originating nodes per field and value
+	origins := map[string]map[string][]string{}
+
+	for _, field := range r.Fields {
+		origins[field] = map[string][]string{}
+	}
+
+	for _, id := range r.Nodes {
+		items, ok := c.nodeItems(id)
+		if !ok {
+			continue
+		}
+
+		for _, item := range items {
+			for _, field := range r.Fields {
+				for _, value := range fieldValues(item.Fields[field]) {
+					if _, ok := origins[field][value]; !ok {
+						terms[field] = append(terms[field], value)
+					}
+
+					origins[field][value] = appendUnique(origins[field][value], id)
+				}
+			}
+		}
+	}
+
+	if len(terms) == 0 {
+		return errors.New("Could not find values for fields in nodes")
+	}
+
+	// normalizations of the request override the normalizations of the
+	// datasources, an empty list disables them
+	normalizer, err := normalize.New(r.Normalizations)
+	if err != nil {
+		return err
+	}
+
+	for _, index := range r.Datasources {
+		index := index
+
+		datasource, err := c.datasource(index)
+		if err != nil {
+			c.Send(&messages.ErrorMessage{
+				RequestID: r.RequestID,
+				Message:   err.Error(),
+			})
+
+			log.Error(err.Error())
+			continue
+		}
+
+		so := datasources.SearchOptions{}
+
+		if tr, ok := datasource.(datasources.Translator); ok {
+			so.Expr = query.Terms(r.Fields, terms)
+			so.Query = tr.Translate(so.Expr)
+		} else {
+			values := []string{}
+			for _, field := range r.Fields {
+				values = append(values, terms[field]...)
+			}
+
+			datasource = &valueSearch{
+				Index:  datasource,
+				values: values,
+			}
+
+			so.Query = strings.Join(values, " ")
+		}
+
+		log.Debug("Expand query=%s, request=%s, index=%s", so.Query, r.RequestID, index)
+
+		c.Send(&messages.SearchResponse{
+			RequestID:  r.RequestID,
+			Query:      so.Query,
+			Datasource: index,
+		})
+
+		n := normalizer
+		if r.Normalizations == nil {
+			n = c.server.normalizer(index)
+		}
+
+		unique := unique.New()
+
+		emitted := map[datasources.Edge]bool{}
+
+		c.track(r.RequestID, func() {
+			c.stream(ctx, r.RequestID, so.Query, index, datasource, so, nil, func(item datasources.Item) ([]datasources.Node, []datasources.Edge) {
+				values, ok := identity(r.Identity, n, item)
+				if !ok {
+					return nil, nil
+				}
+
+				hash := hashFields(values)
+				id := hex.EncodeToString(hash)
+
+				nodes := []datasources.Node{}
+
+				if _, ok := unique.Get(hash); !ok && c.sentGraph().has(id) {
+					// node is already known, only its edges are new
+					c.storeItem(id, item)
+				} else {
+					nodes = append(nodes, *c.node(unique, index, hash, values, item))
+				}
+
+				edges := []datasources.Edge{}
+
+				for _, field := range r.Fields {
+					for _, value := range fieldValues(item.Fields[field]) {
+						for _, source := range origins[field][value] {
+							edge := datasources.Edge{
+								Source: source,
+								Target: id,
+								Field:  field,
+							}
+
+							if source == id || emitted[edge] {
+								continue
+							}
+
+							emitted[edge] = true
+
+							edges = append(edges, edge)
+						}
+					}
+				}
+
+				return nodes, edges
+			})
+		})
+	}
+
+	return nil
+}
+
+// fieldValues returns the string representations of the value of a field,
+// multi valued fields return each of their values.
+func fieldValues(v interface{}) []string {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case string:
+		if v == "" {
+			return nil
+		}
+
+		return []string{v}
+	case []string:
+		values := []string{}
+		for _, s := range v {
+			values = append(values, fieldValues(s)...)
+		}
+
+		return values
+	case []interface{}:
+		values := []string{}
+		for _, s := range v {
+			values = append(values, fieldValues(s)...)
+		}
+
+		return values
+	default:
+		return []string{fmt.Sprintf("%v", v)}
+	}
+}
+
+func appendUnique(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+
+	return append(values, value)
+}
+
+// valueSearch searches datasources that don't support term queries for each
+// of the values, combining the results into a single response.
+type valueSearch struct {
+	datasources.Index
+
+	values []string
+}
+
+func (vs *valueSearch) Search(ctx context.Context, so datasources.SearchOptions) datasources.SearchResponse {
+	itemCh := make(chan datasources.Item)
+	errorCh := make(chan error)
+
+	go func() {
+		defer close(itemCh)
+		defer close(errorCh)
+
+		for _, value := range vs.values {
+			so.Query = value
+
+			if !vs.search(ctx, so, itemCh, errorCh) {
+				return
+			}
+		}
+	}()
+
+	return datasources.NewSearchResponse(
+		itemCh,
+		errorCh,
+	)
+}
+
+// search sends the items of the search for a single value, it returns false
+// when the search has failed or has been canceled. The response is drained,
+// so the datasource won't block sending its remaining results.
+func (vs *valueSearch) search(ctx context.Context, so datasources.SearchOptions, itemCh chan<- datasources.Item, errorCh chan<- error) bool {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	response := vs.Index.Search(ctx, so)
+	defer datasources.Drain(response)
+
+	itemsCh, errsCh := response.Item(), response.Error()
+	for itemsCh != nil || errsCh != nil {
+		select {
+		case item, ok := <-itemsCh:
+			if !ok {
+				itemsCh = nil
+				continue
+			}
+
+			select {
+			case itemCh <- item:
+			case <-ctx.Done():
+				return false
+			}
+		case err, ok := <-errsCh:
+			if !ok {
+				errsCh = nil
+				continue
+			}
+
+			select {
+			case errorCh <- err:
+			case <-ctx.Done():
+			}
+
+			return false
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dutchcoders/marija/server/datasources"
+)
+
+// testIndex returns the items of the queries, sending the errors of the
+// queries without select, like the file and sql datasources do.
+type testIndex struct {
+	items  map[string][]datasources.Item
+	errors map[string]error
+
+	wg sync.WaitGroup
+}
+
+func (ti *testIndex) Search(ctx context.Context, so datasources.SearchOptions) datasources.SearchResponse {
+	itemCh := make(chan datasources.Item)
+	errorCh := make(chan error)
+
+	ti.wg.Add(1)
+
+	go func() {
+		defer ti.wg.Done()
+
+		defer close(itemCh)
+		defer close(errorCh)
+
+		if err, ok := ti.errors[so.Query]; ok {
+			errorCh <- err
+		}
+
+		for _, item := range ti.items[so.Query] {
+			itemCh <- item
+		}
+	}()
+
+	return datasources.NewSearchResponse(itemCh, errorCh)
+}
+
+func (ti *testIndex) GetFields(ctx context.Context) ([]datasources.Field, error) {
+	return nil, nil
+}
+
+func (ti *testIndex) Type() string {
+	return "test"
+}
+
+// wait waits for the searches of the index to complete.
+func (ti *testIndex) wait(t *testing.T) {
+	done := make(chan struct{})
+
+	go func() {
+		ti.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("searches of the index are blocked")
+	}
+}
+
+func TestValueSearch(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		cancel bool
+		ids    []string
+		err    bool
+	}{
+		{"values", []string{"a", "b"}, false, []string{"a1", "a2", "b1"}, false},
+		{"error", []string{"a", "c", "b"}, false, []string{"a1", "a2"}, true},
+		{"canceled", []string{"a", "b"}, true, []string{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ti := &testIndex{
+				items: map[string][]datasources.Item{
+					"a": {{ID: "a1"}, {ID: "a2"}},
+					"b": {{ID: "b1"}},
+					"c": {{ID: "c1"}, {ID: "c2"}},
+				},
+				errors: map[string]error{
+					"c": errors.New("Search failed"),
+				},
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			if tt.cancel {
+				cancel()
+			}
+
+			vs := &valueSearch{Index: ti, values: tt.values}
+
+			response := vs.Search(ctx, datasources.SearchOptions{})
+
+			ids := []string{}
+			var err error
+
+			itemCh, errorCh := response.Item(), response.Error()
+			for itemCh != nil || errorCh != nil {
+				select {
+				case item, ok := <-itemCh:
+					if !ok {
+						itemCh = nil
+						continue
+					}
+
+					if !tt.cancel {
+						ids = append(ids, item.ID)
+					}
+				case e, ok := <-errorCh:
+					if !ok {
+						errorCh = nil
+						continue
+					}
+
+					err = e
+				}
+			}
+
+			if !reflect.DeepEqual(ids, tt.ids) {
+				t.Errorf("Expected %v, got %v", tt.ids, ids)
+			}
+
+			if tt.err && err == nil {
+				t.Error("Expected error")
+			} else if !tt.err && err != nil {
+				t.Error(err)
+			}
+
+			ti.wait(t)
+		})
+	}
+}
@@ -0,0 +1,339 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dutchcoders/marija/server/auth"
+	"github.com/dutchcoders/marija/server/datasources"
+	"github.com/dutchcoders/marija/server/export"
+	"github.com/dutchcoders/marija/server/messages"
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	// Time an export can be downloaded.
+	exportTimeout = 10 * time.Minute
+
+	// Maximum number of exports kept for download.
+	maxExports = 100
+
+	// Maximum size of an export, and of the exports kept for download
+	// together, as they are kept in memory.
+	maxExportSize  = 32 << 20
+	maxExportsSize = 256 << 20
+)
+
+var errExportTooLarge = fmt.Errorf("Export is larger than %d MB", maxExportSize>>20)
+
+// limitWriter fails writes exceeding the remaining n bytes.
+type limitWriter struct {
+	w io.Writer
+	n int
+}
+
+func (lw *limitWriter) Write(p []byte) (int, error) {
+	if len(p) > lw.n {
+		return 0, errExportTooLarge
+	}
+
+	lw.n -= len(p)
+	return lw.w.Write(p)
+}
+
+// sentGraph is the graph sent to a connection or session, kept to be
+// exported. Nodes and edges sent again replace the earlier ones.
+type sentGraph struct {
+	m sync.Mutex
+
+	nodes   map[string]datasources.Node
+	nodeIDs []string
+
+	edges    map[edgeKey]datasources.Edge
+	edgeKeys []edgeKey
+}
+
+func newSentGraph() *sentGraph {
+	return &sentGraph{
+		nodes: map[string]datasources.Node{},
+		edges: map[edgeKey]datasources.Edge{},
+	}
+}
+
+func (g *sentGraph) add(nodes []datasources.Node, edges []datasources.Edge) {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	for _, node := range nodes {
+		if _, ok := g.nodes[node.ID]; !ok {
+			g.nodeIDs = append(g.nodeIDs, node.ID)
+		}
+
+		g.nodes[node.ID] = node
+	}
+
+	for _, edge := range edges {
+		key := edgeKey{edge.Source, edge.Target, edge.Type, edge.Field}
+		if _, ok := g.edges[key]; !ok {
+			g.edgeKeys = append(g.edgeKeys, key)
+		}
+
+		g.edges[key] = edge
+	}
+}
+
+// has returns true when the node with id has been sent.
+func (g *sentGraph) has(id string) bool {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	_, ok := g.nodes[id]
+	return ok
+}
+
+// node returns the node with id that has been sent.
+func (g *sentGraph) node(id string) (datasources.Node, bool) {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	node, ok := g.nodes[id]
+	return node, ok
+}
+
+// graph returns the nodes with ids, or all nodes without ids, and the edges
+// between them.
+func (g *sentGraph) graph(ids []string) ([]datasources.Node, []datasources.Edge) {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	if len(ids) == 0 {
+		ids = g.nodeIDs
+	}
+
+	selected := map[string]bool{}
+
+	nodes := []datasources.Node{}
+	for _, id := range ids {
+		node, ok := g.nodes[id]
+		if !ok || selected[id] {
+			continue
+		}
+
+		selected[id] = true
+		nodes = append(nodes, node)
+	}
+
+	edges := []datasources.Edge{}
+	for _, key := range g.edgeKeys {
+		if selected[key.source] && selected[key.target] {
+			edges = append(edges, g.edges[key])
+		}
+	}
+
+	return nodes, edges
+}
+
+// sentGraph returns the graph sent to the connection, which is the graph of
+// the session if one is attached.
+func (c *connection) sentGraph() *sentGraph {
+	return c.state().graph
+}
+
+// derivedEdges returns edges between nodes having equal values for field, as
+// the browser connects them.
+func derivedEdges(nodes []datasources.Node, fields []string) []datasources.Edge {
+	edges := []datasources.Edge{}
+
+	for _, field := range fields {
+		ids := map[string][]string{}
+		values := []string{}
+
+		for _, node := range nodes {
+			for _, value := range fieldValues(node.Fields[field]) {
+				if _, ok := ids[value]; !ok {
+					values = append(values, value)
+				}
+
+				ids[value] = appendUnique(ids[value], node.ID)
+			}
+		}
+
+		for _, value := range values {
+			for i, source := range ids[value] {
+				for _, target := range ids[value][i+1:] {
+					edges = append(edges, datasources.Edge{
+						Source: source,
+						Target: target,
+						Field:  field,
+					})
+				}
+			}
+		}
+	}
+
+	return edges
+}
+
+type exportFile struct {
+	user        string
+	name        string
+	contentType string
+	data        []byte
+	expires     time.Time
+}
+
+// exports are the exports that can be downloaded, by token.
+type exports struct {
+	m      sync.Mutex
+	files  map[string]*exportFile
+	tokens []string
+
+	// size is the size of the exports together
+	size int
+}
+
+func newExports() *exports {
+	return &exports{
+		files: map[string]*exportFile{},
+	}
+}
+
+// expire removes the expired exports and the oldest exports when there are
+// too many or they are too large, it needs to be called with the lock held.
+func (e *exports) expire() {
+	now := time.Now()
+
+	for len(e.tokens) > 0 {
+		f := e.files[e.tokens[0]]
+		if len(e.tokens) <= maxExports && e.size <= maxExportsSize && now.Before(f.expires) {
+			break
+		}
+
+		e.size -= len(f.data)
+
+		delete(e.files, e.tokens[0])
+		e.tokens = e.tokens[1:]
+	}
+}
+
+func (e *exports) add(f *exportFile) string {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	token := uuid.NewV4().String()
+
+	f.expires = time.Now().Add(exportTimeout)
+
+	e.files[token] = f
+	e.tokens = append(e.tokens, token)
+	e.size += len(f.data)
+
+	e.expire()
+
+	return token
+}
+
+func (e *exports) get(token string) (*exportFile, bool) {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	e.expire()
+
+	f, ok := e.files[token]
+	return f, ok
+}
+
+// Export writes the graph sent to the connection, with the items of the nodes,
+// in the requested format and returns the url to download it from.
+func (c *connection) Export(ctx context.Context, r messages.ExportRequest) error {
+	if r.Format == "" {
+		return errors.New("No format set")
+	}
+
+	format, err := export.Get(r.Format)
+	if err != nil {
+		return err
+	}
+
+	nodes, edges := c.sentGraph().graph(r.Nodes)
+	if len(nodes) == 0 {
+		return errors.New("Nothing to export")
+	}
+
+	c.audit(auditEvent{
+		Action:    "export",
+		RequestID: r.RequestID,
+		Format:    r.Format,
+		Count:     auditCount(len(nodes)),
+	})
+
+	g := &export.Graph{
+		Nodes: nodes,
+		Edges: append(edges, derivedEdges(nodes, r.Fields)...),
+	}
+
+	// items of multiple nodes, like entities, are exported once
+	seen := map[string]bool{}
+
+	for _, node := range nodes {
+		items, _ := c.items(node.ID)
+
+		for _, item := range items {
+			key := item.Index + "/" + item.ID
+			if item.ID != "" && seen[key] {
+				continue
+			}
+
+			seen[key] = true
+			g.Items = append(g.Items, item)
+		}
+	}
+
+	buff := new(bytes.Buffer)
+	if err := format.Write(&limitWriter{buff, maxExportSize}, g); err != nil {
+		return err
+	}
+
+	token := c.server.exports.add(&exportFile{
+		user:        c.user.String(),
+		name:        fmt.Sprintf("marija-%s.%s", time.Now().Format("20060102-150405"), format.Extension),
+		contentType: format.ContentType,
+		data:        buff.Bytes(),
+	})
+
+	c.Send(&messages.ExportResponse{
+		RequestID: r.RequestID,
+		Format:    r.Format,
+		URL:       "/api/v1/export/" + token,
+		Nodes:     len(g.Nodes),
+		Edges:     len(g.Edges),
+	})
+
+	return nil
+}
+
+// ExportHandler downloads an export, exports can only be downloaded by the
+// user that requested them.
+func (server *Server) ExportHandler(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.URL.Path, "/api/v1/export/")
+
+	f, ok := server.exports.get(token)
+	if !ok || f.user != auth.UserFromContext(r.Context()).String() {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", f.contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", f.name))
+
+	if _, err := w.Write(f.data); err != nil {
+		log.Error("Error writing export: %s", err.Error())
+	}
+}
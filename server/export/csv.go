@@ -0,0 +1,66 @@
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+)
+
+// WriteNodesCSV writes a row per node, with a column for every field.
+func WriteNodesCSV(w io.Writer, g *Graph) error {
+	names := fields(g.Nodes)
+
+	cw := csv.NewWriter(w)
+
+	header := []string{"id", "label", "datasource", "count"}
+	if err := cw.Write(append(header, names...)); err != nil {
+		return err
+	}
+
+	for _, node := range g.Nodes {
+		record := []string{
+			node.ID,
+			label(node),
+			node.Datasource,
+			fmt.Sprintf("%d", node.Count),
+		}
+
+		for _, name := range names {
+			record = append(record, value(node.Fields[name]))
+		}
+
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteEdgesCSV writes a row per edge.
+func WriteEdgesCSV(w io.Writer, g *Graph) error {
+	cw := csv.NewWriter(w)
+
+	if err := cw.Write([]string{"source", "target", "field", "type", "count", "weight", "first-seen", "last-seen"}); err != nil {
+		return err
+	}
+
+	for _, edge := range g.Edges {
+		if err := cw.Write([]string{
+			edge.Source,
+			edge.Target,
+			edge.Field,
+			edge.Type,
+			fmt.Sprintf("%d", edge.Count),
+			formatFloat(weight(edge)),
+			formatTime(edge.FirstSeen),
+			formatTime(edge.LastSeen),
+		}); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,152 @@
+// Package export writes graphs in formats of other tools, like Gephi and yEd.
+package export
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dutchcoders/marija/server/datasources"
+)
+
+// Graph is the graph being exported, with the items of the nodes.
+type Graph struct {
+	Nodes []datasources.Node
+	Edges []datasources.Edge
+	Items []datasources.Item
+}
+
+// Format is a format a graph can be exported in.
+type Format struct {
+	Extension   string
+	ContentType string
+
+	Write func(io.Writer, *Graph) error
+}
+
+var formats = map[string]Format{
+	"gexf": {
+		Extension:   "gexf",
+		ContentType: "application/xml",
+		Write:       WriteGEXF,
+	},
+	"graphml": {
+		Extension:   "graphml",
+		ContentType: "application/xml",
+		Write:       WriteGraphML,
+	},
+	"csv-nodes": {
+		Extension:   "nodes.csv",
+		ContentType: "text/csv",
+		Write:       WriteNodesCSV,
+	},
+	"csv-edges": {
+		Extension:   "edges.csv",
+		ContentType: "text/csv",
+		Write:       WriteEdgesCSV,
+	},
+	"jsonl": {
+		Extension:   "jsonl",
+		ContentType: "application/x-ndjson",
+		Write:       WriteJSONL,
+	},
+}
+
+// Get returns the format with name.
+func Get(name string) (Format, error) {
+	format, ok := formats[name]
+	if !ok {
+		return Format{}, fmt.Errorf("Unknown export format: %s", name)
+	}
+
+	return format, nil
+}
+
+// fields returns the sorted names of the fields of the nodes.
+func fields(nodes []datasources.Node) []string {
+	unique := map[string]bool{}
+	for _, node := range nodes {
+		for k := range node.Fields {
+			unique[k] = true
+		}
+	}
+
+	names := []string{}
+	for k := range unique {
+		names = append(names, k)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// value returns the value v as string, lists are joined by comma.
+func value(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []string:
+		return strings.Join(v, ", ")
+	case []interface{}:
+		values := []string{}
+		for _, s := range v {
+			values = append(values, value(s))
+		}
+
+		return strings.Join(values, ", ")
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// label returns the label of a node, the values of its fields.
+func label(node datasources.Node) string {
+	names := fields([]datasources.Node{node})
+
+	values := []string{}
+	for _, name := range names {
+		if v := value(node.Fields[name]); v != "" {
+			values = append(values, v)
+		}
+	}
+
+	return strings.Join(values, " ")
+}
+
+// weight returns the weight of an edge, the weight of its relations, the
+// number of items or 1.
+func weight(edge datasources.Edge) float64 {
+	if edge.Weight > 0 {
+		return edge.Weight
+	} else if edge.Count > 0 {
+		return float64(edge.Count)
+	}
+
+	return 1
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// formatCount returns the count, or nothing when it hasn't been counted.
+func formatCount(n int64) string {
+	if n == 0 {
+		return ""
+	}
+
+	return strconv.FormatInt(n, 10)
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+
+	return t.UTC().Format(time.RFC3339)
+}
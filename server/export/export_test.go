@@ -0,0 +1,84 @@
+package export
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dutchcoders/marija/server/datasources"
+)
+
+// testGraph returns a graph with values that need escaping, lists, and typed
+// and untyped edges.
+func testGraph() *Graph {
+	first := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	last := time.Date(2020, 1, 2, 12, 0, 0, 0, time.UTC)
+
+	return &Graph{
+		Nodes: []datasources.Node{
+			{ID: "a", Fields: map[string]interface{}{"user": "alice", "ip": []interface{}{"10.0.0.1", "10.0.0.2"}}, Count: 2, Datasource: "logs"},
+			{ID: "b", Fields: map[string]interface{}{"user": "bob, \"jr\""}, Count: 1, Datasource: "logs"},
+			{ID: "c", Fields: map[string]interface{}{"host": "<srv>"}, Datasource: "cmdb"},
+		},
+		Edges: []datasources.Edge{
+			{Source: "a", Target: "b", Field: "ip"},
+			{Source: "a", Target: "c", Field: "host", Type: "login", Count: 3, Weight: 1.5, FirstSeen: &first, LastSeen: &last},
+		},
+		Items: []datasources.Item{
+			{ID: "1", Fields: map[string]interface{}{"user": "alice"}, Datasource: "logs"},
+			{ID: "2", Fields: map[string]interface{}{"user": "bob"}, Index: "logs-1", Datasource: "logs"},
+		},
+	}
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		format string
+		golden string
+	}{
+		{"csv-nodes", "graph.nodes.csv"},
+		{"csv-edges", "graph.edges.csv"},
+		{"jsonl", "graph.jsonl"},
+		{"gexf", "graph.gexf"},
+		{"graphml", "graph.graphml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			format, err := Get(tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			buff := new(bytes.Buffer)
+			if err := format.Write(buff, testGraph()); err != nil {
+				t.Fatal(err)
+			}
+
+			expected, err := ioutil.ReadFile(filepath.Join("testdata", tt.golden))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(buff.Bytes(), expected) {
+				t.Fatalf("Expected:\n%s\nGot:\n%s", expected, buff.String())
+			}
+		})
+	}
+}
+
+func TestWriteEmpty(t *testing.T) {
+	for name, format := range formats {
+		if err := format.Write(ioutil.Discard, &Graph{}); err != nil {
+			t.Errorf("%s: %s", name, err.Error())
+		}
+	}
+}
+
+func TestGet(t *testing.T) {
+	if _, err := Get("dot"); err == nil {
+		t.Fatal("Expected error for unknown format")
+	}
+}
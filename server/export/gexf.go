@@ -0,0 +1,168 @@
+package export
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+type gexf struct {
+	XMLName xml.Name `xml:"gexf"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Version string   `xml:"version,attr"`
+
+	Creator string    `xml:"meta>creator"`
+	Graph   gexfGraph `xml:"graph"`
+}
+
+type gexfGraph struct {
+	Mode            string `xml:"mode,attr"`
+	DefaultEdgeType string `xml:"defaultedgetype,attr"`
+
+	Attributes []gexfAttributes `xml:"attributes"`
+	Nodes      []gexfNode       `xml:"nodes>node"`
+	Edges      []gexfEdge       `xml:"edges>edge"`
+}
+
+type gexfAttributes struct {
+	Class      string          `xml:"class,attr"`
+	Attributes []gexfAttribute `xml:"attribute"`
+}
+
+type gexfAttribute struct {
+	ID    string `xml:"id,attr"`
+	Title string `xml:"title,attr"`
+	Type  string `xml:"type,attr"`
+}
+
+type gexfAttValue struct {
+	For   string `xml:"for,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type gexfNode struct {
+	ID        string         `xml:"id,attr"`
+	Label     string         `xml:"label,attr"`
+	AttValues []gexfAttValue `xml:"attvalues>attvalue"`
+}
+
+type gexfEdge struct {
+	ID        string         `xml:"id,attr"`
+	Source    string         `xml:"source,attr"`
+	Target    string         `xml:"target,attr"`
+	Label     string         `xml:"label,attr,omitempty"`
+	Weight    string         `xml:"weight,attr"`
+	AttValues []gexfAttValue `xml:"attvalues>attvalue"`
+}
+
+// attValues returns the values that aren't empty.
+func attValues(values ...gexfAttValue) []gexfAttValue {
+	result := []gexfAttValue{}
+	for _, v := range values {
+		if v.Value != "" {
+			result = append(result, v)
+		}
+	}
+
+	return result
+}
+
+// WriteGEXF writes the graph as GEXF 1.2, for Gephi. The fields of the
+// nodes are node attributes.
+func WriteGEXF(w io.Writer, g *Graph) error {
+	names := fields(g.Nodes)
+
+	nodeAttributes := gexfAttributes{
+		Class: "node",
+		Attributes: []gexfAttribute{
+			{ID: "datasource", Title: "datasource", Type: "string"},
+			{ID: "count", Title: "count", Type: "long"},
+		},
+	}
+
+	for i, name := range names {
+		nodeAttributes.Attributes = append(nodeAttributes.Attributes, gexfAttribute{
+			ID:    fmt.Sprintf("field%d", i),
+			Title: name,
+			Type:  "string",
+		})
+	}
+
+	edgeAttributes := gexfAttributes{
+		Class: "edge",
+		Attributes: []gexfAttribute{
+			{ID: "field", Title: "field", Type: "string"},
+			{ID: "type", Title: "type", Type: "string"},
+			{ID: "count", Title: "count", Type: "long"},
+			{ID: "first-seen", Title: "first-seen", Type: "string"},
+			{ID: "last-seen", Title: "last-seen", Type: "string"},
+		},
+	}
+
+	doc := gexf{
+		Xmlns:   "http://www.gexf.net/1.2draft",
+		Version: "1.2",
+		Creator: "Marija",
+		Graph: gexfGraph{
+			Mode:            "static",
+			DefaultEdgeType: "directed",
+			Attributes:      []gexfAttributes{nodeAttributes, edgeAttributes},
+		},
+	}
+
+	for _, node := range g.Nodes {
+		values := []gexfAttValue{
+			{For: "datasource", Value: node.Datasource},
+			{For: "count", Value: fmt.Sprintf("%d", node.Count)},
+		}
+
+		for i, name := range names {
+			values = append(values, gexfAttValue{
+				For:   fmt.Sprintf("field%d", i),
+				Value: value(node.Fields[name]),
+			})
+		}
+
+		doc.Graph.Nodes = append(doc.Graph.Nodes, gexfNode{
+			ID:        node.ID,
+			Label:     label(node),
+			AttValues: attValues(values...),
+		})
+	}
+
+	for i, edge := range g.Edges {
+		edgeLabel := edge.Type
+		if edgeLabel == "" {
+			edgeLabel = edge.Field
+		}
+
+		doc.Graph.Edges = append(doc.Graph.Edges, gexfEdge{
+			ID:     fmt.Sprintf("%d", i),
+			Source: edge.Source,
+			Target: edge.Target,
+			Label:  edgeLabel,
+			Weight: formatFloat(weight(edge)),
+			AttValues: attValues(
+				gexfAttValue{For: "field", Value: edge.Field},
+				gexfAttValue{For: "type", Value: edge.Type},
+				gexfAttValue{For: "count", Value: formatCount(edge.Count)},
+				gexfAttValue{For: "first-seen", Value: formatTime(edge.FirstSeen)},
+				gexfAttValue{For: "last-seen", Value: formatTime(edge.LastSeen)},
+			),
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,140 @@
+package export
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+type graphml struct {
+	XMLName xml.Name `xml:"graphml"`
+	Xmlns   string   `xml:"xmlns,attr"`
+
+	Keys  []graphmlKey `xml:"key"`
+	Graph graphmlGraph `xml:"graph"`
+}
+
+type graphmlKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphmlGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphmlNode `xml:"node"`
+	Edges       []graphmlEdge `xml:"edge"`
+}
+
+type graphmlData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type graphmlNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphmlData `xml:"data"`
+}
+
+type graphmlEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphmlData `xml:"data"`
+}
+
+// data returns the data that isn't empty.
+func data(values ...graphmlData) []graphmlData {
+	result := []graphmlData{}
+	for _, v := range values {
+		if v.Value != "" {
+			result = append(result, v)
+		}
+	}
+
+	return result
+}
+
+// WriteGraphML writes the graph as GraphML, for yEd and others. The fields of
+// the nodes are node data.
+func WriteGraphML(w io.Writer, g *Graph) error {
+	names := fields(g.Nodes)
+
+	doc := graphml{
+		Xmlns: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphmlKey{
+			{ID: "label", For: "node", Name: "label", Type: "string"},
+			{ID: "datasource", For: "node", Name: "datasource", Type: "string"},
+			{ID: "count", For: "node", Name: "count", Type: "long"},
+			{ID: "field", For: "edge", Name: "field", Type: "string"},
+			{ID: "type", For: "edge", Name: "type", Type: "string"},
+			{ID: "edge-count", For: "edge", Name: "count", Type: "long"},
+			{ID: "weight", For: "edge", Name: "weight", Type: "double"},
+			{ID: "first-seen", For: "edge", Name: "first-seen", Type: "string"},
+			{ID: "last-seen", For: "edge", Name: "last-seen", Type: "string"},
+		},
+		Graph: graphmlGraph{
+			ID:          "marija",
+			EdgeDefault: "directed",
+		},
+	}
+
+	for i, name := range names {
+		doc.Keys = append(doc.Keys, graphmlKey{
+			ID:   fmt.Sprintf("field%d", i),
+			For:  "node",
+			Name: name,
+			Type: "string",
+		})
+	}
+
+	for _, node := range g.Nodes {
+		values := []graphmlData{
+			{Key: "label", Value: label(node)},
+			{Key: "datasource", Value: node.Datasource},
+			{Key: "count", Value: fmt.Sprintf("%d", node.Count)},
+		}
+
+		for i, name := range names {
+			values = append(values, graphmlData{
+				Key:   fmt.Sprintf("field%d", i),
+				Value: value(node.Fields[name]),
+			})
+		}
+
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphmlNode{
+			ID:   node.ID,
+			Data: data(values...),
+		})
+	}
+
+	for _, edge := range g.Edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphmlEdge{
+			Source: edge.Source,
+			Target: edge.Target,
+			Data: data(
+				graphmlData{Key: "field", Value: edge.Field},
+				graphmlData{Key: "type", Value: edge.Type},
+				graphmlData{Key: "edge-count", Value: formatCount(edge.Count)},
+				graphmlData{Key: "weight", Value: formatFloat(weight(edge))},
+				graphmlData{Key: "first-seen", Value: formatTime(edge.FirstSeen)},
+				graphmlData{Key: "last-seen", Value: formatTime(edge.LastSeen)},
+			),
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,19 @@
+package export
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// WriteJSONL writes the items of the nodes as json, an item per line.
+func WriteJSONL(w io.Writer, g *Graph) error {
+	encoder := json.NewEncoder(w)
+
+	for _, item := range g.Items {
+		if err := encoder.Encode(item); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
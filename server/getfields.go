@@ -3,24 +3,41 @@ package server
 import (
 	"context"
 	_ "log"
+	"time"
 
 	"github.com/dutchcoders/marija/server/messages"
 )
 
 func (c *connection) GetFields(ctx context.Context, r messages.GetFieldsRequest) error {
 	for _, datasource := range r.Datasources {
-		go func(datasource string) {
+		datasource := datasource
+
+		c.track(r.RequestID, func() {
 			log.Debug("GetFields request=%s, index=%s", r.RequestID, datasource)
 			defer log.Debug("GetFields completed request=%s, index=%s", r.RequestID, datasource)
 
-			ds, ok := c.server.GetDatasource(datasource)
-			if !ok {
-				log.Errorf("Could not find datasource: %s", datasource)
+			ds, err := c.datasource(datasource)
+			if err != nil {
+				c.Send(&messages.ErrorMessage{
+					RequestID: r.RequestID,
+					Message:   err.Error(),
+				})
+
+				log.Error(err.Error())
 				return
 			}
 
+			getFieldsTotal.WithLabelValues(datasource).Inc()
+
+			start := time.Now()
+
 			fields, err := ds.GetFields(ctx)
+
+			getFieldsDurationSeconds.WithLabelValues(datasource).Observe(time.Since(start).Seconds())
+
 			if err != nil {
+				getFieldsErrorsTotal.WithLabelValues(datasource).Inc()
+
 				c.Send(&messages.ErrorMessage{
 					RequestID: r.RequestID,
 					Message:   err.Error(),
@@ -33,7 +50,7 @@ func (c *connection) GetFields(ctx context.Context, r messages.GetFieldsRequest)
 				Datasource: datasource,
 				Fields:     fields,
 			})
-		}(datasource)
+		})
 	}
 
 	return nil
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"time"
+
+	"github.com/dutchcoders/marija/server/datasources"
+	"github.com/dutchcoders/marija/server/messages"
+)
+
+// Histogram returns the number of items per interval of the date field for
+// every datasource. Datasources that can't aggregate are searched, counting
+// the items in the server.
+func (c *connection) Histogram(ctx context.Context, r messages.HistogramRequest) error {
+	if len(r.Datasources) == 0 {
+		return errors.New("No datasource set")
+	} else if r.Field == "" {
+		return errors.New("No field set")
+	}
+
+	interval, err := datasources.ParseInterval(r.Interval)
+	if err != nil {
+		return err
+	}
+
+	expr, err := parseQuery(r.Query, r.Translate)
+	if err != nil {
+		return err
+	}
+
+	c.audit(auditEvent{
+		Action:          "histogram",
+		RequestID:       r.RequestID,
+		Datasources:     r.Datasources,
+		Query:           r.Query,
+		AdvancedQueries: r.AdvancedQueries,
+	})
+
+	for _, index := range r.Datasources {
+		index := index
+
+		datasource, err := c.datasource(index)
+		if err != nil {
+			c.Send(&messages.ErrorMessage{
+				RequestID: r.RequestID,
+				Message:   err.Error(),
+			})
+
+			log.Error(err.Error())
+			continue
+		}
+
+		o := datasources.HistogramOptions{
+			SearchOptions: datasources.SearchOptions{
+				Query:           r.Query,
+				Expr:            expr,
+				AdvancedQueries: r.AdvancedQueries,
+			},
+			Field:    r.Field,
+			Interval: interval,
+		}
+
+		c.track(r.RequestID, func() {
+			c.histogram(ctx, r.RequestID, index, datasource, o)
+		})
+	}
+
+	return nil
+}
+
+func (c *connection) histogram(ctx context.Context, requestID string, index string, datasource datasources.Index, o datasources.HistogramOptions) (err error) {
+	defer func() {
+		if err := recover(); err != nil {
+			trace := make([]byte, 1024)
+			count := runtime.Stack(trace, true)
+			log.Errorf("Error: %s", err)
+			log.Debugf("Stack of %d bytes: %s\n", count, string(trace))
+		}
+	}()
+
+	start := time.Now()
+
+	buckets := []datasources.HistogramBucket{}
+
+	defer func() {
+		if err == context.Canceled {
+			log.Debug("Histogram canceled query=%s, requestid=%s, index=%s", o.Query, requestID, index)
+
+			c.Send(&messages.RequestCanceled{
+				RequestID: requestID,
+			})
+		} else if err != nil {
+			log.Error("Histogram error query=%s, requestid=%s, index=%s, error=%s", o.Query, requestID, index, err.Error())
+
+			c.Send(&messages.ErrorMessage{
+				RequestID: requestID,
+				Message:   err.Error(),
+			})
+		} else {
+			c.server.observe(index, time.Since(start))
+
+			c.Send(&messages.HistogramResponse{
+				RequestID:  requestID,
+				Datasource: index,
+				Field:      o.Field,
+				Interval:   o.Interval.String(),
+				Buckets:    buckets,
+			})
+
+			c.Send(&messages.RequestCompleted{
+				RequestID: requestID,
+			})
+		}
+	}()
+
+	if h, ok := datasource.(datasources.Histogrammer); ok {
+		buckets, err = h.Histogram(ctx, o)
+	} else {
+		buckets, err = datasources.HistogramFromSearch(ctx, datasource, o)
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return err
+}
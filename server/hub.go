@@ -6,11 +6,14 @@ package server
 
 import (
 	"encoding/json"
+	"sync"
 )
 
 // hub maintains the set of active connections and broadcasts messages to the
 // connections.
 type hub struct {
+	m sync.RWMutex
+
 	// Registered connections.
 	connections map[*connection]bool
 
@@ -31,17 +34,56 @@ func (h *hub) run() {
 	for {
 		select {
 		case c := <-h.register:
+			h.m.Lock()
 			h.connections[c] = true
+			h.m.Unlock()
 		case c := <-h.unregister:
+			h.m.Lock()
 			if _, ok := h.connections[c]; ok {
 				delete(h.connections, c)
 			}
+			h.m.Unlock()
 		}
 	}
 }
 
-func (h *hub) Send(v json.Marshaler) {
+// list returns a copy of the registered connections, so sending won't block
+// (un)registering.
+func (h *hub) list() []*connection {
+	h.m.RLock()
+	defer h.m.RUnlock()
+
+	connections := make([]*connection, 0, len(h.connections))
 	for c := range h.connections {
+		connections = append(connections, c)
+	}
+
+	return connections
+}
+
+func (h *hub) Send(v json.Marshaler) {
+	broadcastMessagesTotal.Inc()
+
+	for _, c := range h.list() {
 		c.Send(v)
 	}
 }
+
+// SendDatasource sends v to the connections of users allowed to use the
+// datasource with key.
+func (h *hub) SendDatasource(key string, v json.Marshaler) {
+	broadcastMessagesTotal.Inc()
+
+	for _, c := range h.list() {
+		if c.user.Allowed(key) {
+			c.Send(v)
+		}
+	}
+}
+
+// Close sends a close frame to all connections.
+func (h *hub) Close() {
+	for _, c := range h.list() {
+		c.close()
+	}
+}
@@ -14,61 +14,83 @@ func (c *connection) Items(ctx context.Context, r messages.ItemsRequest) error {
 		RequestID: r.RequestID,
 	})
 
-	go func() (err error) {
-		defer func() {
-			if err := recover(); err != nil {
-				trace := make([]byte, 1024)
-				count := runtime.Stack(trace, true)
-				log.Errorf("Error: %s", err)
-				log.Debugf("Stack of %d bytes: %s\n", count, string(trace))
-			}
-		}()
-
-		items := []datasources.Item{}
-
-		defer func() {
-			if err == context.Canceled {
-				c.Send(&messages.RequestCanceled{
-					RequestID: r.RequestID,
-				})
-			} else if err != nil {
-				log.Error("Error: ", err.Error())
-
-				c.Send(&messages.ErrorMessage{
-					RequestID: r.RequestID,
-					Message:   err.Error(),
-				})
-			} else {
-				c.Send(&messages.ItemsResponse{
-					RequestID: r.RequestID,
-					Items:     items,
-				})
-
-				c.Send(&messages.RequestCompleted{
-					RequestID: r.RequestID,
-				})
-			}
-		}()
-
-		for _, itemid := range r.Items {
-			items, ok := c.items.Load(itemid)
-			if !ok {
-				continue
-			}
-
-			if len(items) == 0 {
-				continue
-			}
+	c.track(r.RequestID, func() {
+		c.sendItems(r)
+	})
+
+	return nil
+}
+
+// sendItems sends the items of each of the requested item ids.
+func (c *connection) sendItems(r messages.ItemsRequest) (err error) {
+	defer func() {
+		if err := recover(); err != nil {
+			trace := make([]byte, 1024)
+			count := runtime.Stack(trace, true)
+			log.Errorf("Error: %s", err)
+			log.Debugf("Stack of %d bytes: %s\n", count, string(trace))
+		}
+	}()
 
+	items := []datasources.Item{}
+
+	count := 0
+
+	defer func() {
+		status, message := auditStatus(err)
+
+		c.audit(auditEvent{
+			Action:    "items",
+			RequestID: r.RequestID,
+			Items:     r.Items,
+			Status:    status,
+			Error:     message,
+			Count:     auditCount(count),
+		})
+	}()
+
+	defer func() {
+		if err == context.Canceled {
+			c.Send(&messages.RequestCanceled{
+				RequestID: r.RequestID,
+			})
+		} else if err != nil {
+			log.Error("Error: ", err.Error())
+
+			c.Send(&messages.ErrorMessage{
+				RequestID: r.RequestID,
+				Message:   err.Error(),
+			})
+		} else {
 			c.Send(&messages.ItemsResponse{
 				RequestID: r.RequestID,
-				ItemID:    itemid,
 				Items:     items,
 			})
-		}
 
-		return nil
+			c.Send(&messages.RequestCompleted{
+				RequestID: r.RequestID,
+			})
+		}
 	}()
 
+	for _, itemid := range r.Items {
+		items, ok := c.items(itemid)
+		if !ok {
+			continue
+		}
+
+		if len(items) == 0 {
+			continue
+		}
+
+		count += len(items)
+
+		c.Send(&messages.ItemsResponse{
+			RequestID: r.RequestID,
+			ItemID:    itemid,
+			Items:     items,
+		})
+	}
+
 	return nil
 }
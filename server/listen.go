@@ -0,0 +1,86 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+)
+
+const defaultAddress = "127.0.0.1:8080"
+
+// listenAddress returns the address set on the command line, the address of
+// the configuration file or the default address, in that order.
+func (server *Server) listenAddress() string {
+	if server.address != "" {
+		return server.address
+	} else if server.ListenerString != "" {
+		return server.ListenerString
+	}
+
+	return defaultAddress
+}
+
+// tlsConfig returns the tls configuration of the listener, or nil when tls
+// hasn't been configured. Client certificates are required when a client ca
+// has been configured.
+func (server *Server) tlsConfig() (*tls.Config, error) {
+	if server.TLSCert == "" && server.TLSKey == "" {
+		return nil, nil
+	} else if server.TLSCert == "" || server.TLSKey == "" {
+		return nil, fmt.Errorf("Both tls certificate and key need to be set")
+	}
+
+	cert, err := tls.LoadX509KeyPair(server.TLSCert, server.TLSKey)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+
+	if server.TLSClientCA == "" {
+		return config, nil
+	}
+
+	data, err := ioutil.ReadFile(server.TLSClientCA)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("Could not parse client ca: %s", server.TLSClientCA)
+	}
+
+	config.ClientCAs = pool
+	config.ClientAuth = tls.RequireAndVerifyClientCert
+
+	return config, nil
+}
+
+// redirectHandler redirects http requests to the https listener on address.
+func redirectHandler(address string) http.Handler {
+	_, port, _ := net.SplitHostPort(address)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+
+		u := *r.URL
+		u.Scheme = "https"
+		u.Host = host
+
+		http.Redirect(w, r, u.String(), http.StatusMovedPermanently)
+	})
+}
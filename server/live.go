@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"os"
 
+	"github.com/dutchcoders/marija/server/auth"
 	"github.com/fatih/color"
 )
 
@@ -51,6 +52,29 @@ func (server *Server) SubmitHandler(w http.ResponseWriter, r *http.Request) {
 		key = "wodan"
 	}
 
+	user := auth.UserFromContext(r.Context())
+
+	e := auditEvent{
+		Action:      "submit",
+		RemoteAddr:  r.RemoteAddr,
+		User:        user.String(),
+		Datasources: []string{key},
+		Status:      "completed",
+		Count:       auditCount(1),
+	}
+
+	if !user.Allowed(key) {
+		e.Status = "denied"
+		server.audit(e)
+
+		log.Error("User %s not allowed to submit to datasource: %s", user, key)
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	done := server.use()
+	defer done()
+
 	ds, ok := server.GetDatasource(key)
 	if !ok {
 		log.Error("Could not find datasource: %s", key)
@@ -67,5 +91,7 @@ func (server *Server) SubmitHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	server.audit(e)
+
 	s.Receive(fields)
 }
@@ -5,6 +5,7 @@ import (
 	_ "log"
 
 	"github.com/dutchcoders/marija/server/datasources"
+	"github.com/dutchcoders/marija/server/normalize"
 )
 
 const (
@@ -12,10 +13,13 @@ const (
 
 	InitialStateReceive = "INITIAL_STATE_RECEIVE"
 
+	ActionTypeDatasourcesReceive = "DATASOURCES_RECEIVE"
+
 	ActionTypeCancel = "CANCEL_REQUEST"
 
-	ActionTypeSearchRequest = "SEARCH_REQUEST"
-	ActionTypeSearchReceive = "SEARCH_RECEIVE"
+	ActionTypeSearchRequest   = "SEARCH_REQUEST"
+	ActionTypeSearchReceive   = "SEARCH_RECEIVE"
+	ActionTypeContinueRequest = "CONTINUE_REQUEST"
 
 	ActionTypeRequestCanceled  = "REQUEST_CANCELED"
 	ActionTypeRequestCompleted = "REQUEST_COMPLETED"
@@ -27,6 +31,20 @@ const (
 
 	ActionTypeGetFieldsRequest = "FIELDS_REQUEST"
 	ActionTypeGetFieldsReceive = "FIELDS_RECEIVE"
+
+	ActionTypeExpandRequest = "EXPAND_REQUEST"
+
+	ActionTypeAggregateRequest = "AGGREGATE_REQUEST"
+
+	ActionTypeHistogramRequest = "HISTOGRAM_REQUEST"
+	ActionTypeHistogramReceive = "HISTOGRAM_RECEIVE"
+
+	ActionTypeExportRequest = "EXPORT_REQUEST"
+	ActionTypeExportReceive = "EXPORT_RECEIVE"
+
+	ActionTypeSessionCreate  = "SESSION_CREATE"
+	ActionTypeSessionResume  = "SESSION_RESUME"
+	ActionTypeSessionReceive = "SESSION_RECEIVE"
 )
 
 type Datasource struct {
@@ -55,6 +73,22 @@ func (em *InitialStateMessage) MarshalJSON() ([]byte, error) {
 	})
 }
 
+// DatasourcesMessage contains the datasources after the configuration has
+// been reloaded.
+type DatasourcesMessage struct {
+	Datasources []Datasource
+}
+
+func (em *DatasourcesMessage) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&struct {
+		Type        string       `json:"type"`
+		Datasources []Datasource `json:"datasources"`
+	}{
+		Type:        ActionTypeDatasourcesReceive,
+		Datasources: em.Datasources,
+	})
+}
+
 type Request struct {
 	RequestID string `json:"request-id"`
 	Type      string `json:"type"`
@@ -95,11 +129,137 @@ func (em *ItemsResponse) MarshalJSON() ([]byte, error) {
 type SearchRequest struct {
 	Request
 
+	Datasources []string `json:"datasources"`
+	Query       string   `json:"query"`
+
+	// Translate parses the query using the Marija query language and
+	// translates it for every datasource, the query is passed to the
+	// datasources as is otherwise.
+	Translate bool `json:"translate,omitempty"`
+
+	// Fields are the fields identifying a node, items with equal values
+	// for the fields are the same node. All fields are used when empty.
+	Fields []string `json:"fields"`
+
+	// Normalizations normalize the values of the fields before nodes are
+	// identified.
+	Normalizations []normalize.Normalization `json:"normalizations,omitempty"`
+
+	AdvancedQueries []datasources.AdvancedQuery `json:"advancedQuery"`
+
+	// MaxResults limits the number of results per datasource, the search
+	// can be continued for the next results.
+	MaxResults int `json:"max-results,omitempty"`
+
+	// Sample returns a random sample of the results, it needs a limit.
+	Sample bool `json:"sample,omitempty"`
+}
+
+// ContinueRequest continues the search with the request id, for the
+// datasources with more results.
+type ContinueRequest struct {
+	Request
+}
+
+type ExpandRequest struct {
+	Request
+
+	Datasources []string `json:"datasources"`
+	Nodes       []string `json:"nodes"`
+	Fields      []string `json:"fields"`
+
+	// Identity are the fields identifying the nodes found, as the fields of
+	// a search. All fields are used when empty.
+	Identity []string `json:"identity,omitempty"`
+
+	// Normalizations normalize the values of the identity fields, as the
+	// normalizations of a search.
+	Normalizations []normalize.Normalization `json:"normalizations,omitempty"`
+}
+
+// AggregateRequest requests the nodes for the values of fields and the edges
+// between values occurring together, counted by the datasources.
+type AggregateRequest struct {
+	Request
+
 	Datasources []string `json:"datasources"`
 	Fields      []string `json:"fields"`
 	Query       string   `json:"query"`
 
+	// Translate parses the query using the Marija query language and
+	// translates it for every datasource, the query is passed to the
+	// datasources as is otherwise.
+	Translate bool `json:"translate,omitempty"`
+
 	AdvancedQueries []datasources.AdvancedQuery `json:"advancedQuery"`
+
+	// Size is the maximum number of combinations of values per datasource.
+	Size int `json:"size"`
+}
+
+// HistogramRequest requests the number of items matching the query per
+// interval of a date field.
+type HistogramRequest struct {
+	Request
+
+	Datasources []string `json:"datasources"`
+	Query       string   `json:"query"`
+
+	// Translate parses the query using the Marija query language and
+	// translates it for every datasource, the query is passed to the
+	// datasources as is otherwise.
+	Translate bool `json:"translate,omitempty"`
+
+	AdvancedQueries []datasources.AdvancedQuery `json:"advancedQuery"`
+
+	Field    string `json:"field"`
+	Interval string `json:"interval"`
+}
+
+// ExportRequest requests an export of the graph in format, of the nodes or of
+// the whole graph. Nodes having equal values for the fields are connected.
+type ExportRequest struct {
+	Request
+
+	Format string   `json:"format"`
+	Nodes  []string `json:"nodes"`
+	Fields []string `json:"fields"`
+}
+
+type SessionCreateRequest struct {
+	Request
+
+	Name string `json:"name"`
+}
+
+type SessionResumeRequest struct {
+	Request
+
+	SessionID string `json:"session-id"`
+}
+
+type SessionResponse struct {
+	RequestID string
+
+	SessionID string
+	Name      string
+	History   []SearchRequest
+}
+
+func (em *SessionResponse) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&struct {
+		Type      string          `json:"type"`
+		RequestID string          `json:"request-id"`
+		SessionID string          `json:"session-id"`
+		Name      string          `json:"name"`
+		History   []SearchRequest `json:"history"`
+	}{
+		Type:      ActionTypeSessionReceive,
+		RequestID: em.RequestID,
+		SessionID: em.SessionID,
+		Name:      em.Name,
+		History:   em.History,
+	})
 }
 
 type RequestCanceled struct {
@@ -153,6 +313,11 @@ type SearchResponse struct {
 	Datasource string
 	Query      string
 	Graphs     []datasources.Node
+	Edges      []datasources.Edge
+
+	// More is set on the last response of a datasource when the results
+	// have been limited and more results are available.
+	More bool
 }
 
 func (em *SearchResponse) MarshalJSON() ([]byte, error) {
@@ -162,12 +327,16 @@ func (em *SearchResponse) MarshalJSON() ([]byte, error) {
 		Datasource string             `json:"datasource,omitempty"`
 		Query      string             `json:"query"`
 		Graphs     []datasources.Node `json:"results"`
+		Edges      []datasources.Edge `json:"edges,omitempty"`
+		More       bool               `json:"more,omitempty"`
 	}{
 		Type:       ActionTypeSearchReceive,
 		RequestID:  em.RequestID,
 		Datasource: em.Datasource,
 		Query:      em.Query,
 		Graphs:     em.Graphs,
+		Edges:      em.Edges,
+		More:       em.More,
 	})
 }
 
@@ -199,6 +368,61 @@ func (em *GetFieldsResponse) MarshalJSON() ([]byte, error) {
 	})
 }
 
+type HistogramResponse struct {
+	RequestID string
+
+	Datasource string
+	Field      string
+	Interval   string
+	Buckets    []datasources.HistogramBucket
+}
+
+func (em *HistogramResponse) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&struct {
+		Type       string                        `json:"type"`
+		RequestID  string                        `json:"request-id"`
+		Datasource string                        `json:"datasource"`
+		Field      string                        `json:"field"`
+		Interval   string                        `json:"interval"`
+		Buckets    []datasources.HistogramBucket `json:"buckets"`
+	}{
+		Type:       ActionTypeHistogramReceive,
+		RequestID:  em.RequestID,
+		Datasource: em.Datasource,
+		Field:      em.Field,
+		Interval:   em.Interval,
+		Buckets:    em.Buckets,
+	})
+}
+
+// ExportResponse contains the url to download the export from.
+type ExportResponse struct {
+	RequestID string
+
+	Format string
+	URL    string
+	Nodes  int
+	Edges  int
+}
+
+func (em *ExportResponse) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&struct {
+		Type      string `json:"type"`
+		RequestID string `json:"request-id"`
+		Format    string `json:"format"`
+		URL       string `json:"url"`
+		Nodes     int    `json:"nodes"`
+		Edges     int    `json:"edges"`
+	}{
+		Type:      ActionTypeExportReceive,
+		RequestID: em.RequestID,
+		Format:    em.Format,
+		URL:       em.URL,
+		Nodes:     em.Nodes,
+		Edges:     em.Edges,
+	})
+}
+
 type ErrorMessage struct {
 	RequestID string
 	Message   string
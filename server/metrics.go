@@ -0,0 +1,100 @@
+package server
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var registry = prometheus.NewRegistry()
+
+// metricsHandler exposes the metrics of the registry.
+var metricsHandler = promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+
+var (
+	connections = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "marija_connections",
+		Help: "Number of connected websocket clients.",
+	}, func() float64 {
+		return float64(len(h.list()))
+	})
+
+	searchesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "marija_searches_total",
+		Help: "Number of searches per datasource.",
+	}, []string{"datasource"})
+
+	searchErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "marija_search_errors_total",
+		Help: "Number of failed searches per datasource.",
+	}, []string{"datasource"})
+
+	searchesCanceledTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "marija_searches_canceled_total",
+		Help: "Number of canceled searches per datasource.",
+	}, []string{"datasource"})
+
+	itemsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "marija_items_total",
+		Help: "Number of items streamed per datasource.",
+	}, []string{"datasource"})
+
+	searchFirstResultSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "marija_search_first_result_seconds",
+		Help: "Time to the first result of searches per datasource.",
+	}, []string{"datasource"})
+
+	searchDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "marija_search_duration_seconds",
+		Help: "Time to complete searches per datasource.",
+	}, []string{"datasource"})
+
+	getFieldsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "marija_getfields_total",
+		Help: "Number of field requests per datasource.",
+	}, []string{"datasource"})
+
+	getFieldsErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "marija_getfields_errors_total",
+		Help: "Number of failed field requests per datasource.",
+	}, []string{"datasource"})
+
+	getFieldsDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "marija_getfields_duration_seconds",
+		Help: "Time to complete field requests per datasource.",
+	}, []string{"datasource"})
+
+	errorMessagesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "marija_error_messages_total",
+		Help: "Number of error messages sent to clients.",
+	})
+
+	broadcastMessagesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "marija_broadcast_messages_total",
+		Help: "Number of messages broadcast to all clients.",
+	})
+
+	liveMessagesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "marija_live_messages_total",
+		Help: "Number of messages received per live datasource.",
+	}, []string{"datasource"})
+)
+
+func init() {
+	registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		connections,
+		searchesTotal,
+		searchErrorsTotal,
+		searchesCanceledTotal,
+		itemsTotal,
+		searchFirstResultSeconds,
+		searchDurationSeconds,
+		getFieldsTotal,
+		getFieldsErrorsTotal,
+		getFieldsDurationSeconds,
+		errorMessagesTotal,
+		broadcastMessagesTotal,
+		liveMessagesTotal,
+	)
+}
@@ -0,0 +1,48 @@
+package normalize
+
+import (
+	"net"
+	"net/mail"
+	"net/url"
+	"strings"
+)
+
+// Email returns the address of the email address s, without display name
+// and with the domain in lowercase. Other values are returned as is.
+func Email(s string) string {
+	address, err := mail.ParseAddress(strings.TrimSpace(s))
+	if err != nil {
+		return s
+	}
+
+	i := strings.LastIndex(address.Address, "@")
+	if i == -1 {
+		return s
+	}
+
+	return address.Address[:i+1] + strings.ToLower(address.Address[i+1:])
+}
+
+// Domain returns the domain of an email address, url or host name, in
+// lowercase and without port. Other values are returned as is.
+func Domain(s string) string {
+	v := strings.TrimSpace(s)
+
+	if address, err := mail.ParseAddress(v); err == nil {
+		v = address.Address[strings.LastIndex(address.Address, "@")+1:]
+	} else if u, err := url.Parse(v); err == nil && u.Host != "" {
+		v = u.Host
+	}
+
+	if host, _, err := net.SplitHostPort(v); err == nil {
+		v = host
+	}
+
+	v = strings.TrimSuffix(strings.ToLower(v), ".")
+
+	if v == "" || strings.ContainsAny(v, " /@:") {
+		return s
+	}
+
+	return v
+}
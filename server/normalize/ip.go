@@ -0,0 +1,51 @@
+package normalize
+
+import (
+	"net"
+	"strings"
+)
+
+// IP returns the canonical notation of the ip address s, ipv4 addresses
+// mapped in ipv6 are returned as ipv4. Other values are returned as is.
+func IP(s string) string {
+	ip := net.ParseIP(strings.TrimSpace(s))
+	if ip == nil {
+		return s
+	}
+
+	return ip.String()
+}
+
+// CIDR returns the canonical notation of the network s. Ip addresses are
+// masked to their network when prefixLength is set, for example to have a
+// node per /24 network. Other values are returned as is.
+func CIDR(s string, prefixLength int) string {
+	v := strings.TrimSpace(s)
+
+	if _, network, err := net.ParseCIDR(v); err == nil {
+		return network.String()
+	}
+
+	ip := net.ParseIP(v)
+	if ip == nil {
+		return s
+	} else if prefixLength == 0 {
+		return ip.String()
+	}
+
+	bits := 128
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, 32
+	}
+
+	if prefixLength > bits {
+		return ip.String()
+	}
+
+	network := net.IPNet{
+		IP:   ip.Mask(net.CIDRMask(prefixLength, bits)),
+		Mask: net.CIDRMask(prefixLength, bits),
+	}
+
+	return network.String()
+}
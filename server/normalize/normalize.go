@@ -0,0 +1,175 @@
+// Package normalize normalizes the values of item fields, so values that are
+// written differently but identify the same thing result in the same node.
+package normalize
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Normalization is a rule normalizing the values of fields. The regex
+// normalization matches like the normalizations of the browser.
+type Normalization struct {
+	// Type is the type of normalization, regex when not set.
+	Type string `json:"type,omitempty" toml:"type"`
+
+	// Fields are the fields being normalized, all fields when empty.
+	Fields []string `json:"fields,omitempty" toml:"fields"`
+
+	// Regex and ReplaceWith are used by the regex normalization, matching
+	// is case insensitive.
+	Regex       string `json:"regex,omitempty" toml:"regex"`
+	ReplaceWith string `json:"replace-with,omitempty" toml:"replace-with"`
+
+	// PrefixLength masks ip addresses to their network by the cidr
+	// normalization.
+	PrefixLength int `json:"prefix-length,omitempty" toml:"prefix-length"`
+
+	// CountryCode is the calling code used by the e164 normalization for
+	// national phone numbers.
+	CountryCode string `json:"country-code,omitempty" toml:"country-code"`
+}
+
+type normalizeFunc func(string) string
+
+var normalizers = map[string]func(Normalization) (normalizeFunc, error){
+	"lowercase": func(_ Normalization) (normalizeFunc, error) {
+		return strings.ToLower, nil
+	},
+	"trim": func(_ Normalization) (normalizeFunc, error) {
+		return strings.TrimSpace, nil
+	},
+	"regex": func(n Normalization) (normalizeFunc, error) {
+		re, err := regexp.Compile("(?i)" + n.Regex)
+		if err != nil {
+			return nil, err
+		}
+
+		return func(s string) string {
+			return re.ReplaceAllString(s, n.ReplaceWith)
+		}, nil
+	},
+	"ip": func(_ Normalization) (normalizeFunc, error) {
+		return IP, nil
+	},
+	"cidr": func(n Normalization) (normalizeFunc, error) {
+		if n.PrefixLength < 0 || n.PrefixLength > 128 {
+			return nil, fmt.Errorf("Invalid prefix length: %d", n.PrefixLength)
+		}
+
+		return func(s string) string {
+			return CIDR(s, n.PrefixLength)
+		}, nil
+	},
+	"email": func(_ Normalization) (normalizeFunc, error) {
+		return Email, nil
+	},
+	"domain": func(_ Normalization) (normalizeFunc, error) {
+		return Domain, nil
+	},
+	"e164": func(n Normalization) (normalizeFunc, error) {
+		if strings.Trim(n.CountryCode, "0123456789") != "" {
+			return nil, fmt.Errorf("Invalid country code: %s", n.CountryCode)
+		}
+
+		return func(s string) string {
+			return E164(s, n.CountryCode)
+		}, nil
+	},
+}
+
+type rule struct {
+	fields map[string]bool
+	fn     normalizeFunc
+}
+
+// Normalizer applies normalizations in order. A nil Normalizer doesn't
+// normalize.
+type Normalizer struct {
+	rules []rule
+}
+
+// New returns a Normalizer for the normalizations.
+func New(normalizations []Normalization) (*Normalizer, error) {
+	n := &Normalizer{}
+
+	for _, normalization := range normalizations {
+		typ := normalization.Type
+		if typ == "" {
+			typ = "regex"
+		}
+
+		fn, ok := normalizers[typ]
+		if !ok {
+			return nil, fmt.Errorf("Unknown normalization: %s", typ)
+		}
+
+		normalizeFn, err := fn(normalization)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid normalization %s: %s", typ, err.Error())
+		}
+
+		r := rule{
+			fn: normalizeFn,
+		}
+
+		if len(normalization.Fields) > 0 {
+			r.fields = map[string]bool{}
+
+			for _, field := range normalization.Fields {
+				r.fields[field] = true
+			}
+		}
+
+		n.rules = append(n.rules, r)
+	}
+
+	return n, nil
+}
+
+// String normalizes the value s of field.
+func (n *Normalizer) String(field string, s string) string {
+	if n == nil {
+		return s
+	}
+
+	for _, r := range n.rules {
+		if r.fields != nil && !r.fields[field] {
+			continue
+		}
+
+		s = r.fn(s)
+	}
+
+	return s
+}
+
+// Value normalizes the value v of field. Strings and lists of strings are
+// normalized, other values are returned as is.
+func (n *Normalizer) Value(field string, v interface{}) interface{} {
+	if n == nil {
+		return v
+	}
+
+	switch v := v.(type) {
+	case string:
+		return n.String(field, v)
+	case []string:
+		values := make([]string, len(v))
+		for i := range v {
+			values[i] = n.String(field, v[i])
+		}
+
+		return values
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		for i := range v {
+			values[i] = n.Value(field, v[i])
+		}
+
+		return values
+	default:
+		return v
+	}
+}
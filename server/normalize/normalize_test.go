@@ -0,0 +1,146 @@
+package normalize
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name          string
+		normalization Normalization
+		value         string
+		want          string
+	}{
+		{"regex", Normalization{Regex: `^www\.`}, "WWW.example.com", "example.com"},
+		{"regex replace", Normalization{Type: "regex", Regex: `(\d+)-(\d+)`, ReplaceWith: "$2-$1"}, "1-2", "2-1"},
+		{"lowercase", Normalization{Type: "lowercase"}, "Alice", "alice"},
+		{"trim", Normalization{Type: "trim"}, " alice\t", "alice"},
+		{"ipv6", Normalization{Type: "ip"}, "2001:0db8::0001", "2001:db8::1"},
+		{"mapped ipv4", Normalization{Type: "ip"}, "::ffff:10.0.0.1", "10.0.0.1"},
+		{"not an ip", Normalization{Type: "ip"}, "alice", "alice"},
+		{"cidr", Normalization{Type: "cidr", PrefixLength: 24}, "10.0.0.12", "10.0.0.0/24"},
+		{"cidr network", Normalization{Type: "cidr"}, "10.0.0.12/8", "10.0.0.0/8"},
+		{"email", Normalization{Type: "email"}, "Alice <Alice@Example.COM>", "Alice@example.com"},
+		{"domain of email", Normalization{Type: "domain"}, "alice@Example.com", "example.com"},
+		{"domain of url", Normalization{Type: "domain"}, "https://www.Example.com:8443/path", "www.example.com"},
+		{"domain of host", Normalization{Type: "domain"}, "Example.com:80", "example.com"},
+		{"e164 national", Normalization{Type: "e164", CountryCode: "31"}, "06-12345678", "+31612345678"},
+		{"e164 international", Normalization{Type: "e164", CountryCode: "31"}, "0031 6 12345678", "+31612345678"},
+		{"e164 without country code", Normalization{Type: "e164"}, "06-12345678", "06-12345678"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := New([]Normalization{tt.normalization})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := n.String("field", tt.value); got != tt.want {
+				t.Fatalf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestNormalizeInvalid(t *testing.T) {
+	tests := []struct {
+		name          string
+		normalization Normalization
+	}{
+		{"unknown", Normalization{Type: "unknown"}},
+		{"regex", Normalization{Regex: "("}},
+		{"prefix length", Normalization{Type: "cidr", PrefixLength: 129}},
+		{"country code", Normalization{Type: "e164", CountryCode: "+31"}},
+	}
+
+	for _, tt := range tests {
+		if _, err := New([]Normalization{tt.normalization}); err == nil {
+			t.Errorf("%s: expected error", tt.name)
+		}
+	}
+}
+
+func TestNormalizer(t *testing.T) {
+	n, err := New([]Normalization{
+		{Type: "trim"},
+		{Type: "lowercase", Fields: []string{"user"}},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		field string
+		value interface{}
+		want  interface{}
+	}{
+		{"user", " Alice ", "alice"},
+		{"host", " Alice ", "Alice"},
+		{"user", []string{" A", "B "}, []string{"a", "b"}},
+		{"user", []interface{}{" A", 1.0, []interface{}{"B"}}, []interface{}{"a", 1.0, []interface{}{"b"}}},
+		{"user", 1.0, 1.0},
+	}
+
+	for _, tt := range tests {
+		if got := n.Value(tt.field, tt.value); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Value(%s, %#v) = %#v, want %#v", tt.field, tt.value, got, tt.want)
+		}
+	}
+
+	var nilNormalizer *Normalizer
+	if got := nilNormalizer.String("user", " Alice "); got != " Alice " {
+		t.Errorf("Expected nil normalizer not to normalize, got %q", got)
+	}
+}
+
+func TestNormalizationDecode(t *testing.T) {
+	expected := []Normalization{
+		{Regex: `^www\.`, ReplaceWith: "web."},
+		{Type: "cidr", Fields: []string{"ip"}, PrefixLength: 24},
+		{Type: "e164", CountryCode: "31"},
+	}
+
+	var fromJSON []Normalization
+	if err := json.Unmarshal([]byte(`[
+		{"regex": "^www\\.", "replace-with": "web."},
+		{"type": "cidr", "fields": ["ip"], "prefix-length": 24},
+		{"type": "e164", "country-code": "31"}
+	]`), &fromJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(fromJSON, expected) {
+		t.Errorf("Expected %#v, got %#v", expected, fromJSON)
+	}
+
+	var fromTOML struct {
+		Normalization []Normalization
+	}
+
+	if _, err := toml.Decode(`
+[[normalization]]
+regex='^www\.'
+replace-with="web."
+
+[[normalization]]
+type="cidr"
+fields=["ip"]
+prefix-length=24
+
+[[normalization]]
+type="e164"
+country-code="31"
+`, &fromTOML); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(fromTOML.Normalization, expected) {
+		t.Errorf("Expected %#v, got %#v", expected, fromTOML.Normalization)
+	}
+}
@@ -0,0 +1,47 @@
+package normalize
+
+import (
+	"strings"
+)
+
+// E164 returns the phone number s in E.164 format, like +31612345678.
+// National numbers starting with a single 0 get countryCode as calling code,
+// without countryCode they are returned as is, like other values.
+func E164(s string, countryCode string) string {
+	v := strings.TrimSpace(s)
+
+	// the trunk prefix written within international numbers, as in
+	// +31 (0)6 12345678
+	v = strings.Replace(v, "(0)", "", -1)
+
+	digits := []byte{}
+	for i := 0; i < len(v); i++ {
+		switch c := v[i]; {
+		case c >= '0' && c <= '9':
+			digits = append(digits, c)
+		case c == '+' && len(digits) == 0 && i == 0:
+		case strings.IndexByte(" -.()/", c) != -1:
+		default:
+			return s
+		}
+	}
+
+	number := string(digits)
+
+	switch {
+	case strings.HasPrefix(v, "+"):
+	case strings.HasPrefix(number, "00"):
+		number = number[2:]
+	case strings.HasPrefix(number, "0") && countryCode != "":
+		number = countryCode + number[1:]
+	default:
+		return s
+	}
+
+	// numbers are at most 15 digits, and don't start with a 0
+	if len(number) < 7 || len(number) > 15 || number[0] == '0' {
+		return s
+	}
+
+	return "+" + number
+}
@@ -21,6 +21,8 @@ func WithConfig(val string) func(*Server) {
 			panic(err)
 		}
 
+		server.file = val
+
 		logBackends := []logging.Backend{}
 		for _, log := range server.Logging {
 			var err error
@@ -69,3 +71,27 @@ func WithAddress(addr string) func(*Server) {
 		server.address = addr
 	}
 }
+
+func WithTLSCert(val string) func(*Server) {
+	return func(server *Server) {
+		server.TLSCert = val
+	}
+}
+
+func WithTLSKey(val string) func(*Server) {
+	return func(server *Server) {
+		server.TLSKey = val
+	}
+}
+
+func WithClientCA(val string) func(*Server) {
+	return func(server *Server) {
+		server.TLSClientCA = val
+	}
+}
+
+func WithRedirect(addr string) func(*Server) {
+	return func(server *Server) {
+		server.TLSRedirect = addr
+	}
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"encoding/hex"
+
+	"github.com/dutchcoders/marija/server/datasources"
+	"github.com/dutchcoders/marija/server/normalize"
+)
+
+type edgeKey struct {
+	source, target, typ, field string
+}
+
+// edges are the edges of a search by source, target, type and field.
+type edges map[edgeKey]*datasources.Edge
+
+// add adds the relation between source and target to its edge, and returns
+// the updated edge.
+func (e edges) add(source, target string, r datasources.Relation) datasources.Edge {
+	key := edgeKey{source, target, r.Type, r.Field}
+
+	edge, ok := e[key]
+	if !ok {
+		edge = &datasources.Edge{
+			Source: source,
+			Target: target,
+			Field:  r.Field,
+			Type:   r.Type,
+		}
+
+		e[key] = edge
+	}
+
+	edge.Count++
+	edge.Weight += r.Weight
+
+	// times are replaced instead of updated, as copies of the edge have
+	// been sent already
+	if r.Time == nil {
+	} else if edge.FirstSeen == nil || r.Time.Before(*edge.FirstSeen) {
+		t := *r.Time
+		edge.FirstSeen = &t
+	}
+
+	if r.Time == nil {
+	} else if edge.LastSeen == nil || r.Time.After(*edge.LastSeen) {
+		t := *r.Time
+		edge.LastSeen = &t
+	}
+
+	return *edge
+}
+
+// relate returns the nodes of the values of the relations of item and their
+// typed edges. The values are normalized by n, values of fields belonging to
+// an entity are entity nodes. Nodes in seen have been returned for the item
+// already and aren't counted again.
+func (c *connection) relate(cur *cursor, index string, n *normalize.Normalizer, item datasources.Item, seen map[string]bool) ([]datasources.Node, []datasources.Edge) {
+	entities := c.state().entities
+
+	nodes := []datasources.Node{}
+
+	keys := []edgeKey{}
+	updated := map[edgeKey]datasources.Edge{}
+
+	for _, relation := range item.Relations {
+		if relation.Source == "" || relation.Target == "" {
+			continue
+		}
+
+		ids := []string{}
+
+		for _, value := range []string{relation.Source, relation.Target} {
+			value = n.String(relation.Field, value)
+
+			if name, ok := entities.entity(relation.Field); ok {
+				entity := entityID(name, value)
+				ids = append(ids, entity)
+
+				if seen[entity] {
+					continue
+				}
+
+				seen[entity] = true
+
+				nodes = append(nodes, entities.add(name, value, index))
+
+				c.storeItem(entity, item)
+				continue
+			}
+
+			values := map[string]interface{}{
+				relation.Field: value,
+			}
+
+			hash := hashFields(values)
+
+			nodeID := hex.EncodeToString(hash)
+			ids = append(ids, nodeID)
+
+			if seen[nodeID] {
+				continue
+			}
+
+			seen[nodeID] = true
+
+			nodes = append(nodes, *c.node(cur.unique, index, hash, values, item))
+		}
+
+		edge := cur.edges.add(ids[0], ids[1], relation)
+
+		key := edgeKey{edge.Source, edge.Target, edge.Type, edge.Field}
+		if _, ok := updated[key]; !ok {
+			keys = append(keys, key)
+		}
+
+		updated[key] = edge
+	}
+
+	edges := []datasources.Edge{}
+	for _, key := range keys {
+		edges = append(edges, updated[key])
+	}
+
+	return nodes, edges
+}
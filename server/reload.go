@@ -0,0 +1,331 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+	"github.com/dutchcoders/marija/server/datasources"
+	"github.com/dutchcoders/marija/server/messages"
+	"github.com/dutchcoders/marija/server/normalize"
+)
+
+type Broadcasterer interface {
+	Broadcast(context.Context, string) chan json.Marshaler
+}
+
+// newDatasource constructs the datasource of type configured in p.
+func (server *Server) newDatasource(key string, p toml.Primitive) (datasources.Index, error) {
+	x := struct {
+		Type string `toml:"type"`
+	}{}
+
+	if err := toml.PrimitiveDecode(p, &x); err != nil {
+		return nil, err
+	}
+
+	fn, err := datasources.Get(x.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	return fn(
+		datasources.WithConfig(p),
+	)
+}
+
+// newNormalizer constructs the normalizer of the normalizations configured in
+// p, the normalizer is nil without normalizations.
+func (server *Server) newNormalizer(p toml.Primitive) (*normalize.Normalizer, error) {
+	x := struct {
+		Normalizations []normalize.Normalization `toml:"normalization"`
+	}{}
+
+	if err := toml.PrimitiveDecode(p, &x); err != nil {
+		return nil, err
+	} else if len(x.Normalizations) == 0 {
+		return nil, nil
+	}
+
+	return normalize.New(x.Normalizations)
+}
+
+// applyDatasources constructs the datasources that are new or whose
+// configuration has changed, and tears down the datasources that have been
+// removed or replaced. Unchanged datasources keep running, as do changed
+// datasources whose new configuration fails.
+func (server *Server) applyDatasources(prims map[string]toml.Primitive) {
+	server.reloading.Lock()
+	defer server.reloading.Unlock()
+
+	configs := map[string]map[string]interface{}{}
+	errs := map[string]error{}
+
+	for key, p := range prims {
+		c := map[string]interface{}{}
+		if err := toml.PrimitiveDecode(p, &c); err != nil {
+			log.Error("Error parsing configuration of datasource: %s: %s", key, err.Error())
+			errs[key] = err
+			continue
+		}
+
+		configs[key] = c
+	}
+
+	changed := []string{}
+	removed := []string{}
+
+	server.m.RLock()
+
+	for key, c := range configs {
+		if old, ok := server.datasourceConfigs[key]; ok && reflect.DeepEqual(old, c) {
+			continue
+		}
+
+		changed = append(changed, key)
+	}
+
+	for key := range server.datasourceConfigs {
+		if _, ok := prims[key]; !ok {
+			removed = append(removed, key)
+		}
+	}
+
+	server.m.RUnlock()
+
+	// datasources are constructed outside of the lock, as they could be
+	// connecting to their backends
+	created := map[string]datasources.Index{}
+	normalizers := map[string]*normalize.Normalizer{}
+	failed := map[string]error{}
+
+	for _, key := range changed {
+		normalizer, err := server.newNormalizer(prims[key])
+		if err != nil {
+			log.Error("Error parsing normalizations of datasource: %s: %s", key, err.Error())
+			failed[key] = err
+			continue
+		}
+
+		ds, err := server.newDatasource(key, prims[key])
+		if err != nil {
+			log.Error("Error parsing configuration of datasource: %s: %s", key, err.Error())
+			failed[key] = err
+			continue
+		}
+
+		created[key] = ds
+		normalizers[key] = normalizer
+	}
+
+	server.m.Lock()
+	defer server.m.Unlock()
+
+	closers := map[string]io.Closer{}
+	defer server.retire(closers)
+
+	for _, key := range removed {
+		log.Info("Removing datasource: %s", key)
+
+		if c := server.teardown(key); c != nil {
+			closers[key] = c
+		}
+
+		delete(server.datasourceConfigs, key)
+	}
+
+	for key := range server.datasourceStatus {
+		if _, ok := prims[key]; !ok {
+			delete(server.datasourceStatus, key)
+		}
+	}
+
+	for key, err := range errs {
+		server.fail(key, "", err)
+	}
+
+	for _, key := range changed {
+		typ, _ := configs[key]["type"].(string)
+
+		ds, ok := created[key]
+		if !ok {
+			server.fail(key, typ, failed[key])
+			continue
+		}
+
+		if c := server.teardown(key); c != nil {
+			closers[key] = c
+		}
+
+		delete(server.datasourceConfigs, key)
+
+		log.Info("Starting datasource: %s", key)
+
+		server.Datasources[key] = ds
+		server.datasourceConfigs[key] = configs[key]
+		server.datasourceNormalizers[key] = normalizers[key]
+		server.datasourceStatus[key] = &datasourceStatus{
+			Type: typ,
+		}
+
+		if bc, ok := ds.(Broadcasterer); ok {
+			ctx, cancel := context.WithCancel(server.ctx)
+			server.datasourceCancels[key] = cancel
+
+			go func(key string) {
+				for m := range bc.Broadcast(ctx, key) {
+					liveMessagesTotal.WithLabelValues(key).Inc()
+
+					h.SendDatasource(key, m)
+				}
+			}(key)
+		}
+	}
+}
+
+// fail records the error applying the configuration of a datasource, a
+// running datasource keeps its previous configuration. The caller needs to
+// hold the lock.
+func (server *Server) fail(key string, typ string, err error) {
+	if _, ok := server.Datasources[key]; !ok {
+		server.datasourceStatus[key] = &datasourceStatus{
+			Type: typ,
+			Err:  err,
+		}
+
+		return
+	}
+
+	log.Warning("Keeping previous configuration of datasource: %s", key)
+
+	if status, ok := server.datasourceStatus[key]; ok {
+		status.ReloadErr = err
+	}
+}
+
+// teardown stops the datasource and returns it when it needs to be closed.
+// The caller needs to hold the lock.
+func (server *Server) teardown(key string) io.Closer {
+	if cancel, ok := server.datasourceCancels[key]; ok {
+		cancel()
+		delete(server.datasourceCancels, key)
+	}
+
+	ds, ok := server.Datasources[key]
+	if !ok {
+		return nil
+	}
+
+	delete(server.Datasources, key)
+	delete(server.datasourceNormalizers, key)
+
+	c, _ := ds.(io.Closer)
+	return c
+}
+
+// retire closes the datasources that have been torn down, once the requests
+// that could be using them are done. Requests started from now on will use
+// the new datasources. The caller needs to hold the lock.
+func (server *Server) retire(closers map[string]io.Closer) {
+	if len(closers) == 0 {
+		return
+	}
+
+	users := server.users
+	server.users = &sync.WaitGroup{}
+
+	go func() {
+		users.Wait()
+
+		for key, c := range closers {
+			if err := c.Close(); err != nil {
+				log.Error("Error closing datasource: %s: %s", key, err.Error())
+			}
+		}
+	}()
+}
+
+// use marks the caller as user of the current datasources, the returned func
+// needs to be called when done.
+func (server *Server) use() func() {
+	server.m.RLock()
+	users := server.users
+	users.Add(1)
+	server.m.RUnlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(users.Done)
+	}
+}
+
+// Reload reads the datasources from the configuration file again, applies
+// the changes and sends the updated list of datasources to all clients.
+func (server *Server) Reload() error {
+	if server.file == "" {
+		return errors.New("No configuration file set")
+	}
+
+	c := config{}
+	if _, err := toml.DecodeFile(server.file, &c); err != nil {
+		return fmt.Errorf("Error reading configuration: %s", err.Error())
+	}
+
+	log.Info("Reloading datasources from %s", server.file)
+
+	server.applyDatasources(c.Datasources)
+
+	for _, c := range h.list() {
+		c.Send(&messages.DatasourcesMessage{
+			Datasources: c.datasourceList(),
+		})
+	}
+
+	return nil
+}
+
+// ReloadHandler reloads the configuration of the datasources.
+func (server *Server) ReloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := server.Reload(); err != nil {
+		log.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// datasourceList returns the datasources the user of the connection is
+// allowed to use.
+func (c *connection) datasourceList() []messages.Datasource {
+	c.server.m.RLock()
+	defer c.server.m.RUnlock()
+
+	list := make([]messages.Datasource, 0, len(c.server.Datasources))
+
+	for k, ds := range c.server.Datasources {
+		if !c.user.Allowed(k) {
+			continue
+		}
+
+		list = append(list, messages.Datasource{ID: k, Name: k, Type: ds.Type()})
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+
+	return list
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/dutchcoders/marija/server/datasources"
+)
+
+type closingIndex struct {
+	closed chan struct{}
+}
+
+func (ci *closingIndex) Search(ctx context.Context, so datasources.SearchOptions) datasources.SearchResponse {
+	return nil
+}
+
+func (ci *closingIndex) GetFields(ctx context.Context) ([]datasources.Field, error) {
+	return nil, nil
+}
+
+func (ci *closingIndex) Type() string {
+	return "closing"
+}
+
+func (ci *closingIndex) Close() error {
+	close(ci.closed)
+	return nil
+}
+
+func TestRetire(t *testing.T) {
+	server := New()
+
+	ci := &closingIndex{closed: make(chan struct{})}
+
+	server.m.Lock()
+	server.Datasources["a"] = ci
+	server.datasourceConfigs["a"] = map[string]interface{}{"type": "closing"}
+	server.m.Unlock()
+
+	done := server.use()
+
+	server.applyDatasources(map[string]toml.Primitive{})
+
+	if _, ok := server.GetDatasource("a"); ok {
+		t.Fatal("Expected the datasource to be removed")
+	}
+
+	// requests started after the reload don't keep the datasource open
+	after := server.use()
+	defer after()
+
+	select {
+	case <-ci.closed:
+		t.Fatal("Expected the datasource to be kept open while in use")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	done()
+
+	select {
+	case <-ci.closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the datasource to be closed when no longer in use")
+	}
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"sync"
+)
+
+// requests are the requests in flight of a connection or session, by request
+// id. A request is referenced by the read pump while it is being handled and
+// by each of its goroutines, it is removed when the last reference has been
+// released.
+type requests struct {
+	m        sync.Mutex
+	requests map[string]*request
+}
+
+type request struct {
+	id     string
+	cancel context.CancelFunc
+	done   func()
+	refs   int
+}
+
+func newRequests() *requests {
+	return &requests{
+		requests: map[string]*request{},
+	}
+}
+
+// add adds the request and returns the reference of the caller, done is
+// called when the last reference has been released. A request reusing the id
+// of a request in flight replaces it.
+func (rs *requests) add(requestID string, cancel context.CancelFunc, done func()) *request {
+	rs.m.Lock()
+	defer rs.m.Unlock()
+
+	r := &request{
+		id:     requestID,
+		cancel: cancel,
+		done:   done,
+		refs:   1,
+	}
+
+	rs.requests[requestID] = r
+	return r
+}
+
+// acquire returns a reference to the request, or nil when the request has
+// already been removed.
+func (rs *requests) acquire(requestID string) *request {
+	rs.m.Lock()
+	defer rs.m.Unlock()
+
+	r, ok := rs.requests[requestID]
+	if !ok {
+		return nil
+	}
+
+	r.refs++
+	return r
+}
+
+// release releases a reference to the request, the context of the request is
+// released and the request removed when it was the last reference. Canceled
+// requests are done once their goroutines have returned.
+func (rs *requests) release(r *request) {
+	if r == nil {
+		return
+	}
+
+	rs.m.Lock()
+	defer rs.m.Unlock()
+
+	r.refs--
+	if r.refs > 0 {
+		return
+	}
+
+	r.cancel()
+	r.done()
+
+	if rs.requests[r.id] == r {
+		delete(rs.requests, r.id)
+	}
+}
+
+// cancel cancels and removes the request.
+func (rs *requests) cancel(requestID string) bool {
+	rs.m.Lock()
+	defer rs.m.Unlock()
+
+	r, ok := rs.requests[requestID]
+	if !ok {
+		return false
+	}
+
+	r.cancel()
+
+	delete(rs.requests, requestID)
+	return true
+}
+
+// cancelAll cancels and removes all requests.
+func (rs *requests) cancelAll() {
+	rs.m.Lock()
+	defer rs.m.Unlock()
+
+	for _, r := range rs.requests {
+		r.cancel()
+	}
+
+	rs.requests = map[string]*request{}
+}
+
+func (rs *requests) len() int {
+	rs.m.Lock()
+	defer rs.m.Unlock()
+
+	return len(rs.requests)
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRequests(t *testing.T) {
+	type op func(rs *requests, refs map[string][]*request, canceled map[string]int)
+
+	add := func(id string) op {
+		return func(rs *requests, refs map[string][]*request, canceled map[string]int) {
+			refs[id] = append(refs[id], rs.add(id, func() { canceled[id]++ }, func() {}))
+		}
+	}
+
+	acquire := func(id string) op {
+		return func(rs *requests, refs map[string][]*request, canceled map[string]int) {
+			if r := rs.acquire(id); r != nil {
+				refs[id] = append(refs[id], r)
+			}
+		}
+	}
+
+	release := func(id string) op {
+		return func(rs *requests, refs map[string][]*request, canceled map[string]int) {
+			r := refs[id][0]
+			refs[id] = refs[id][1:]
+
+			rs.release(r)
+		}
+	}
+
+	cancel := func(id string) op {
+		return func(rs *requests, refs map[string][]*request, canceled map[string]int) {
+			rs.cancel(id)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		ops      []op
+		len      int
+		canceled map[string]int
+	}{
+		{
+			name:     "completed",
+			ops:      []op{add("1"), release("1")},
+			len:      0,
+			canceled: map[string]int{"1": 1},
+		},
+		{
+			name:     "in flight",
+			ops:      []op{add("1"), acquire("1"), release("1")},
+			len:      1,
+			canceled: map[string]int{},
+		},
+		{
+			name:     "goroutines completed",
+			ops:      []op{add("1"), acquire("1"), acquire("1"), release("1"), release("1"), release("1")},
+			len:      0,
+			canceled: map[string]int{"1": 1},
+		},
+		{
+			name:     "canceled",
+			ops:      []op{add("1"), acquire("1"), cancel("1"), release("1"), release("1")},
+			len:      0,
+			canceled: map[string]int{"1": 2},
+		},
+		{
+			name:     "acquire removed",
+			ops:      []op{add("1"), release("1"), acquire("1")},
+			len:      0,
+			canceled: map[string]int{"1": 1},
+		},
+		{
+			// the continuation of a search reuses the id of the search
+			name:     "replaced",
+			ops:      []op{add("1"), acquire("1"), add("1"), release("1"), release("1")},
+			len:      1,
+			canceled: map[string]int{"1": 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := newRequests()
+
+			refs := map[string][]*request{}
+			canceled := map[string]int{}
+
+			for _, op := range tt.ops {
+				op(rs, refs, canceled)
+			}
+
+			if n := rs.len(); n != tt.len {
+				t.Errorf("len() = %d, want %d", n, tt.len)
+			}
+
+			for id, want := range tt.canceled {
+				if got := canceled[id]; got != want {
+					t.Errorf("canceled(%q) = %d, want %d", id, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRequestsCancelAll(t *testing.T) {
+	rs := newRequests()
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+
+	rs.add("1", cancel1, func() {})
+	r := rs.add("2", cancel2, func() {})
+	rs.acquire("2")
+
+	rs.cancelAll()
+
+	if ctx1.Err() == nil || ctx2.Err() == nil {
+		t.Error("Expected all requests to be canceled")
+	} else if n := rs.len(); n != 0 {
+		t.Errorf("len() = %d, want 0", n)
+	}
+
+	// releasing canceled requests is a no-op
+	rs.release(r)
+	rs.release(r)
+
+	if n := rs.len(); n != 0 {
+		t.Errorf("len() = %d, want 0", n)
+	}
+}
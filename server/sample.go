@@ -0,0 +1,128 @@
+package server
+
+import (
+	"container/heap"
+	"context"
+	"math/rand"
+	"sort"
+
+	"github.com/dutchcoders/marija/server/datasources"
+)
+
+// sampleSearch searches for a random sample of the results. Datasources that
+// support sampling return their results in random order, for others all
+// results are searched and a random sample is taken.
+type sampleSearch struct {
+	datasources.Index
+
+	seed int64
+}
+
+func (ss *sampleSearch) Search(ctx context.Context, so datasources.SearchOptions) datasources.SearchResponse {
+	if sampler, ok := ss.Index.(datasources.Sampler); ok {
+		return sampler.Sample(ctx, so, ss.seed)
+	}
+
+	itemCh := make(chan datasources.Item)
+	errorCh := make(chan error)
+
+	go func() {
+		defer close(itemCh)
+		defer close(errorCh)
+
+		// the search is canceled when returning early
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		// every result gets a random priority, the results with the lowest
+		// priorities are the sample. Samples with the same seed are the same,
+		// a larger sample starts with the smaller one, which makes it
+		// possible to continue.
+		rnd := rand.New(rand.NewSource(ss.seed))
+
+		n := so.From + so.Size
+
+		sample := &prioritized{}
+
+		all := so
+		all.From, all.Size, all.Continuation = 0, 0, ""
+
+		response := ss.Index.Search(ctx, all)
+		defer datasources.Drain(response)
+
+		itemsCh, errsCh := response.Item(), response.Error()
+		for itemsCh != nil || errsCh != nil {
+			select {
+			case item, ok := <-itemsCh:
+				if !ok {
+					itemsCh = nil
+					continue
+				}
+
+				p := rnd.Float64()
+
+				if sample.Len() < n {
+					heap.Push(sample, prioritizedItem{item, p})
+				} else if p < (*sample)[0].priority {
+					(*sample)[0] = prioritizedItem{item, p}
+					heap.Fix(sample, 0)
+				}
+			case err, ok := <-errsCh:
+				if !ok {
+					errsCh = nil
+					continue
+				}
+
+				select {
+				case errorCh <- err:
+				case <-ctx.Done():
+				}
+
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		items := *sample
+		sort.Slice(items, func(i, j int) bool {
+			return items[i].priority < items[j].priority
+		})
+
+		for i := so.From; i < len(items); i++ {
+			select {
+			case itemCh <- items[i].item:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return datasources.NewSearchResponse(
+		itemCh,
+		errorCh,
+	)
+}
+
+type prioritizedItem struct {
+	item     datasources.Item
+	priority float64
+}
+
+// prioritized is a max heap of items by priority.
+type prioritized []prioritizedItem
+
+func (p prioritized) Len() int           { return len(p) }
+func (p prioritized) Less(i, j int) bool { return p[i].priority > p[j].priority }
+func (p prioritized) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+func (p *prioritized) Push(x interface{}) {
+	*p = append(*p, x.(prioritizedItem))
+}
+
+func (p *prioritized) Pop() interface{} {
+	old := *p
+	x := old[len(old)-1]
+	*p = old[:len(old)-1]
+	return x
+}
@@ -7,13 +7,17 @@ import (
 	"fmt"
 	"hash/fnv"
 	_ "log"
+	"math/rand"
 	"runtime"
 	"sort"
 	"time"
 
 	"github.com/dutchcoders/marija/server/datasources"
+	"github.com/dutchcoders/marija/server/datasources/query"
 	"github.com/dutchcoders/marija/server/messages"
+	"github.com/dutchcoders/marija/server/normalize"
 	"github.com/dutchcoders/marija/server/unique"
+	uuid "github.com/satori/go.uuid"
 )
 
 func (c *connection) Search(ctx context.Context, r messages.SearchRequest) error {
@@ -21,155 +25,352 @@ func (c *connection) Search(ctx context.Context, r messages.SearchRequest) error
 		return errors.New("No datasource set")
 	}
 
+	if s := c.Session(); s != nil {
+		s.addHistory(r)
+	}
+
+	expr, err := parseQuery(r.Query, r.Translate)
+	if err != nil {
+		return err
+	}
+
+	c.audit(auditEvent{
+		Action:          "search",
+		RequestID:       r.RequestID,
+		Datasources:     r.Datasources,
+		Query:           r.Query,
+		AdvancedQueries: r.AdvancedQueries,
+	})
+
+	// normalizations of the request override the normalizations of the
+	// datasources, an empty list disables them
+	normalizer, err := normalize.New(r.Normalizations)
+	if err != nil {
+		return err
+	}
+
+	cont := &continuation{
+		request:     r,
+		expr:        expr,
+		seed:        rand.Int63(),
+		cursors:     map[string]*cursor{},
+		normalizers: map[string]*normalize.Normalizer{},
+	}
+
 	for _, index := range r.Datasources {
-		log.Debug("Search query=%s, request=%s, index=%s", r.Query, r.RequestID, index)
+		cont.cursors[index] = &cursor{
+			id:     uuid.NewV4().String(),
+			limit:  c.server.maxResults(index, r.MaxResults),
+			unique: unique.New(),
+			edges:  edges{},
+		}
 
-		c.Send(&messages.SearchResponse{
-			RequestID:  r.RequestID,
-			Query:      r.Query,
-			Datasource: index,
-		})
+		if r.Normalizations != nil {
+			cont.normalizers[index] = normalizer
+		} else {
+			cont.normalizers[index] = c.server.normalizer(index)
+		}
+	}
+
+	c.state().addContinuation(r.RequestID, cont)
 
-		datasource, ok := c.server.GetDatasource(index)
-		if !ok {
+	for _, index := range r.Datasources {
+		datasource, err := c.datasource(index)
+		if err != nil {
 			c.Send(&messages.ErrorMessage{
 				RequestID: r.RequestID,
-				Message:   fmt.Sprintf("Could not find datasource: %s", index),
+				Message:   err.Error(),
 			})
 
-			log.Errorf("Could not find datasource: %s", index)
+			log.Error(err.Error())
 			continue
 		}
 
-		go func(index string) (err error) {
-			defer func() {
-				if err := recover(); err != nil {
-					trace := make([]byte, 1024)
-					count := runtime.Stack(trace, true)
-					log.Errorf("Error: %s", err)
-					log.Debugf("Stack of %d bytes: %s\n", count, string(trace))
-				}
-			}()
-
-			response := datasource.Search(ctx, datasources.SearchOptions{
-				Query:           r.Query,
-				AdvancedQueries: r.AdvancedQueries,
+		c.search(ctx, cont, index, datasource, false)
+	}
+
+	return nil
+}
+
+// parseQuery parses the query when it is written in the Marija query
+// language, it returns nil for native queries passed to the datasources as is.
+func parseQuery(q string, translate bool) (query.Node, error) {
+	if !translate {
+		return nil, nil
+	}
+
+	expr, err := query.Parse(q)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing query: %s", err.Error())
+	}
+
+	return expr, nil
+}
+
+// hashFields calculates the hash of the sorted fields of an item, the hash
+// is being used as identity of the node.
+func hashFields(fields map[string]interface{}) []byte {
+	keys := []string{}
+	for k := range fields {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	h := fnv.New128()
+	for _, k := range keys {
+		fmt.Fprintf(h, "\"%s\":\"%v\"", k, fields[k])
+	}
+
+	return h.Sum(nil)
+}
+
+// identity returns the values of the fields identifying the node of item,
+// normalized by n. Without fields all fields of the item are used. It returns
+// false when the item has none of the fields.
+func identity(fields []string, n *normalize.Normalizer, item datasources.Item) (map[string]interface{}, bool) {
+	values := map[string]interface{}{}
+
+	if len(fields) == 0 {
+		for k, v := range item.Fields {
+			values[k] = n.Value(k, v)
+		}
+
+		return values, true
+	}
+
+	for _, field := range fields {
+		v, ok := item.Fields[field]
+		if !ok || v == nil {
+			continue
+		}
+
+		values[field] = n.Value(field, v)
+	}
+
+	return values, len(values) > 0
+}
+
+// node returns the node for item with values as fields, creating it when it
+// hasn't been seen before and incrementing its count otherwise. The item is
+// added to the item cache.
+func (c *connection) node(unique *unique.Unique, index string, hash []byte, values map[string]interface{}, item datasources.Item) *datasources.Node {
+	i := &datasources.Graph{
+		ID:         hex.EncodeToString(hash),
+		Fields:     values,
+		Datasource: index,
+		Count:      1,
+	}
+
+	if v, ok := unique.Get(hash); ok {
+		i = v
+
+		i.Count++
+	}
+
+	// keep track of the indices the node has been found in
+	found := item.Index == ""
+	for _, index := range i.Indices {
+		found = found || index == item.Index
+	}
+
+	if !found {
+		i.Indices = append(i.Indices, item.Index)
+	}
+
+	unique.Add(hash, i)
+
+	c.storeItem(i.ID, item)
+
+	return i
+}
+
+// storeItem adds item to the items of the node with id in the item cache.
+func (c *connection) storeItem(id string, item datasources.Item) {
+	c.store().Append(id, item)
+}
+
+// stream runs the search on datasource and sends the resulting nodes and
+// edges in batches to the connection. Every item is mapped onto a node using
+// fn, items for which fn returns no nodes or edges are skipped. With a cursor the
+// results are limited to the limit of the cursor, so.Size is expected to
+// be one more to know whether more results are available.
+func (c *connection) stream(ctx context.Context, requestID string, query string, index string, datasource datasources.Index, so datasources.SearchOptions, cur *cursor, fn func(datasources.Item) ([]datasources.Node, []datasources.Edge)) (err error) {
+	defer func() {
+		if err := recover(); err != nil {
+			trace := make([]byte, 1024)
+			count := runtime.Stack(trace, true)
+			log.Errorf("Error: %s", err)
+			log.Debugf("Stack of %d bytes: %s\n", count, string(trace))
+		}
+	}()
+
+	start := time.Now()
+
+	searchesTotal.WithLabelValues(index).Inc()
+
+	first := true
+	count := 0
+	more := false
+
+	graphs := []datasources.Graph{}
+	edges := []datasources.Edge{}
+
+	defer func() {
+		status, message := auditStatus(err)
+
+		c.audit(auditEvent{
+			Action:          "search-completed",
+			RequestID:       requestID,
+			Datasources:     []string{index},
+			Query:           query,
+			AdvancedQueries: so.AdvancedQueries,
+			Status:          status,
+			Error:           message,
+			Count:           auditCount(count),
+		})
+	}()
+
+	defer func() {
+		if err == context.Canceled {
+			searchesCanceledTotal.WithLabelValues(index).Inc()
+
+			log.Debug("Search canceled query=%s, requestid=%s, index=%s", query, requestID, index)
+
+			c.Send(&messages.RequestCanceled{
+				RequestID: requestID,
 			})
+		} else if err != nil {
+			c.server.observe(index, time.Since(start))
 
-			unique := unique.New()
-
-			graphs := []datasources.Graph{}
-
-			defer func() {
-				if err == context.Canceled {
-					log.Debug("Search canceled query=%s, requestid=%s, index=%s", r.Query, r.RequestID, index)
-
-					c.Send(&messages.RequestCanceled{
-						RequestID: r.RequestID,
-					})
-				} else if err != nil {
-					log.Error("Search error query=%s, requestid=%s, index=%s, error=%s", r.Query, r.RequestID, index, err.Error())
-
-					c.Send(&messages.ErrorMessage{
-						RequestID: r.RequestID,
-						Message:   err.Error(),
-					})
-				} else {
-					c.Send(&messages.SearchResponse{
-						RequestID:  r.RequestID,
-						Query:      r.Query,
-						Graphs:     graphs,
-						Datasource: index,
-					})
-
-					c.Send(&messages.RequestCompleted{
-						RequestID: r.RequestID,
-					})
-
-					log.Debug("Search completed query=%s, requestid=%s, index=%s", r.Query, r.RequestID, index)
-				}
-			}()
-
-			for {
-				select {
-				case <-ctx.Done():
-					err = ctx.Err()
-					return
-				case err, ok := <-response.Error():
-					if !ok {
-						return nil
-					}
-
-					return err
-				case item, ok := <-response.Item():
-					if !ok {
-						return nil
-					}
-
-					// filter fields
-					keys := []string{}
-					values := map[string]interface{}{}
-
-					for k, v := range item.Fields {
-						keys = append(keys, k)
-
-						values[k] = v
-					}
-
-					sort.Strings(keys)
-
-					// calculate hash of fields
-					h := fnv.New128()
-					for _, k := range keys {
-						fmt.Fprintf(h, "\"%s\":\"%v\"", k, values[k])
-					}
-
-					hash := h.Sum(nil)
-					hashHex := hex.EncodeToString(hash)
-
-					i := &datasources.Graph{
-						ID:         hashHex,
-						Fields:     values,
-						Datasource: index,
-						Count:      1,
-					}
-
-					if v, ok := unique.Get(hash); ok {
-						i = v
-
-						i.Count++
-					}
-
-					unique.Add(hash, i)
-
-					items, _ := c.items.LoadOrStore(i.ID, []datasources.Item{})
-					items = append(items, item)
-
-					c.items.Store(i.ID, items)
-
-					graphs = append(graphs, *i)
-
-					if len(graphs) < 20 {
-						continue
-					}
-				case <-time.After(time.Second * 5):
-				}
-
-				if len(graphs) == 0 {
-					continue
-				}
-
-				c.Send(&messages.SearchResponse{
-					RequestID:  r.RequestID,
-					Query:      r.Query,
-					Graphs:     graphs,
-					Datasource: index,
-				})
-
-				graphs = []datasources.Graph{}
+			searchErrorsTotal.WithLabelValues(index).Inc()
+			searchDurationSeconds.WithLabelValues(index).Observe(time.Since(start).Seconds())
+
+			log.Error("Search error query=%s, requestid=%s, index=%s, error=%s", query, requestID, index, err.Error())
+
+			c.Send(&messages.ErrorMessage{
+				RequestID: requestID,
+				Message:   err.Error(),
+			})
+		} else {
+			c.server.observe(index, time.Since(start))
+
+			searchDurationSeconds.WithLabelValues(index).Observe(time.Since(start).Seconds())
+
+			c.Send(&messages.SearchResponse{
+				RequestID:  requestID,
+				Query:      query,
+				Graphs:     graphs,
+				Edges:      edges,
+				Datasource: index,
+				More:       more,
+			})
+
+			c.Send(&messages.RequestCompleted{
+				RequestID: requestID,
+			})
+
+			log.Debug("Search completed query=%s, requestid=%s, index=%s", query, requestID, index)
+		}
+	}()
+
+	if cur != nil {
+		// the cursor needs to be done before the last response is sent, as
+		// the search can be continued after
+		defer func() {
+			if err != nil {
+				cur.done(0, err != context.Canceled)
+			} else {
+				cur.done(count, more)
 			}
-		}(index)
+		}()
 	}
 
-	return nil
+	// the number of concurrent searches per connection is limited, searches
+	// wait until the results of others have been sent
+	select {
+	case c.streams <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	defer func() {
+		<-c.streams
+	}()
+
+	// the search is canceled when the limit has been reached
+	searchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	response := datasource.Search(searchCtx, so)
+
+	defer func() {
+		// the datasource could still be sending after canceling
+		datasources.Drain(response)
+	}()
+
+	flush := time.NewTicker(time.Second * 5)
+	defer flush.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		case err, ok := <-response.Error():
+			if !ok {
+				return nil
+			}
+
+			return err
+		case item, ok := <-response.Item():
+			if !ok {
+				return nil
+			}
+
+			if cur != nil && cur.limit > 0 && count >= cur.limit {
+				more = true
+				return nil
+			}
+
+			item.Datasource = index
+
+			itemsTotal.WithLabelValues(index).Inc()
+
+			count++
+
+			if first {
+				searchFirstResultSeconds.WithLabelValues(index).Observe(time.Since(start).Seconds())
+				first = false
+			}
+
+			nodes, nodeEdges := fn(item)
+			if len(nodes) == 0 && len(nodeEdges) == 0 {
+				continue
+			}
+
+			graphs = append(graphs, nodes...)
+			edges = append(edges, nodeEdges...)
+
+			if len(graphs) < 20 {
+				continue
+			}
+		case <-flush.C:
+		}
+
+		if len(graphs) == 0 && len(edges) == 0 {
+			continue
+		}
+
+		c.Send(&messages.SearchResponse{
+			RequestID:  requestID,
+			Query:      query,
+			Graphs:     graphs,
+			Edges:      edges,
+			Datasource: index,
+		})
+
+		graphs = []datasources.Graph{}
+		edges = []datasources.Edge{}
+	}
 }
@@ -2,23 +2,31 @@ package server
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	_ "log"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
-	"github.com/BurntSushi/toml"
+	"github.com/dutchcoders/marija/server/auth"
 	"github.com/dutchcoders/marija/server/datasources"
+	"github.com/dutchcoders/marija/server/normalize"
 	isatty "github.com/mattn/go-isatty"
 
 	_ "github.com/dutchcoders/marija/server/datasources/blockchain"
 	_ "github.com/dutchcoders/marija/server/datasources/censys"
 	_ "github.com/dutchcoders/marija/server/datasources/es5"
+	_ "github.com/dutchcoders/marija/server/datasources/es7"
+	_ "github.com/dutchcoders/marija/server/datasources/file"
 	_ "github.com/dutchcoders/marija/server/datasources/live"
 	_ "github.com/dutchcoders/marija/server/datasources/openkvk"
+	_ "github.com/dutchcoders/marija/server/datasources/solr"
 	_ "github.com/dutchcoders/marija/server/datasources/splunk"
+	_ "github.com/dutchcoders/marija/server/datasources/sql"
 	_ "github.com/dutchcoders/marija/server/datasources/tronscan"
 	_ "github.com/dutchcoders/marija/server/datasources/twitter"
 	_ "github.com/dutchcoders/marija/server/datasources/voertuiggegevens"
@@ -33,17 +41,79 @@ import (
 
 var log = logging.MustGetLogger("marija/server")
 
+const (
+	// Time to wait for requests in flight to complete when stopping.
+	defaultDrainTimeout = 30 * time.Second
+
+	// Time to wait for canceled requests to clean up when stopping.
+	cleanupTimeout = 5 * time.Second
+)
+
 type Server struct {
 	*config
 
-	Datasources map[string]datasources.Index
+	// m guards the datasources, which will be replaced when the
+	// configuration is reloaded.
+	m                 sync.RWMutex
+	Datasources       map[string]datasources.Index
+	datasourceConfigs map[string]map[string]interface{}
+	datasourceCancels map[string]context.CancelFunc
+	datasourceStatus  map[string]*datasourceStatus
+
+	// datasourceNormalizers normalize the field values of the datasources
+	datasourceNormalizers map[string]*normalize.Normalizer
+
+	// reloading serializes reloads of the datasources.
+	reloading sync.Mutex
+
+	// users are the requests that could be using the current datasources,
+	// replaced datasources are closed when their users are done.
+	users *sync.WaitGroup
+
+	items    ItemStore
+	sessions *sessions
+
+	// entities are the entities by field
+	entities map[string]string
+
+	exports *exports
+
+	authenticator auth.Authenticator
+	basicAuth     bool
+
+	auditor *auditor
+
+	// ctx is the root context of all requests, it will be canceled when the
+	// server stops.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// wg tracks the requests in flight, tm guards tracking new requests
+	// against the server stopping.
+	wg       sync.WaitGroup
+	tm       sync.RWMutex
+	ready    int32
+	stopping int32
 }
 
 func New(options ...func(*Server)) *Server {
+	ctx, cancel := context.WithCancel(context.Background())
+
 	server := &Server{
 		config: &config{
 			debug: false,
 		},
+		Datasources:       map[string]datasources.Index{},
+		datasourceConfigs: map[string]map[string]interface{}{},
+		datasourceCancels: map[string]context.CancelFunc{},
+		datasourceStatus:  map[string]*datasourceStatus{},
+		users:             &sync.WaitGroup{},
+		ctx:               ctx,
+		cancel:            cancel,
+
+		datasourceNormalizers: map[string]*normalize.Normalizer{},
+
+		exports: newExports(),
 	}
 
 	for _, optionFn := range options {
@@ -83,10 +153,32 @@ func (server *Server) Run() {
 		staticHandler = http.FileServer(http.Dir(server.path))
 	}
 
+	if authenticator, err := server.newAuthenticator(); err != nil {
+		log.Fatalf("Error configuring authentication: %s", err.Error())
+	} else {
+		server.authenticator = authenticator
+	}
+
+	// browsers will only prompt for basic authentication credentials when
+	// loading the page, the static files contain no data otherwise
+	if server.basicAuth {
+		staticHandler = server.authenticate(staticHandler)
+	}
+
 	http.Handle("/", staticHandler)
 
-	http.HandleFunc("/submit", server.SubmitHandler)
-	http.HandleFunc("/ws", server.serveWs)
+	http.Handle("/submit", server.authenticate(http.HandlerFunc(server.SubmitHandler)))
+	http.Handle("/ws", server.authenticate(http.HandlerFunc(server.serveWs)))
+
+	http.HandleFunc("/healthz", server.HealthzHandler)
+	http.HandleFunc("/readyz", server.ReadyzHandler)
+
+	http.Handle("/metrics", server.authenticate(metricsHandler))
+
+	http.Handle("/api/v1/export/", server.authenticate(http.HandlerFunc(server.ExportHandler)))
+
+	http.Handle("/api/v1/datasources", server.authenticate(server.admin(http.HandlerFunc(server.DatasourcesHandler))))
+	http.Handle("/api/v1/reload", server.authenticate(server.admin(http.HandlerFunc(server.ReloadHandler))))
 
 	if IsTerminal(os.Stdout) {
 		fmt.Println(color.YellowString(`
@@ -101,75 +193,207 @@ Advanced (big) data discovery and exploration. %c
 `, 0x1f31d))
 	}
 
+	address := server.listenAddress()
+
+	tlsConfig, err := server.tlsConfig()
+	if err != nil {
+		log.Fatalf("Error configuring tls: %s", err.Error())
+	}
+
 	fmt.Println(color.YellowString("Marija server started %s (%s)", Version, ShortCommitID))
-	fmt.Println(color.YellowString("Listening on address %s.", server.address))
+
+	if tlsConfig != nil {
+		fmt.Println(color.YellowString("Listening on address %s (https).", address))
+	} else {
+		fmt.Println(color.YellowString("Listening on address %s.", address))
+	}
 
 	defer func() {
 		fmt.Println(color.YellowString("Marija server stopped"))
 	}()
 
-	server.Datasources = map[string]datasources.Index{}
+	if items, err := server.newItemStore(); err != nil {
+		log.Fatalf("Error opening item cache: %s", err.Error())
+	} else {
+		server.items = items
+	}
 
-	for key, s := range server.config.Datasources {
-		x := struct {
-			Type string `toml:"type"`
-		}{}
+	defer server.items.Close()
 
-		err := toml.PrimitiveDecode(s, &x)
-		if err != nil {
-			log.Error("Error parsing configuration of datasource: %s: %s", key, err.Error())
-			continue
-		}
+	if auditor, err := server.newAuditor(); err != nil {
+		log.Fatalf("Error opening audit log: %s", err.Error())
+	} else if auditor != nil {
+		server.auditor = auditor
 
-		fn, err := datasources.Get(x.Type)
-		if err != nil {
-			log.Error("Error parsing configuration of datasource: %s: %s", key, err.Error())
-			continue
+		defer auditor.Close()
+	}
+
+	if entities, err := server.newEntities(); err != nil {
+		log.Fatalf("Error configuring entities: %s", err.Error())
+	} else {
+		server.entities = entities
+	}
+
+	server.sessions = newSessions(server.items, server.entities)
+
+	if err := server.sessions.load(); err != nil {
+		log.Fatalf("Error loading sessions: %s", err.Error())
+	}
+
+	go func() {
+		timeout := defaultSessionTimeout
+		if server.SessionTimeout.Duration > 0 {
+			timeout = server.SessionTimeout.Duration
 		}
 
-		ds, err := fn(
-			datasources.WithConfig(s),
-		)
-		if err != nil {
-			log.Error("Error parsing configuration of datasource: %s: %s", key, err.Error())
-			continue
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				server.sessions.expire(timeout)
+			case <-server.ctx.Done():
+				return
+			}
 		}
+	}()
 
-		server.Datasources[key] = ds
+	server.applyDatasources(server.config.Datasources)
 
-		type Broadcasterer interface {
-			Broadcast(context.Context, string) chan json.Marshaler
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	srv := &http.Server{
+		Addr:      address,
+		TLSConfig: tlsConfig,
+	}
+
+	go func() {
+		if tlsConfig == nil {
+			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatal("ListenAndServe: ", err)
+			}
+		} else if err := srv.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+			log.Fatal("ListenAndServeTLS: ", err)
 		}
+	}()
+
+	servers := []*http.Server{srv}
+
+	if tlsConfig != nil && server.TLSRedirect != "" {
+		fmt.Println(color.YellowString("Redirecting http on address %s.", server.TLSRedirect))
 
-		if bc, ok := ds.(Broadcasterer); ok {
-			go func(key string) {
-				for m := range bc.Broadcast(context.Background(), key) {
-					h.Send(m)
-				}
-			}(key)
+		redirectSrv := &http.Server{
+			Addr:    server.TLSRedirect,
+			Handler: redirectHandler(address),
 		}
+
+		go func() {
+			if err := redirectSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatal("ListenAndServe: ", err)
+			}
+		}()
+
+		servers = append(servers, redirectSrv)
 	}
 
-	signals := make(chan os.Signal, 1)
-	signal.Notify(signals, os.Interrupt)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
 
 	go func() {
-		if err := http.ListenAndServe(server.address, nil); err != nil {
-			log.Fatal("ListenAndServe: ", err)
+		for range hup {
+			if err := server.Reload(); err != nil {
+				log.Error(err.Error())
+			}
 		}
 	}()
 
-	for {
-		select {
-		case <-signals:
-			fmt.Println(color.YellowString("Marija server stopping..."))
-			return
+	atomic.StoreInt32(&server.ready, 1)
+
+	<-signals
+
+	fmt.Println(color.YellowString("Marija server stopping..."))
+
+	server.shutdown(servers...)
+}
+
+// shutdown stops the listeners and waits for the requests in flight to
+// complete until the drain timeout expires. Remaining requests will be
+// canceled and connected clients will receive a close frame.
+func (server *Server) shutdown(servers ...*http.Server) {
+	server.tm.Lock()
+	atomic.StoreInt32(&server.stopping, 1)
+	server.tm.Unlock()
+
+	timeout := defaultDrainTimeout
+	if server.DrainTimeout.Duration > 0 {
+		timeout = server.DrainTimeout.Duration
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	for _, srv := range servers {
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Error("Error shutting down listener %s: %s", srv.Addr, err.Error())
 		}
 	}
 
+	drained := make(chan struct{})
+	go func() {
+		server.wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		log.Warning("Drain timeout expired, canceling requests in flight")
+	}
+
+	server.cancel()
+
+	h.Close()
+
+	// give canceled requests time to clean up at the datasources
+	select {
+	case <-drained:
+	case <-time.After(cleanupTimeout):
+	}
+}
+
+// Stopping returns true when the server is shutting down.
+func (server *Server) Stopping() bool {
+	return atomic.LoadInt32(&server.stopping) == 1
+}
+
+// track runs fn in a goroutine that is tracked as request in flight. No
+// requests are started once the server is stopping, track returns false
+// when fn hasn't been run.
+func (server *Server) track(fn func()) bool {
+	server.tm.RLock()
+	defer server.tm.RUnlock()
+
+	if server.Stopping() {
+		return false
+	}
+
+	server.wg.Add(1)
+
+	go func() {
+		defer server.wg.Done()
+
+		fn()
+	}()
+
+	return true
 }
 
 func (s *Server) GetDatasource(key string) (datasources.Index, bool) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
 	if _, ok := s.Datasources[key]; !ok {
 		return nil, false
 	}
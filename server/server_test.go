@@ -0,0 +1,49 @@
+package server
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/dutchcoders/marija/server/messages"
+)
+
+func TestTrack(t *testing.T) {
+	server := &Server{}
+
+	done := make(chan struct{})
+	if !server.track(func() { close(done) }) {
+		t.Fatal("Expected the request to be tracked")
+	}
+
+	<-done
+	server.wg.Wait()
+
+	atomic.StoreInt32(&server.stopping, 1)
+
+	if server.track(func() { t.Error("Expected the request not to run") }) {
+		t.Error("Expected requests to be refused when stopping")
+	}
+}
+
+func TestConnectionTrackStopping(t *testing.T) {
+	c := newTestConnection(NewItemCache(0, 0, 0))
+	c.server = &Server{stopping: 1}
+
+	req := c.requests.add("1", func() {}, func() {})
+
+	c.track("1", func() { t.Error("Expected the request not to run") })
+	c.requests.release(req)
+
+	if n := c.requests.len(); n != 0 {
+		t.Errorf("Expected the request to be removed, got %d requests", n)
+	}
+
+	select {
+	case v := <-c.sendCh:
+		if m, ok := v.(*messages.ErrorMessage); !ok || m.RequestID != "1" {
+			t.Errorf("Expected an error message for request 1, got %#v", v)
+		}
+	default:
+		t.Error("Expected the request to be refused")
+	}
+}
@@ -0,0 +1,365 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dutchcoders/marija/server/datasources"
+	"github.com/dutchcoders/marija/server/messages"
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	// Maximum number of messages kept for a detached session.
+	maxBacklog = 10000
+
+	// Maximum number of queries kept in the history of a session.
+	maxHistory = 100
+
+	// Time a detached session is kept when no timeout has been configured.
+	defaultSessionTimeout = 30 * time.Minute
+)
+
+// session is a named investigation that outlives the websocket connection.
+// It owns the state, query history and pending requests, messages sent while
+// no connection is attached are kept until the session is resumed.
+type session struct {
+	ID    string
+	Name  string
+	Owner string
+
+	state *state
+	store sessionStore
+
+	requests *requests
+
+	m        sync.Mutex
+	conn     *connection
+	history  []messages.SearchRequest
+	backlog  []json.Marshaler
+	lastSeen time.Time
+}
+
+func (s *session) Send(v json.Marshaler) {
+	s.m.Lock()
+
+	conn := s.conn
+	if conn == nil {
+		if len(s.backlog) >= maxBacklog {
+			s.backlog = s.backlog[1:]
+		}
+
+		s.backlog = append(s.backlog, v)
+		s.m.Unlock()
+		return
+	}
+
+	s.m.Unlock()
+
+	conn.send(v)
+}
+
+// attach attaches the connection to the session and flushes the messages
+// that were sent while the session was detached. The connection the session
+// was attached to before is returned.
+func (s *session) attach(c *connection) *connection {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	prev := s.conn
+	s.conn = c
+
+	for _, v := range s.backlog {
+		c.send(v)
+	}
+
+	s.backlog = nil
+
+	s.persist()
+
+	return prev
+}
+
+func (s *session) detach(c *connection) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.conn != c {
+		return
+	}
+
+	s.conn = nil
+	s.lastSeen = time.Now()
+
+	s.persist()
+}
+
+// persist writes the session to the session store, if the item store keeps
+// sessions. The time the session was last seen is only kept while detached.
+func (s *session) persist() {
+	if s.store == nil {
+		return
+	}
+
+	rec := sessionRecord{
+		ID:      s.ID,
+		Name:    s.Name,
+		Owner:   s.Owner,
+		Prefix:  s.state.prefix,
+		History: s.history,
+	}
+
+	if s.conn == nil {
+		rec.LastSeen = s.lastSeen
+	}
+
+	if err := s.store.StoreSession(rec); err != nil {
+		log.Errorf("Error storing session %s: %s", s.ID, err.Error())
+	}
+}
+
+func (s *session) addHistory(r messages.SearchRequest) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if len(s.history) >= maxHistory {
+		s.history = s.history[1:]
+	}
+
+	s.history = append(s.history, r)
+
+	s.persist()
+}
+
+func (s *session) response(requestID string) *messages.SessionResponse {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	history := make([]messages.SearchRequest, len(s.history))
+	copy(history, s.history)
+
+	return &messages.SessionResponse{
+		RequestID: requestID,
+		SessionID: s.ID,
+		Name:      s.Name,
+		History:   history,
+	}
+}
+
+// expired returns true when the session has been detached for longer than
+// timeout.
+func (s *session) expired(timeout time.Duration) bool {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.conn == nil && time.Since(s.lastSeen) > timeout
+}
+
+func (s *session) close() {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.requests.cancelAll()
+
+	s.backlog = nil
+}
+
+// sessionRecord is a session as kept by the session store, the prefix is the
+// prefix of the items of the session in the item store.
+type sessionRecord struct {
+	ID       string                   `json:"id"`
+	Name     string                   `json:"name"`
+	Owner    string                   `json:"owner"`
+	Prefix   string                   `json:"prefix"`
+	History  []messages.SearchRequest `json:"history,omitempty"`
+	LastSeen time.Time                `json:"last_seen,omitempty"`
+}
+
+// sessionStore is implemented by item stores that keep the sessions, so
+// sessions can be resumed after a restart and their items will be found.
+type sessionStore interface {
+	Sessions() ([]sessionRecord, error)
+	StoreSession(rec sessionRecord) error
+
+	// DeleteSession removes the session and its items.
+	DeleteSession(id string) error
+}
+
+type sessions struct {
+	store    sessionStore
+	items    ItemStore
+	entities map[string]string
+
+	m        sync.Mutex
+	sessions map[string]*session
+}
+
+// newSessions returns the sessions keeping their items in items, the sessions
+// are kept by the item store as well when it implements sessionStore.
+func newSessions(items ItemStore, entities map[string]string) *sessions {
+	store, _ := items.(sessionStore)
+
+	return &sessions{
+		store:    store,
+		items:    items,
+		entities: entities,
+		sessions: map[string]*session{},
+	}
+}
+
+// load restores the sessions kept by the session store, sessions that were
+// attached when the server stopped are detached from now on.
+func (ss *sessions) load() error {
+	if ss.store == nil {
+		return nil
+	}
+
+	records, err := ss.store.Sessions()
+	if err != nil {
+		return err
+	}
+
+	ss.m.Lock()
+	defer ss.m.Unlock()
+
+	for _, rec := range records {
+		lastSeen := rec.LastSeen
+		if lastSeen.IsZero() {
+			lastSeen = time.Now()
+		}
+
+		ss.sessions[rec.ID] = &session{
+			ID:       rec.ID,
+			Name:     rec.Name,
+			Owner:    rec.Owner,
+			state:    newState(ss.items, rec.Prefix, ss.entities),
+			store:    ss.store,
+			history:  rec.History,
+			requests: newRequests(),
+			lastSeen: lastSeen,
+		}
+	}
+
+	return nil
+}
+
+func (ss *sessions) Create(name string, owner string) *session {
+	id := uuid.NewV4().String()
+
+	s := &session{
+		ID:       id,
+		Name:     name,
+		Owner:    owner,
+		state:    newState(ss.items, sessionPrefix(id), ss.entities),
+		store:    ss.store,
+		requests: newRequests(),
+		lastSeen: time.Now(),
+	}
+
+	s.m.Lock()
+	s.persist()
+	s.m.Unlock()
+
+	ss.m.Lock()
+	defer ss.m.Unlock()
+
+	ss.sessions[id] = s
+	return s
+}
+
+func (ss *sessions) Get(id string) (*session, bool) {
+	ss.m.Lock()
+	defer ss.m.Unlock()
+
+	s, ok := ss.sessions[id]
+	return s, ok
+}
+
+// expire closes and removes the sessions that have been detached for longer
+// than timeout, their items are removed from the store.
+func (ss *sessions) expire(timeout time.Duration) {
+	ss.m.Lock()
+	defer ss.m.Unlock()
+
+	for id, s := range ss.sessions {
+		if !s.expired(timeout) {
+			continue
+		}
+
+		log.Debug("Session expired session=%s, name=%s", s.ID, s.Name)
+
+		s.close()
+
+		if ss.store == nil {
+			s.state.purge()
+		} else if err := ss.store.DeleteSession(id); err != nil {
+			log.Errorf("Error deleting session %s: %s", id, err.Error())
+		}
+
+		delete(ss.sessions, id)
+	}
+}
+
+// prefixStore scopes an item store to the keys of a single connection or
+// session.
+type prefixStore struct {
+	ItemStore
+
+	prefix string
+}
+
+func (ps *prefixStore) Load(key string) ([]datasources.Item, bool) {
+	return ps.ItemStore.Load(ps.prefix + key)
+}
+
+func (ps *prefixStore) Store(key string, items []datasources.Item) {
+	ps.ItemStore.Store(ps.prefix+key, items)
+}
+
+func (ps *prefixStore) LoadOrStore(key string, items []datasources.Item) ([]datasources.Item, bool) {
+	return ps.ItemStore.LoadOrStore(ps.prefix+key, items)
+}
+
+func (ps *prefixStore) Append(key string, item datasources.Item) {
+	ps.ItemStore.Append(ps.prefix+key, item)
+}
+
+func (ps *prefixStore) Purge(prefix string) {
+	ps.ItemStore.Purge(ps.prefix + prefix)
+}
+
+// Close is a no-op, the underlying store is owned by the server.
+func (ps *prefixStore) Close() error {
+	return nil
+}
+
+// CreateSession creates a new session and attaches the connection to it.
+func (c *connection) CreateSession(r messages.SessionCreateRequest) error {
+	s := c.server.sessions.Create(r.Name, c.user.String())
+
+	log.Info("Session created session=%s, name=%s", s.ID, s.Name)
+
+	c.attach(s)
+
+	c.Send(s.response(r.RequestID))
+	return nil
+}
+
+// ResumeSession attaches the connection to an existing session, messages of
+// requests that continued while detached will be sent to the connection.
+func (c *connection) ResumeSession(r messages.SessionResumeRequest) error {
+	// sessions of other users are reported as not found
+	s, ok := c.server.sessions.Get(r.SessionID)
+	if !ok || s.Owner != c.user.String() {
+		return fmt.Errorf("Could not find session: %s", r.SessionID)
+	}
+
+	log.Info("Session resumed session=%s, name=%s", s.ID, s.Name)
+
+	c.attach(s)
+
+	c.Send(s.response(r.RequestID))
+	return nil
+}
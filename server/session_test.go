@@ -0,0 +1,69 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/dutchcoders/marija/server/messages"
+)
+
+func newTestConnection(store ItemStore) *connection {
+	st := newState(store, userPrefix("alice"), nil)
+
+	return &connection{
+		sendCh:   make(chan json.Marshaler, 16),
+		done:     make(chan struct{}),
+		st:       st,
+		own:      st,
+		requests: newRequests(),
+	}
+}
+
+func TestSessionResumed(t *testing.T) {
+	store := NewItemCache(0, 0, 0)
+
+	ss := newSessions(store, nil)
+	s := ss.Create("investigation", "alice")
+
+	first := newTestConnection(store)
+	second := newTestConnection(store)
+
+	first.attach(s)
+	second.attach(s)
+
+	if first.Session() != nil {
+		t.Error("Expected the first connection to be detached")
+	} else if first.state() != first.own {
+		t.Error("Expected the first connection to continue with its own state")
+	} else if second.Session() != s {
+		t.Error("Expected the second connection to be attached")
+	}
+
+	select {
+	case v := <-first.sendCh:
+		if _, ok := v.(*messages.ErrorMessage); !ok {
+			t.Errorf("Expected an error message, got %#v", v)
+		}
+	default:
+		t.Error("Expected the first connection to be notified")
+	}
+
+	s.Send(&messages.ErrorMessage{Message: "to the session"})
+
+	if len(first.sendCh) != 0 {
+		t.Error("Expected messages of the session to be sent to the second connection only")
+	} else if len(second.sendCh) != 1 {
+		t.Errorf("Expected 1 message sent to the second connection, got %d", len(second.sendCh))
+	}
+
+	// the first connection dropping doesn't detach the session
+	s.detach(first)
+
+	s.m.Lock()
+	conn := s.conn
+	s.m.Unlock()
+
+	if conn != second {
+		t.Error("Expected the session to stay attached to the second connection")
+	}
+}
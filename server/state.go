@@ -0,0 +1,65 @@
+package server
+
+import (
+	"sync"
+)
+
+// state is the state of an investigation: the items of the nodes, the graph
+// sent, the entities and the searches that can be continued. It is kept by
+// the connection, or by the session attached to it, so it outlives the
+// connection.
+type state struct {
+	// prefix is the prefix of the items of the state in the store.
+	prefix string
+
+	items    ItemStore
+	graph    *sentGraph
+	entities *entityIndex
+
+	m               sync.Mutex
+	continuations   map[string]*continuation
+	continuationIDs []string
+}
+
+// newState returns the state keeping its items in store, under prefix.
+func newState(store ItemStore, prefix string, entities map[string]string) *state {
+	return &state{
+		prefix: prefix,
+		items: &prefixStore{
+			ItemStore: store,
+			prefix:    prefix,
+		},
+		graph:         newSentGraph(),
+		entities:      newEntityIndex(entities),
+		continuations: map[string]*continuation{},
+	}
+}
+
+func (st *state) addContinuation(requestID string, cont *continuation) {
+	st.m.Lock()
+	defer st.m.Unlock()
+
+	if _, ok := st.continuations[requestID]; !ok {
+		st.continuationIDs = append(st.continuationIDs, requestID)
+	}
+
+	st.continuations[requestID] = cont
+
+	for len(st.continuationIDs) > maxContinuations {
+		delete(st.continuations, st.continuationIDs[0])
+		st.continuationIDs = st.continuationIDs[1:]
+	}
+}
+
+func (st *state) continuation(requestID string) (*continuation, bool) {
+	st.m.Lock()
+	defer st.m.Unlock()
+
+	cont, ok := st.continuations[requestID]
+	return cont, ok
+}
+
+// purge removes the items of the state from the store.
+func (st *state) purge() {
+	st.items.Purge("")
+}
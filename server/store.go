@@ -0,0 +1,82 @@
+package server
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/dutchcoders/marija/server/datasources"
+)
+
+// ItemStore stores the items of every node, keyed by node id.
+type ItemStore interface {
+	Load(key string) ([]datasources.Item, bool)
+	Store(key string, items []datasources.Item)
+	LoadOrStore(key string, items []datasources.Item) ([]datasources.Item, bool)
+
+	// Append adds item to the items of key, items with the same index and
+	// id are stored once.
+	Append(key string, item datasources.Item)
+
+	// Purge removes the keys starting with prefix.
+	Purge(prefix string)
+
+	Close() error
+}
+
+var (
+	_ ItemStore = &ItemCache{}
+	_ ItemStore = &DiskStore{}
+)
+
+// newItemStore returns the item store as configured in the cache section of
+// the configuration.
+func (server *Server) newItemStore() (ItemStore, error) {
+	c := server.Cache
+
+	switch c.Type {
+	case "", "memory":
+		return NewItemCache(c.MaxEntries, int64(c.MaxSize), c.TTL.Duration), nil
+	case "disk":
+		if c.Path == "" {
+			return nil, fmt.Errorf("No path set for disk cache")
+		}
+
+		return OpenDiskStore(os.ExpandEnv(c.Path), c.MaxEntries, int64(c.MaxSize), c.TTL.Duration)
+	default:
+		return nil, fmt.Errorf("Unknown cache type: %s", c.Type)
+	}
+}
+
+// userPrefix is the prefix of the items of the connections of a user without
+// a session, so the items are kept across reconnects and browser tabs.
+func userPrefix(user string) string {
+	return "user/" + url.PathEscape(user) + "/"
+}
+
+// sessionPrefix is the prefix of the items of a session.
+func sessionPrefix(id string) string {
+	return "session/" + id + "/"
+}
+
+// itemKey identifies an item within the items of a node, items without id
+// can't be identified.
+func itemKey(item datasources.Item) (string, bool) {
+	if item.ID == "" {
+		return "", false
+	}
+
+	return item.Index + "/" + item.ID, true
+}
+
+// itemKeys returns the keys of the items.
+func itemKeys(items []datasources.Item) map[string]bool {
+	keys := map[string]bool{}
+	for _, item := range items {
+		if key, ok := itemKey(item); ok {
+			keys[key] = true
+		}
+	}
+
+	return keys
+}
@@ -0,0 +1,280 @@
+package server
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/dutchcoders/marija/server/datasources"
+)
+
+// stores returns the item stores to test, created by fn with the limits.
+func stores(t *testing.T) map[string]func(maxEntries int, maxSize int64, ttl time.Duration) ItemStore {
+	return map[string]func(int, int64, time.Duration) ItemStore{
+		"memory": func(maxEntries int, maxSize int64, ttl time.Duration) ItemStore {
+			return NewItemCache(maxEntries, maxSize, ttl)
+		},
+		"disk": func(maxEntries int, maxSize int64, ttl time.Duration) ItemStore {
+			ds, err := OpenDiskStore(filepath.Join(t.TempDir(), "marija.cache"), maxEntries, maxSize, ttl)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			t.Cleanup(func() {
+				ds.Close()
+			})
+
+			return ds
+		},
+	}
+}
+
+func item(index, id string) datasources.Item {
+	return datasources.Item{
+		ID:     id,
+		Index:  index,
+		Fields: map[string]interface{}{"name": id},
+	}
+}
+
+// loadIDs returns the ids of the items of key, or nil when key isn't found.
+func loadIDs(store ItemStore, key string) []string {
+	items, ok := store.Load(key)
+	if !ok {
+		return nil
+	}
+
+	ids := []string{}
+	for _, item := range items {
+		ids = append(ids, item.ID)
+	}
+
+	return ids
+}
+
+func TestItemStore(t *testing.T) {
+	type op func(ItemStore)
+
+	appendItem := func(key, id string) op {
+		return func(s ItemStore) {
+			s.Append(key, item("index", id))
+		}
+	}
+
+	storeItems := func(key string, ids ...string) op {
+		return func(s ItemStore) {
+			items := []datasources.Item{}
+			for _, id := range ids {
+				items = append(items, item("index", id))
+			}
+
+			s.Store(key, items)
+		}
+	}
+
+	load := func(key string) op {
+		return func(s ItemStore) {
+			s.Load(key)
+		}
+	}
+
+	purge := func(prefix string) op {
+		return func(s ItemStore) {
+			s.Purge(prefix)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		maxEntries int
+		maxSize    int64
+		ops        []op
+		want       map[string][]string
+	}{
+		{
+			name: "append",
+			ops:  []op{appendItem("a", "1"), appendItem("a", "2"), appendItem("b", "3")},
+			want: map[string][]string{"a": {"1", "2"}, "b": {"3"}},
+		},
+		{
+			name: "append once",
+			ops:  []op{appendItem("a", "1"), appendItem("a", "2"), appendItem("a", "1")},
+			want: map[string][]string{"a": {"1", "2"}},
+		},
+		{
+			name: "store replaces",
+			ops:  []op{appendItem("a", "1"), storeItems("a", "2", "3"), appendItem("a", "2")},
+			want: map[string][]string{"a": {"2", "3"}},
+		},
+		{
+			name: "purge",
+			ops: []op{
+				appendItem("session/1/a", "1"), appendItem("session/1/b", "2"),
+				appendItem("session/2/a", "3"), purge("session/1/"),
+			},
+			want: map[string][]string{"session/1/a": nil, "session/1/b": nil, "session/2/a": {"3"}},
+		},
+		{
+			name:       "evict least recently used",
+			maxEntries: 2,
+			ops:        []op{appendItem("a", "1"), appendItem("b", "2"), load("a"), appendItem("c", "3")},
+			want:       map[string][]string{"a": {"1"}, "b": nil, "c": {"3"}},
+		},
+		{
+			name:       "evict when appending",
+			maxEntries: 2,
+			ops:        []op{appendItem("a", "1"), appendItem("b", "2"), appendItem("a", "3"), appendItem("c", "4")},
+			want:       map[string][]string{"a": {"1", "3"}, "b": nil, "c": {"4"}},
+		},
+		{
+			name:    "evict by size",
+			maxSize: 150,
+			ops:     []op{appendItem("a", "1"), appendItem("b", "2"), appendItem("c", "3")},
+			want:    map[string][]string{"a": nil, "b": {"2"}, "c": {"3"}},
+		},
+	}
+
+	for name, newStore := range stores(t) {
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				s := newStore(tt.maxEntries, tt.maxSize, 0)
+
+				for _, op := range tt.ops {
+					op(s)
+				}
+
+				for key, want := range tt.want {
+					if got := loadIDs(s, key); !reflect.DeepEqual(got, want) {
+						t.Errorf("Load(%q) = %v, want %v", key, got, want)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestItemStoreTTL(t *testing.T) {
+	for name, newStore := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			s := newStore(0, 0, 100*time.Millisecond)
+
+			s.Append("a", item("index", "1"))
+			s.Append("b", item("index", "2"))
+
+			time.Sleep(60 * time.Millisecond)
+
+			// appending extends the expiration
+			s.Append("a", item("index", "3"))
+
+			time.Sleep(60 * time.Millisecond)
+
+			if got := loadIDs(s, "a"); !reflect.DeepEqual(got, []string{"1", "3"}) {
+				t.Errorf("Load(a) = %v, want [1 3]", got)
+			}
+
+			if got := loadIDs(s, "b"); got != nil {
+				t.Errorf("Load(b) = %v, want expired", got)
+			}
+
+			// expired nodes start over
+			time.Sleep(120 * time.Millisecond)
+
+			s.Append("a", item("index", "4"))
+
+			if got := loadIDs(s, "a"); !reflect.DeepEqual(got, []string{"4"}) {
+				t.Errorf("Load(a) = %v, want [4]", got)
+			}
+		})
+	}
+}
+
+func TestPrefixStore(t *testing.T) {
+	store := NewItemCache(0, 0, 0)
+
+	alice := newState(store, userPrefix("alice"), nil)
+	bob := newState(store, userPrefix("bob/x"), nil)
+	sess := newState(store, sessionPrefix("1"), nil)
+
+	alice.items.Append("n", item("index", "1"))
+	bob.items.Append("n", item("index", "2"))
+	sess.items.Append("n", item("index", "3"))
+
+	tests := []struct {
+		st   *state
+		want []string
+	}{
+		{alice, []string{"1"}},
+		{bob, []string{"2"}},
+		{sess, []string{"3"}},
+	}
+
+	for _, tt := range tests {
+		if got := loadIDs(tt.st.items, "n"); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Load(%sn) = %v, want %v", tt.st.prefix, got, tt.want)
+		}
+	}
+
+	sess.purge()
+
+	if got := loadIDs(sess.items, "n"); got != nil {
+		t.Errorf("Expected the items of the session to be purged, got %v", got)
+	} else if got := loadIDs(alice.items, "n"); got == nil {
+		t.Error("Expected the items of the user to be kept")
+	}
+}
+
+func TestByteSize(t *testing.T) {
+	tests := []struct {
+		text string
+		want byteSize
+		err  bool
+	}{
+		{"1024", 1024, false},
+		{"512B", 512, false},
+		{"64KB", 64 << 10, false},
+		{"512mb", 512 << 20, false},
+		{"1 GB", 1 << 30, false},
+		{"2TB", 2 << 40, false},
+		{"1.5GB", 0, true},
+		{"-1", 0, true},
+		{"GB", 0, true},
+	}
+
+	for _, tt := range tests {
+		var b byteSize
+
+		err := b.UnmarshalText([]byte(tt.text))
+		if tt.err && err == nil {
+			t.Errorf("UnmarshalText(%q): expected error", tt.text)
+		} else if !tt.err && err != nil {
+			t.Errorf("UnmarshalText(%q): %s", tt.text, err.Error())
+		} else if b != tt.want {
+			t.Errorf("UnmarshalText(%q) = %d, want %d", tt.text, b, tt.want)
+		}
+	}
+}
+
+func TestByteSizeDecode(t *testing.T) {
+	tests := []struct {
+		data string
+		want byteSize
+	}{
+		{`max_size="1GB"`, 1 << 30},
+		{`max_size=1024`, 1024},
+	}
+
+	for _, tt := range tests {
+		v := struct {
+			MaxSize byteSize `toml:"max_size"`
+		}{}
+
+		if _, err := toml.Decode(tt.data, &v); err != nil {
+			t.Errorf("Decode(%q): %s", tt.data, err.Error())
+		} else if v.MaxSize != tt.want {
+			t.Errorf("Decode(%q) = %d, want %d", tt.data, v.MaxSize, tt.want)
+		}
+	}
+}